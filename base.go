@@ -9,9 +9,14 @@ const (
 	DEFAULT_BUCKET_NUMBER int = 16
 	// DEFAULT_BUCKET_MAX_SIZE 代表单个散列桶的默认最大尺寸
 	DEFAULT_BUCKET_MAX_SIZE uint64 = 1000
+	// BUCKET_MIN_AVERAGE 代表计算散列桶重量阈值时所用平均尺寸的下限
+	BUCKET_MIN_AVERAGE float64 = 100
 )
 
 const (
+	// DEFAULT_CONCURRENCY 代表默认的并发量
+	DEFAULT_CONCURRENCY int = 16
 	// MAX_CONCURRENCY 代表最大并发量
+	// 它必须是2的幂
 	MAX_CONCURRENCY int = 65536
 )
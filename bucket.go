@@ -7,18 +7,18 @@ import (
 )
 
 // Bucket 代表并发安全的散列桶的接口
-type Bucket interface {
+type Bucket[K comparable, V any] interface {
 	// Put 放入一个键-元素对
 	// 第一个返回值表示是否新增了键-元素对
 	// 若在调用此方法前已经锁定lock,则不要把lock传入!否则必须传入对应的lock!
-	Put(p Pair, lock sync.Locker) (bool, error)
+	Put(p Pair[K, V], lock sync.Locker) (bool, error)
 	// Get 获取指定键的键-元素对
-	Get(key string) Pair
+	Get(key K) Pair[K, V]
 	// GetFirstPair 返回第一个键-元素对
-	GetFirstPair() Pair
+	GetFirstPair() Pair[K, V]
 	// Delete 删除指定的键-元素对
 	// 若在调用此方法前已经锁定lock,则不要把lock传入!否则必须传入对应的lock!
-	Delete(key string, lock sync.Locker) bool
+	Delete(key K, lock sync.Locker) bool
 	// Clear 清空当前散列桶
 	// 若在调用此方法前已经锁定lock,则不要把lock传入!否则必须传入对应的lock!
 	Clear(lock sync.Locker)
@@ -29,41 +29,47 @@ type Bucket interface {
 }
 
 // bucket 代表并发安全的散列桶的类型
-type bucket struct {
+type bucket[K comparable, V any] struct {
 	// firstValue 存储的是键-元素对列表的表头
 	firstValue atomic.Value
 	size       uint64
 }
 
-// 占位符
-// 由于原子值不能存储nil, 所以当散列桶空时用此符占位
-var placeholder Pair = &pair{}
+// placeholder 返回占位符
+// 由于原子值不能存储nil, 所以当散列桶空时用类型化的空指针占位
+func placeholder[K comparable, V any]() *pair[K, V] {
+	return nil
+}
 
 // newBucket 创建一个Bucket类型的实例
-func newBucket() Bucket {
-	b := &bucket{}
-	b.firstValue.Store(placeholder)
+func newBucket[K comparable, V any]() Bucket[K, V] {
+	b := &bucket[K, V]{}
+	b.firstValue.Store(placeholder[K, V]())
 	return b
 }
 
 // Put 放入一个键-元素对
 // 第一个返回值表示是否新增了键-元素对
 // 若在调用此方法前已经锁定lock,则不要把lock传入!否则必须传入对应的lock!
-func (b *bucket) Put(p Pair, lock sync.Locker) (bool, error) {
+func (b *bucket[K, V]) Put(p Pair[K, V], lock sync.Locker) (bool, error) {
 	if p == nil {
 		return false, newIllegalParameterError("pair is nil")
 	}
+	if _, ok := p.(*pair[K, V]); !ok {
+		return false, newIllegalPairTypeError(p)
+	}
 	if lock != nil {
 		lock.Lock()
 		defer lock.Unlock()
 	}
 	firstPair := b.GetFirstPair()
 	if firstPair == nil {
+		_ = p.SetNext(nil)
 		b.firstValue.Store(p)
 		atomic.AddUint64(&b.size, 1)
 		return true, nil
 	}
-	var target Pair
+	var target Pair[K, V]
 	key := p.Key()
 	for v := firstPair; v != nil; v = v.Next() {
 		if v.Key() == key {
@@ -74,6 +80,10 @@ func (b *bucket) Put(p Pair, lock sync.Locker) (bool, error) {
 	// 若k-v对存在
 	if target != nil {
 		_ = target.SetElement(p.Element())
+		target.SetExpiry(p.Expiry())
+		target.SetTTL(p.TTL())
+		target.SetCost(p.Cost())
+		target.SetWritten(p.Written())
 		return false, nil
 	}
 	_ = p.SetNext(firstPair)
@@ -83,7 +93,7 @@ func (b *bucket) Put(p Pair, lock sync.Locker) (bool, error) {
 }
 
 // Get 获取指定键的键-元素对
-func (b *bucket) Get(key string) Pair {
+func (b *bucket[K, V]) Get(key K) Pair[K, V] {
 	firstPair := b.GetFirstPair()
 	if firstPair == nil {
 		return nil
@@ -97,10 +107,10 @@ func (b *bucket) Get(key string) Pair {
 }
 
 // GetFirstPair 返回第一个键-元素对
-func (b *bucket) GetFirstPair() Pair {
+func (b *bucket[K, V]) GetFirstPair() Pair[K, V] {
 	if v := b.firstValue.Load(); v == nil {
 		return nil
-	} else if p, ok := v.(Pair); !ok || p == placeholder {
+	} else if p, ok := v.(*pair[K, V]); !ok || p == placeholder[K, V]() {
 		return nil
 	} else {
 		return p
@@ -109,7 +119,7 @@ func (b *bucket) GetFirstPair() Pair {
 
 // Delete 删除指定的键-元素对
 // 若在调用此方法前已经锁定lock,则不要把lock传入!否则必须传入对应的lock!
-func (b *bucket) Delete(key string, lock sync.Locker) bool {
+func (b *bucket[K, V]) Delete(key K, lock sync.Locker) bool {
 	if lock != nil {
 		lock.Lock()
 		defer lock.Unlock()
@@ -118,8 +128,8 @@ func (b *bucket) Delete(key string, lock sync.Locker) bool {
 	if firstPair == nil {
 		return false
 	}
-	var prevPairs []Pair
-	var target, breakpoint Pair
+	var prevPairs []Pair[K, V]
+	var target, breakpoint Pair[K, V]
 	for v := firstPair; v != nil; v = v.Next() {
 		if v.Key() == key {
 			target = v
@@ -140,7 +150,7 @@ func (b *bucket) Delete(key string, lock sync.Locker) bool {
 	if newFirstPair != nil {
 		b.firstValue.Store(newFirstPair)
 	} else {
-		b.firstValue.Store(placeholder)
+		b.firstValue.Store(placeholder[K, V]())
 	}
 	atomic.AddUint64(&b.size, ^uint64(0))
 	return true
@@ -149,22 +159,22 @@ func (b *bucket) Delete(key string, lock sync.Locker) bool {
 // Clear 清空当前散列桶
 // 若在调用此方法前已经
 // 锁定lock,则不要把lock传入!否则必须传入对应的lock!
-func (b *bucket) Clear(lock sync.Locker) {
+func (b *bucket[K, V]) Clear(lock sync.Locker) {
 	if lock != nil {
 		lock.Lock()
 		defer lock.Unlock()
 	}
 	atomic.StoreUint64(&b.size, 0)
-	b.firstValue.Store(placeholder)
+	b.firstValue.Store(placeholder[K, V]())
 }
 
 // Size 返回当前散列桶的尺寸
-func (b *bucket) Size() uint64 {
+func (b *bucket[K, V]) Size() uint64 {
 	return atomic.LoadUint64(&b.size)
 }
 
 // String 返回当前散列桶的字符串表示形式
-func (b *bucket) String() string {
+func (b *bucket[K, V]) String() string {
 	var buf bytes.Buffer
 	buf.WriteString("[")
 	for v := b.GetFirstPair(); v != nil; v = v.Next() {
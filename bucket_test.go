@@ -8,7 +8,7 @@ import (
 )
 
 func TestBucketNew(t *testing.T) {
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	if b == nil {
 		t.Fatal("Couldn't new bucket!")
 	}
@@ -18,7 +18,7 @@ func TestBucketNew(t *testing.T) {
 func TestBucketPut(t *testing.T) {
 	number := 30
 	testCases := genTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	var count uint64
 	for _, p := range testCases {
 		ok, err := b.Put(p, nil)
@@ -53,9 +53,9 @@ func TestBucketPut(t *testing.T) {
 func TestBucketPutInParallel(t *testing.T) {
 	number := 30
 	testCases := genNoRepetitiveTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	lock := new(sync.Mutex)
-	testingFunc := func(p Pair, t *testing.T) func(t *testing.T) {
+	testingFunc := func(p Pair[string, interface{}], t *testing.T) func(t *testing.T) {
 		return func(t *testing.T) {
 			t.Parallel()
 			ok, err := b.Put(p, lock)
@@ -92,11 +92,11 @@ func TestBucketPutInParallel(t *testing.T) {
 func TestBucketGetInParallel(t *testing.T) {
 	number := 30
 	testCases := genNoRepetitiveTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	for _, p := range testCases {
 		_, _ = b.Put(p, nil)
 	}
-	testingFunc := func(p Pair, t *testing.T) func(t *testing.T) {
+	testingFunc := func(p Pair[string, interface{}], t *testing.T) func(t *testing.T) {
 		return func(t *testing.T) {
 			t.Parallel()
 			actualPair := b.Get(p.Key())
@@ -132,7 +132,7 @@ func TestBucketGetInParallel(t *testing.T) {
 func TestBucketGetFirstPair(t *testing.T) {
 	number := 30
 	testCases := genTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	for _, p := range testCases {
 		_, _ = b.Put(p, nil)
 	}
@@ -162,7 +162,7 @@ func TestBucketGetFirstPair(t *testing.T) {
 func TestBucketDelete(t *testing.T) {
 	number := 30
 	testCases := genTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	for _, p := range testCases {
 		_, _ = b.Put(p, nil)
 	}
@@ -197,12 +197,12 @@ func TestBucketDelete(t *testing.T) {
 func TestBucketDeleteInParallel(t *testing.T) {
 	number := 30
 	testCases := genNoRepetitiveTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	for _, p := range testCases {
 		_, _ = b.Put(p, nil)
 	}
 	lock := new(sync.Mutex)
-	testingFunc := func(p Pair, t *testing.T) func(t *testing.T) {
+	testingFunc := func(p Pair[string, interface{}], t *testing.T) func(t *testing.T) {
 		return func(t *testing.T) {
 			t.Parallel()
 			done := b.Delete(p.Key(), lock)
@@ -234,7 +234,7 @@ func TestBucketDeleteInParallel(t *testing.T) {
 func TestBucketClear(t *testing.T) {
 	number := 10
 	testCases := genTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	for _, p := range testCases {
 		_, _ = b.Put(p, nil)
 	}
@@ -247,7 +247,7 @@ func TestBucketClear(t *testing.T) {
 func TestBucketClearParallel(t *testing.T) {
 	number := 1000
 	testCases := genTestingPairs(number)
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	lock := new(sync.Mutex)
 	t.Run("Clear in parallel", func(t *testing.T) {
 		t.Run("Put", func(t *testing.T) {
@@ -284,7 +284,7 @@ var testCases2ForBucketTest = testCasesForBucketTest[testCasesNumberForBucketTes
 func TestBucketAllParallel(t *testing.T) {
 	testCase1 := testCases1ForBucketTest
 	testCase2 := testCases2ForBucketTest
-	b := newBucket()
+	b := newBucket[string, interface{}]()
 	lock := new(sync.Mutex)
 	t.Run("All in parallel", func(t *testing.T) {
 		t.Run("Put1", func(t *testing.T) {
@@ -381,22 +381,24 @@ func TestBucketAllParallel(t *testing.T) {
 }
 
 // genTestingPairs 用于生成测试用的键-元素对
-func genTestingPairs(number int) []Pair {
-	testCases := make([]Pair, number)
+func genTestingPairs(number int) []Pair[string, interface{}] {
+	testCases := make([]Pair[string, interface{}], number)
 	for i := 0; i < number; i++ {
-		testCases[i], _ = newPair(randString(), randElement())
+		key := randString()
+		testCases[i], _ = newPair(key, hash(key), randElement())
 	}
 	return testCases
 }
 
 // genNoRepetitiveTestingPairs 用于生成测试的无重复的键-元素对的切片
-func genNoRepetitiveTestingPairs(number int) []Pair {
-	testCases := make([]Pair, number)
+func genNoRepetitiveTestingPairs(number int) []Pair[string, interface{}] {
+	testCases := make([]Pair[string, interface{}], number)
 	m := make(map[string]struct{})
-	var p Pair
+	var p Pair[string, interface{}]
 	for i := 0; i < number; i++ {
 		for {
-			p, _ = newPair(randString(), randElement())
+			key := randString()
+			p, _ = newPair(key, hash(key), randElement())
 			if _, ok := m[p.Key()]; !ok {
 				testCases[i] = p
 				m[p.Key()] = struct{}{}
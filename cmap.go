@@ -1,125 +1,659 @@
 package cmap
 
 import (
-	"math"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"reflect"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // ConcurrentMap 代表并发安全的字典接口
-type ConcurrentMap interface {
-	// Concurrency 返回并发量
+// 类型参数K代表键的类型,V代表元素的类型
+type ConcurrentMap[K comparable, V any] interface {
+	// MarshalJSON 将字典编码为JSON对象,成员名称为字符串形式的键
+	// UnmarshalJSON 将JSON对象中的成员放入字典
+	json.Marshaler
+	json.Unmarshaler
+	// Concurrency 返回并发量,即散列段的数量
+	// 它总是2的幂
 	Concurrency() int
 	// Put  推送一个键-元素对
 	// 注意!参数element的值不能为nil
 	// 第一个返回值表示是否新增了键-元素对
 	// 若键已存在,新元素会替换旧的元素值
-	Put(key string, element interface{}) (bool, error)
+	Put(key K, element V) (bool, error)
+	// PutWithTTL 推送一个在ttl之后过期的键-元素对
+	// 注意!参数element的值不能为nil
+	// 若参数ttl不大于0,则键-元素对永不过期
+	// Compute、Merge等方法原地更新该键的元素时沿用参数ttl,并重新开始计时
+	// 第一个返回值表示是否新增了键-元素对
+	PutWithTTL(key K, element V, ttl time.Duration) (bool, error)
 	// Get 获取与指定关联的那个元素
-	// 若返回nil, 则说明指定的键不存在
-	Get(key string) interface{}
+	// 若返回V的零值(对于接口类型即nil), 则说明指定的键不存在
+	Get(key K) V
 	// Delete 删除指定的键-元素对
 	// 若结果值为true则说明键已存在且已删除,否则说明键不存在
-	Delete(key string) bool
-	// Len 返回当前字典中键-元素对的数量
+	Delete(key K) bool
+	// PutIfAbsent 仅当指定的键不存在时才放入键-元素对
+	// 注意!参数element的值不能为nil
+	// 第一个返回值表示是否新增了键-元素对
+	PutIfAbsent(key K, element V) (bool, error)
+	// Compute 原子地根据旧元素计算指定键的新元素
+	// fn的参数为旧元素及键是否存在,返回新元素及是否保留该键
+	// 若keep为false,则删除已存在的键-元素对
+	// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+	Compute(key K, fn func(oldElement V, exists bool) (newElement V, keep bool)) (V, bool, error)
+	// ComputeIfAbsent 仅当指定的键不存在时原子地计算并放入新元素
+	// 若keep为false,则不放入任何元素
+	// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+	ComputeIfAbsent(key K, fn func() (element V, keep bool)) (V, bool, error)
+	// ComputeIfPresent 仅当指定的键存在时原子地根据旧元素计算新元素
+	// 若keep为false,则删除该键-元素对
+	// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+	ComputeIfPresent(key K, fn func(oldElement V) (newElement V, keep bool)) (V, bool, error)
+	// Merge 若指定的键不存在则放入element,否则原子地合并旧元素与element
+	// 若keep为false,则删除该键-元素对
+	// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+	Merge(key K, element V, fn func(oldElement, element V) (newElement V, keep bool)) (V, bool, error)
+	// CompareAndSwap 仅当指定键的当前元素等于oldElement时才将其替换为newElement
+	// 与sync.Map一致,oldElement必须是可比较的类型
+	// 若新元素为nil,则不做交换并返回false
+	// 返回值表示是否完成了交换
+	CompareAndSwap(key K, oldElement, newElement V) bool
+	// CompareAndDelete 仅当指定键的当前元素等于oldElement时才删除该键-元素对
+	// 与sync.Map一致,oldElement必须是可比较的类型
+	// 返回值表示是否完成了删除
+	CompareAndDelete(key K, oldElement V) bool
+	// GetOrLoad 获取与指定键关联的元素,若键不存在则调用loader加载并放入字典
+	// 同一时刻每个键最多只有一个loader在执行,其他调用方会等待并共享它的结果
+	// 若ctx在加载完成之前被取消,则返回ctx.Err()
+	GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context) (V, error)) (V, error)
+	// SaveSnapshot 将字典中所有未过期的键-元素对以二进制格式写入w
+	// 元素由codec编码
+	SaveSnapshot(w io.Writer, codec Codec) error
+	// LoadSnapshot 从r中读取由SaveSnapshot写入的快照,并将其中的键-元素对放入字典
+	// 元素由codec解码
+	LoadSnapshot(r io.Reader, codec Codec) error
+	// Len 返回当前字典中未过期的键-元素对的数量
+	// 若曾放入过会过期的键-元素对,则需要遍历整个字典,耗时与键-元素对的数量成正比
 	Len() uint64
 	// ForEach 迭代器
-	ForEach(fn func(key string, value interface{}))
+	// fn执行时不持有任何段锁,因此fn中可以修改当前字典
+	ForEach(fn func(key K, value V))
+	// Range 迭代当前字典的键-元素对,当fn返回false时停止迭代
+	// fn执行时不持有任何段锁,因此fn中可以修改当前字典
+	Range(fn func(key K, value V) bool)
+	// All 返回迭代所有键-元素对的迭代器
+	All() iter.Seq2[K, V]
+	// Keys 返回迭代所有键的迭代器
+	Keys() iter.Seq[K]
+	// Values 返回迭代所有元素的迭代器
+	Values() iter.Seq[V]
+	// Clear 清空当前字典
+	Clear()
+	// Resize 将并发量调整为newConcurrency,newConcurrency会被向上取整为2的幂
+	// 调整期间读写操作可以照常进行,调整完成之后Concurrency返回新的并发量
+	Resize(newConcurrency int) error
+	// Close 关闭当前字典的预写日志,并返回日志写入失败的错误(若有)
+	// 未启用预写日志时什么也不做
+	// 关闭之后字典仍然可用,但写操作不再被记录
+	Close() error
+	// Stats 返回当前字典运行状况的快照
+	Stats() Stats
+	// Hooks 返回当前字典的变更事件钩子的注册表
+	Hooks() *Hooks[K, V]
+	// Watch 观察指定键的变化
+	// 返回的通道会在ctx被取消后关闭
+	Watch(ctx context.Context, key K, opts ...WatchOption) (<-chan Event[K, V], error)
+	// WatchPrefix 观察以指定前缀开头的所有键的变化
+	// 只适用于底层类型为字符串的键或动态类型为字符串的接口类型的键
+	// 返回的通道会在ctx被取消后关闭
+	WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) (<-chan Event[K, V], error)
 }
 
 // myConcurrentMap 代表ConcurrencyMap接口的实现类型
-type myConcurrentMap struct {
-	concurrency int
-	segments    []Segment
-	total       uint64
+type myConcurrentMap[K comparable, V any] struct {
+	// table 代表当前的散列段表,调整并发量时会被替换
+	table atomic.Pointer[segmentTable[K, V]]
+	// newSegment 代表创建散列段的函数
+	// 参数index代表散列段的索引,concurrency代表其所在散列段表的并发量
+	newSegment func(index int, concurrency int, bucketNumber int) (Segment[K, V], error)
+	// resizeLock 用于串行化并发量的调整
+	resizeLock sync.Mutex
+	hasher     Hasher[K]
+	hooks      *Hooks[K, V]
+	watchers   *watchHub[K, V]
+	logger     *slog.Logger
+	clock      Clock
+	ttl        time.Duration
+	// bucketNumber 代表每个散列段初始的散列桶数量的下限
+	bucketNumber int
+	// loadFactor 代表装载因子,用于批量放入之前预先扩充散列段
+	loadFactor float64
+	// costs 代表所有散列段共用的成本记录器,为nil时代表不限制成本
+	costs *costTracker[K, V]
+	// loads 代表GetOrLoad的加载调度器
+	loads *loadGroup[K, V]
+	// refresher 代表异步刷新器,为nil时代表不刷新
+	refresher *refresher[K, V]
+	// wal 代表预写日志,为nil时代表未启用
+	wal *writeAheadLog[K, V]
+	// sortedJSONKeys 代表编码为JSON时是否按名称排序成员
+	sortedJSONKeys bool
+	// jsonValueType 代表从JSON解码元素时使用的类型,为nil时代表直接解码为元素的类型
+	jsonValueType reflect.Type
+	// janitorInterval 代表清理过期键-元素对的间隔时间
+	janitorInterval time.Duration
+	janitorOnce     sync.Once
+}
+
+// NewConcurrentMap 创建一个以字符串为键的ConcurrentMap类型的实例
+// 参数concurrency会被向上取整为2的幂
+// 参数pairRedistributor可以为nil
+func NewConcurrentMap(concurrency int, pairRedistributor PairRedistributor[string, interface{}]) (ConcurrentMap[string, interface{}], error) {
+	return NewConcurrentMapOf[string, interface{}](concurrency, pairRedistributor)
+}
+
+// NewConcurrentMapOf 创建一个指定键和元素类型的ConcurrentMap类型的实例
+// 参数concurrency会被向上取整为2的幂
+// 参数pairRedistributor可以为nil
+// 若pairRedistributor不为nil,则所有散列段会共用它
+func NewConcurrentMapOf[K comparable, V any](concurrency int, pairRedistributor PairRedistributor[K, V]) (ConcurrentMap[K, V], error) {
+	cmap, err := newConcurrentMap[K, V](concurrency, pairRedistributor)
+	if err != nil {
+		return nil, err
+	}
+	return cmap, nil
+}
+
+// New 根据给定的配置项创建一个ConcurrentMap类型的实例
+// 未设置的配置项均采用默认值
+func New[K comparable, V any](opts ...Option) (ConcurrentMap[K, V], error) {
+	cmap, err := newConcurrentMapWithOptions[K, V](opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cmap, nil
 }
 
-// NewConcurrentMap 创建一个Concurrent类型的实例
+// newConcurrentMap 创建一个myConcurrentMap类型的实例
 // 参数pairRedistributor可以为nil
-func NewConcurrentMap(concurrency int, pairRedistributor PairRedistributor) (ConcurrentMap, error) {
-	if concurrency <= 0 {
-		return nil, newIllegalParameterError("concurrency is too small")
+func newConcurrentMap[K comparable, V any](concurrency int, pairRedistributor PairRedistributor[K, V]) (*myConcurrentMap[K, V], error) {
+	opts := []Option{WithConcurrency(concurrency)}
+	if pairRedistributor != nil {
+		opts = append(opts, WithRedistributorFactory(func(float64, int, uint64) PairRedistributor[K, V] {
+			return pairRedistributor
+		}))
+	}
+	return newConcurrentMapWithOptions[K, V](opts...)
+}
+
+// newConcurrentMapWithOptions 根据给定的配置项创建一个myConcurrentMap类型的实例
+func newConcurrentMapWithOptions[K comparable, V any](opts ...Option) (*myConcurrentMap[K, V], error) {
+	o, err := newOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var factory PairRedistributorFactory[K, V]
+	if o.redistributorFactory != nil {
+		f, ok := o.redistributorFactory.(PairRedistributorFactory[K, V])
+		if !ok {
+			return nil, newIllegalParameterError(
+				fmt.Sprintf("mismatched redistributor factory type: %T", o.redistributorFactory))
+		}
+		factory = f
 	}
-	if concurrency > MAX_CONCURRENCY {
-		return nil, newIllegalParameterError("concurrency is too large")
+	hasher := newDefaultHasher[K]()
+	if o.hasher != nil {
+		h, ok := o.hasher.(Hasher[K])
+		if !ok {
+			return nil, newIllegalParameterError(fmt.Sprintf("mismatched hasher type: %T", o.hasher))
+		}
+		hasher = h
 	}
-	cmap := &myConcurrentMap{}
-	cmap.concurrency = concurrency
-	cmap.segments = make([]Segment, concurrency)
-	for i := 0; i < concurrency; i++ {
-		cmap.segments[i] = newSegment(DEFAULT_BUCKET_NUMBER, pairRedistributor)
+	policyFactory := EvictionPolicyFactory[K](NewLRUPolicy[K])
+	if o.evictionPolicyFactory != nil {
+		f, ok := o.evictionPolicyFactory.(EvictionPolicyFactory[K])
+		if !ok {
+			return nil, newIllegalParameterError(
+				fmt.Sprintf("mismatched eviction policy factory type: %T", o.evictionPolicyFactory))
+		}
+		policyFactory = f
+	}
+	var onEvict func(key K, element V)
+	if o.evictionCallback != nil {
+		fn, ok := o.evictionCallback.(func(key K, element V))
+		if !ok {
+			return nil, newIllegalParameterError(
+				fmt.Sprintf("mismatched eviction callback type: %T", o.evictionCallback))
+		}
+		onEvict = fn
+	}
+	var cost func(key K, element V) int64
+	if o.cost != nil {
+		fn, ok := o.cost.(func(key K, element V) int64)
+		if !ok {
+			return nil, newIllegalParameterError(fmt.Sprintf("mismatched cost function type: %T", o.cost))
+		}
+		cost = fn
+	}
+	var refreshLoader func(ctx context.Context, key K, oldElement V) (V, error)
+	if o.refreshLoader != nil {
+		fn, ok := o.refreshLoader.(func(ctx context.Context, key K, oldElement V) (V, error))
+		if !ok {
+			return nil, newIllegalParameterError(
+				fmt.Sprintf("mismatched refresh loader type: %T", o.refreshLoader))
+		}
+		refreshLoader = fn
+	}
+	if o.refreshAfter > 0 && refreshLoader == nil {
+		return nil, newIllegalParameterError("refresh loader is required")
+	}
+	var onRefreshFailure func(key K, err error)
+	if o.refreshFailureCallback != nil {
+		fn, ok := o.refreshFailureCallback.(func(key K, err error))
+		if !ok {
+			return nil, newIllegalParameterError(
+				fmt.Sprintf("mismatched refresh failure callback type: %T", o.refreshFailureCallback))
+		}
+		onRefreshFailure = fn
+	}
+	if o.jsonValueType != nil && !o.jsonValueType.AssignableTo(reflect.TypeFor[V]()) {
+		return nil, newIllegalParameterError(fmt.Sprintf("mismatched json value type: %s", o.jsonValueType))
+	}
+	cmap := &myConcurrentMap[K, V]{}
+	cmap.hasher = hasher
+	cmap.logger = o.logger
+	cmap.bucketNumber = o.bucketNumber
+	cmap.loadFactor = o.loadFactor
+	cmap.clock = o.clock
+	cmap.ttl = o.ttl
+	cmap.janitorInterval = o.janitorInterval
+	cmap.sortedJSONKeys = o.sortedJSONKeys
+	cmap.jsonValueType = o.jsonValueType
+	if o.maxCost > 0 {
+		cmap.costs = newCostTracker(o.maxCost, cost, o.costOverflowAction)
+	}
+	cmap.loads = newLoadGroup[K, V](o.negativeCacheTTL)
+	if o.refreshAfter > 0 {
+		cmap.refresher = newRefresher(o.refreshAfter, refreshLoader, o.refreshConcurrency, onRefreshFailure, o.logger)
+	}
+	if o.wal != nil {
+		// 重放日志之前预写日志尚未激活,重放引起的写操作不会被再次记录
+		cmap.wal = newWriteAheadLog(o.wal, o.logger, cmap.forEachPair)
+	}
+	cmap.hooks = &Hooks[K, V]{}
+	cmap.watchers = newWatchHub(cmap.hooks)
+	cmap.newSegment = func(index int, concurrency int, bucketNumber int) (Segment[K, V], error) {
+		segmentLogger := o.logger.With(slog.Int("segment", index))
+		var pairRedistributor PairRedistributor[K, V]
+		if factory != nil {
+			pairRedistributor = factory(o.loadFactor, bucketNumber, o.maxBucketSize)
+		} else {
+			pairRedistributor = newLoggingPairRedistributor[K, V](o.loadFactor, bucketNumber, o.maxBucketSize, segmentLogger)
+		}
+		config := &segmentConfig[K, V]{
+			index:    index,
+			hasher:   hasher,
+			logger:   segmentLogger,
+			hooks:    cmap.hooks,
+			clock:    cmap.clock,
+			ttl:      cmap.ttl,
+			costs:    cmap.costs,
+			stamping: cmap.refresher != nil,
+		}
+		if cmap.wal != nil {
+			config.journal = cmap.wal
+		}
+		capacity := o.segmentCapacity(index, concurrency)
+		if capacity > 0 || cmap.costs != nil {
+			// 只限制成本时,淘汰策略的容量仅作为预分配的参考
+			policyCapacity := capacity
+			if policyCapacity == 0 {
+				policyCapacity = DEFAULT_POLICY_CAPACITY
+			}
+			config.policy = policyFactory(policyCapacity)
+			if config.policy == nil {
+				return nil, newIllegalParameterError("eviction policy is nil")
+			}
+			config.capacity = uint64(capacity)
+			config.onEvict = onEvict
+		}
+		return newSegment[K, V](bucketNumber, pairRedistributor, config), nil
+	}
+	table, err := cmap.newSegmentTable(o.concurrency, o.segmentBucketNumber())
+	if err != nil {
+		return nil, err
+	}
+	cmap.table.Store(table)
+	if cmap.ttl > 0 {
+		cmap.startJanitor()
+	}
+	if cmap.wal != nil {
+		err := cmap.wal.open(func(recordType walRecordType, payload []byte) error {
+			return cmap.replayWAL(o.wal.codec, recordType, payload)
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 	return cmap, nil
 }
 
 // Concurrency 返回并发量
-func (cmap *myConcurrentMap) Concurrency() int {
-	return cmap.concurrency
+// 调整并发量的过程中返回调整之前的并发量
+func (cmap *myConcurrentMap[K, V]) Concurrency() int {
+	return len(cmap.table.Load().segments)
 }
 
 // Put  推送一个键-元素对
 // 注意!参数element的值不能为nil
 // 第一个返回值表示是否新增了键-元素对
 // 若键已存在,新元素会替换旧的元素值
-func (cmap *myConcurrentMap) Put(key string, element interface{}) (bool, error) {
-	p, err := newPair(key, element)
+func (cmap *myConcurrentMap[K, V]) Put(key K, element V) (bool, error) {
+	return cmap.put(key, element, cmap.ttl)
+}
+
+// put 推送一个在ttl之后过期的键-元素对
+// 若参数ttl不大于0,则键-元素对永不过期
+func (cmap *myConcurrentMap[K, V]) put(key K, element V, ttl time.Duration) (bool, error) {
+	p, err := newPair(key, cmap.hasher.Hash(key), element)
 	if err != nil {
 		return false, err
 	}
-	s := cmap.findSegment(p.Hash())
-	ok, err := s.Put(p)
-	if ok {
-		atomic.AddUint64(&cmap.total, 1)
+	if expiry := expiryAfter(cmap.clock, ttl); expiry != 0 {
+		p.SetExpiry(expiry)
+		p.SetTTL(ttl)
+		cmap.startJanitor()
 	}
-	return ok, err
+	s, gate := cmap.enterSegment(p.Hash())
+	defer gate.RUnlock()
+	return s.Put(p)
 }
 
 // Get 获取与指定关联的那个元素
-// 若返回nil, 则说明指定的键不存在
-func (cmap *myConcurrentMap) Get(key string) interface{} {
-	keyHash := hash(key)
-	s := cmap.findSegment(keyHash)
+// 若返回V的零值(对于接口类型即nil), 则说明指定的键不存在
+func (cmap *myConcurrentMap[K, V]) Get(key K) V {
+	element, _ := cmap.get(key)
+	return element
+}
+
+// get 获取与指定关联的那个元素
+// 第二个返回值表示指定的键是否存在
+func (cmap *myConcurrentMap[K, V]) get(key K) (V, bool) {
+	keyHash := cmap.hasher.Hash(key)
+	s, gate := cmap.enterSegment(keyHash)
 	pair := s.GetWithHash(key, keyHash)
+	gate.RUnlock()
 	if pair == nil {
-		return nil
+		var zero V
+		return zero, false
+	}
+	if cmap.refresher != nil {
+		cmap.maybeRefresh(pair)
 	}
-	return pair.Element()
+	return pair.Element(), true
 }
 
 // Delete 删除指定的键-元素对
 // 若结果值为true则说明键已存在且已删除,否则说明键不存在
-func (cmap *myConcurrentMap) Delete(key string) bool {
-	s := cmap.findSegment(hash(key))
-	if s.Delete(key) {
-		atomic.AddUint64(&cmap.total, ^uint64(0))
-		return true
+func (cmap *myConcurrentMap[K, V]) Delete(key K) bool {
+	s, gate := cmap.enterSegment(cmap.hasher.Hash(key))
+	defer gate.RUnlock()
+	return s.Delete(key)
+}
+
+// PutIfAbsent 仅当指定的键不存在时才放入键-元素对
+// 注意!参数element的值不能为nil
+// 第一个返回值表示是否新增了键-元素对
+func (cmap *myConcurrentMap[K, V]) PutIfAbsent(key K, element V) (bool, error) {
+	if isNil(element) {
+		return false, newIllegalParameterError("element is nil")
+	}
+	var added bool
+	_, _, err := cmap.compute(key, func(oldElement V, exists bool) (V, ComputeOperation) {
+		if exists {
+			return oldElement, COMPUTE_NONE
+		}
+		added = true
+		return element, COMPUTE_STORE
+	})
+	return added && err == nil, err
+}
+
+// Compute 原子地根据旧元素计算指定键的新元素
+// fn的参数为旧元素及键是否存在,返回新元素及是否保留该键
+// 若keep为false,则删除已存在的键-元素对
+// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+func (cmap *myConcurrentMap[K, V]) Compute(key K,
+	fn func(oldElement V, exists bool) (newElement V, keep bool)) (V, bool, error) {
+	if fn == nil {
+		var zero V
+		return zero, false, newIllegalParameterError("compute function is nil")
+	}
+	return cmap.compute(key, func(oldElement V, exists bool) (V, ComputeOperation) {
+		newElement, keep := fn(oldElement, exists)
+		if !keep {
+			return newElement, COMPUTE_DELETE
+		}
+		return newElement, COMPUTE_STORE
+	})
+}
+
+// ComputeIfAbsent 仅当指定的键不存在时原子地计算并放入新元素
+// 若keep为false,则不放入任何元素
+// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+func (cmap *myConcurrentMap[K, V]) ComputeIfAbsent(key K, fn func() (element V, keep bool)) (V, bool, error) {
+	if fn == nil {
+		var zero V
+		return zero, false, newIllegalParameterError("compute function is nil")
+	}
+	return cmap.compute(key, func(oldElement V, exists bool) (V, ComputeOperation) {
+		if exists {
+			return oldElement, COMPUTE_NONE
+		}
+		element, keep := fn()
+		if !keep {
+			return element, COMPUTE_NONE
+		}
+		return element, COMPUTE_STORE
+	})
+}
+
+// ComputeIfPresent 仅当指定的键存在时原子地根据旧元素计算新元素
+// 若keep为false,则删除该键-元素对
+// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+func (cmap *myConcurrentMap[K, V]) ComputeIfPresent(key K,
+	fn func(oldElement V) (newElement V, keep bool)) (V, bool, error) {
+	if fn == nil {
+		var zero V
+		return zero, false, newIllegalParameterError("compute function is nil")
+	}
+	return cmap.compute(key, func(oldElement V, exists bool) (V, ComputeOperation) {
+		if !exists {
+			return oldElement, COMPUTE_NONE
+		}
+		newElement, keep := fn(oldElement)
+		if !keep {
+			return newElement, COMPUTE_DELETE
+		}
+		return newElement, COMPUTE_STORE
+	})
+}
+
+// Merge 若指定的键不存在则放入element,否则原子地合并旧元素与element
+// 若keep为false,则删除该键-元素对
+// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+func (cmap *myConcurrentMap[K, V]) Merge(key K, element V,
+	fn func(oldElement, element V) (newElement V, keep bool)) (V, bool, error) {
+	var zero V
+	if isNil(element) {
+		return zero, false, newIllegalParameterError("element is nil")
+	}
+	if fn == nil {
+		return zero, false, newIllegalParameterError("merge function is nil")
+	}
+	return cmap.compute(key, func(oldElement V, exists bool) (V, ComputeOperation) {
+		if !exists {
+			return element, COMPUTE_STORE
+		}
+		newElement, keep := fn(oldElement, element)
+		if !keep {
+			return newElement, COMPUTE_DELETE
+		}
+		return newElement, COMPUTE_STORE
+	})
+}
+
+// CompareAndSwap 仅当指定键的当前元素等于oldElement时才将其替换为newElement
+// 与sync.Map一致,oldElement必须是可比较的类型
+// 若新元素为nil,则不做交换并返回false
+// 返回值表示是否完成了交换
+func (cmap *myConcurrentMap[K, V]) CompareAndSwap(key K, oldElement, newElement V) bool {
+	if isNil(newElement) {
+		return false
 	}
-	return false
+	var swapped bool
+	_, _, _ = cmap.compute(key, func(element V, exists bool) (V, ComputeOperation) {
+		if !exists || !equalElement(element, oldElement) {
+			return element, COMPUTE_NONE
+		}
+		swapped = true
+		return newElement, COMPUTE_STORE
+	})
+	return swapped
+}
+
+// CompareAndDelete 仅当指定键的当前元素等于oldElement时才删除该键-元素对
+// 与sync.Map一致,oldElement必须是可比较的类型
+// 返回值表示是否完成了删除
+func (cmap *myConcurrentMap[K, V]) CompareAndDelete(key K, oldElement V) bool {
+	var deleted bool
+	_, _, _ = cmap.compute(key, func(element V, exists bool) (V, ComputeOperation) {
+		if !exists || !equalElement(element, oldElement) {
+			return element, COMPUTE_NONE
+		}
+		deleted = true
+		return element, COMPUTE_DELETE
+	})
+	return deleted
+}
+
+// compute 在对应散列段中原子地执行fn
+func (cmap *myConcurrentMap[K, V]) compute(key K,
+	fn func(oldElement V, exists bool) (V, ComputeOperation)) (V, bool, error) {
+	keyHash := cmap.hasher.Hash(key)
+	s, gate := cmap.enterSegment(keyHash)
+	defer gate.RUnlock()
+	return s.Compute(key, keyHash, fn)
+}
+
+// Len 返回当前字典中未过期的键-元素对的数量
+// 各散列段的数量是依次获取的,因此在并发修改时结果只是近似值
+// 若曾放入过会过期的键-元素对,则需要遍历整个字典,只需估计数量时应使用size
+func (cmap *myConcurrentMap[K, V]) Len() uint64 {
+	var total uint64
+	cmap.eachSegment(func(s Segment[K, V]) {
+		total += s.Len()
+	})
+	return total
 }
 
-// Len 返回当前字典中键-元素对的数量
-func (cmap *myConcurrentMap) Len() uint64 {
-	return atomic.LoadUint64(&cmap.total)
+// size 返回当前字典中键-元素对的数量,其中包括已过期但尚未被清除的
+// 它只读取各散列段的计数,不必遍历字典,适用于只需要估计数量的场合
+func (cmap *myConcurrentMap[K, V]) size() uint64 {
+	var total uint64
+	cmap.eachSegment(func(s Segment[K, V]) {
+		total += s.Size()
+	})
+	return total
 }
 
 // ForEach 迭代器
-func (cmap *myConcurrentMap) ForEach(fn func(key string, value interface{})) {
+func (cmap *myConcurrentMap[K, V]) ForEach(fn func(key K, value V)) {
 	if fn != nil {
-		for i := 0; i < int(cmap.Concurrency()); i++ {
-			cmap.segments[i].ForEach(fn)
+		cmap.Range(func(key K, value V) bool {
+			fn(key, value)
+			return true
+		})
+	}
+}
+
+// Range 迭代当前字典的键-元素对,当fn返回false时停止迭代
+func (cmap *myConcurrentMap[K, V]) Range(fn func(key K, value V) bool) {
+	if fn == nil {
+		return
+	}
+	t := cmap.table.Load()
+	for i := range t.segments {
+		for _, p := range cmap.segmentPairs(t, i) {
+			if !fn(p.Key(), p.Element()) {
+				return
+			}
 		}
 	}
 }
 
-// findSegment 根据给定参数寻找并返回对应散列字段
-func (cmap *myConcurrentMap) findSegment(keyHash uint64) Segment {
-	if cmap.concurrency == 1 {
-		return cmap.segments[0]
+// All 返回迭代所有键-元素对的迭代器
+func (cmap *myConcurrentMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		cmap.Range(yield)
 	}
-	var keyHash32 uint32
-	if keyHash > math.MaxUint32 {
-		keyHash32 = uint32(keyHash32 >> 32)
-	} else {
-		keyHash32 = uint32(keyHash32)
+}
+
+// Keys 返回迭代所有键的迭代器
+func (cmap *myConcurrentMap[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		cmap.Range(func(key K, _ V) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Values 返回迭代所有元素的迭代器
+func (cmap *myConcurrentMap[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		cmap.Range(func(_ K, value V) bool {
+			return yield(value)
+		})
+	}
+}
+
+// Clear 清空当前字典
+func (cmap *myConcurrentMap[K, V]) Clear() {
+	cmap.eachSegment(func(s Segment[K, V]) {
+		s.Clear()
+	})
+	cmap.loads.clearNegatives()
+}
+
+// Hooks 返回当前字典的变更事件钩子的注册表
+func (cmap *myConcurrentMap[K, V]) Hooks() *Hooks[K, V] {
+	return cmap.hooks
+}
+
+// segmentIndex 根据给定的哈希值计算对应散列段在当前散列段表中的索引
+func (cmap *myConcurrentMap[K, V]) segmentIndex(keyHash uint64) int {
+	return cmap.table.Load().index(keyHash)
+}
+
+// forEachPair 逐个散列段地遍历字典中所有未过期的键-元素对
+// 迁移期间每个键也恰好被遍历一次,fn执行时不持有任何锁
+// 若fn返回错误,则停止遍历并返回该错误
+func (cmap *myConcurrentMap[K, V]) forEachPair(fn func(p Pair[K, V]) error) error {
+	t := cmap.table.Load()
+	for i := range t.segments {
+		for _, p := range cmap.segmentPairs(t, i) {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
 	}
-	return cmap.segments[int(keyHash32>>16)%(cmap.concurrency-1)]
+	return nil
 }
@@ -2,12 +2,14 @@ package cmap
 
 import (
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCmapNew(t *testing.T) {
 	var concurrency int
-	var pairRedistributor PairRedistributor
+	var pairRedistributor PairRedistributor[string, interface{}]
 	cm, err := NewConcurrentMap(concurrency, pairRedistributor)
 	if err == nil {
 		t.Fatalf("No error when new a concurrent map with concurrency %d, but should not be the case!",
@@ -35,11 +37,97 @@ func TestCmapNew(t *testing.T) {
 	}
 }
 
+func TestCmapGeneric(t *testing.T) {
+	number := 1000
+	cm, err := NewConcurrentMapOf[int, string](8, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when new a generic concurrent map: %s", err)
+	}
+	for i := 0; i < number; i++ {
+		ok, err := cm.Put(i, fmt.Sprintf("v%d", i))
+		if err != nil {
+			t.Fatalf("An error occurs when putting a key-element to the cmap: %s (key: %d)", err, i)
+		}
+		if !ok {
+			t.Fatalf("Couldn't put key-element to the cmap! (key: %d)", i)
+		}
+	}
+	if cm.Len() != uint64(number) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, cm.Len())
+	}
+	for i := 0; i < number; i++ {
+		expected := fmt.Sprintf("v%d", i)
+		if actual := cm.Get(i); actual != expected {
+			t.Fatalf("Inconsistent element: expected: %q, actual: %q", expected, actual)
+		}
+	}
+	if actual := cm.Get(number); actual != "" {
+		t.Fatalf("Inconsistent element: expected: %q, actual: %q", "", actual)
+	}
+	if !cm.Delete(0) {
+		t.Fatalf("Couldn't delete a key-element from cmap! (key: %d)", 0)
+	}
+	if cm.Len() != uint64(number-1) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number-1, cm.Len())
+	}
+}
+
+func TestCmapConcurrencyPowerOfTwo(t *testing.T) {
+	testCases := map[int]int{1: 1, 2: 2, 3: 4, 10: 16, 16: 16, 17: 32, MAX_CONCURRENCY - 1: MAX_CONCURRENCY}
+	for concurrency, expected := range testCases {
+		cm, err := NewConcurrentMap(concurrency, nil)
+		if err != nil {
+			t.Fatalf("An error occurs when new a concurrent map: %s (concurrency: %d)", err, concurrency)
+		}
+		if cm.Concurrency() != expected {
+			t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d", expected, cm.Concurrency())
+		}
+	}
+}
+
+func TestCmapSegmentDistribution(t *testing.T) {
+	keysPerSegment := 2000
+	for _, concurrency := range []int{2, 16, 64} {
+		t.Run(fmt.Sprintf("Concurrency=%d/string", concurrency), func(t *testing.T) {
+			cm, _ := newConcurrentMap[string, int](concurrency, nil)
+			for i := 0; i < concurrency*keysPerSegment; i++ {
+				_, _ = cm.Put(fmt.Sprintf("key%d", i), i)
+			}
+			checkSegmentDistribution(t, cm.table.Load().segments, keysPerSegment)
+		})
+		t.Run(fmt.Sprintf("Concurrency=%d/int", concurrency), func(t *testing.T) {
+			cm, _ := newConcurrentMap[int, int](concurrency, nil)
+			for i := 0; i < concurrency*keysPerSegment; i++ {
+				_, _ = cm.Put(i, i)
+			}
+			checkSegmentDistribution(t, cm.table.Load().segments, keysPerSegment)
+		})
+	}
+}
+
+// checkSegmentDistribution 检查键-元素对是否均匀地分布在各散列段及其散列桶中
+func checkSegmentDistribution[K comparable, V any](t *testing.T, segments []Segment[K, V], expected int) {
+	t.Helper()
+	lower, upper := uint64(float64(expected)*0.85), uint64(float64(expected)*1.15)
+	for i, s := range segments {
+		size := s.Size()
+		if size < lower || size > upper {
+			t.Fatalf("Uneven segment size: expected: [%d, %d], actual: %d (segment: %d)", lower, upper, size, i)
+		}
+		seg := s.(*segment[K, V])
+		for j, b := range seg.buckets {
+			if b.Size() == 0 {
+				t.Fatalf("Empty bucket in a segment with %d pairs! (segment: %d, bucket: %d)", size, i, j)
+			}
+		}
+	}
+}
+
 func TestCmapPut(t *testing.T) {
 	number := 30
 	testCases := genTestingPairs(number)
 	concurrency := 10
-	var pairRedistributor PairRedistributor
+	var pairRedistributor PairRedistributor[string, interface{}]
 	cm, _ := NewConcurrentMap(concurrency, pairRedistributor)
 	var count uint64
 	for _, p := range testCases {
@@ -212,6 +300,142 @@ func TestForEach(t *testing.T) {
 	}
 }
 
+func TestCmapRange(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(number/2, nil)
+	expected := make(map[string]interface{}, number)
+	for _, p := range testCases {
+		_, _ = cm.Put(p.Key(), p.Element())
+		expected[p.Key()] = p.Element()
+	}
+	actual := make(map[string]interface{}, number)
+	cm.Range(func(key string, value interface{}) bool {
+		actual[key] = value
+		return true
+	})
+	if len(actual) != number {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", number, len(actual))
+	}
+	for key, element := range expected {
+		if actual[key] != element {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)", element, actual[key], key)
+		}
+	}
+	var count int
+	cm.Range(func(key string, value interface{}) bool {
+		count++
+		return count < 5
+	})
+	if count != 5 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", 5, count)
+	}
+}
+
+func TestCmapIterators(t *testing.T) {
+	number := 30
+	cm, _ := NewConcurrentMapOf[int, int](4, nil)
+	for i := 0; i < number; i++ {
+		_, _ = cm.Put(i, i*i)
+	}
+	var count int
+	for key, value := range cm.All() {
+		if value != key*key {
+			t.Fatalf("Inconsistent element: expected: %d, actual: %d (key: %d)", key*key, value, key)
+		}
+		count++
+	}
+	if count != number {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", number, count)
+	}
+	keySum, valueSum := 0, 0
+	for key := range cm.Keys() {
+		keySum += key
+	}
+	for value := range cm.Values() {
+		valueSum += value
+	}
+	if expected := number * (number - 1) / 2; keySum != expected {
+		t.Fatalf("Inconsistent key sum: expected: %d, actual: %d", expected, keySum)
+	}
+	if expected := (number - 1) * number * (2*number - 1) / 6; valueSum != expected {
+		t.Fatalf("Inconsistent element sum: expected: %d, actual: %d", expected, valueSum)
+	}
+	count = 0
+	for range cm.All() {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	if count != 3 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", 3, count)
+	}
+}
+
+func TestCmapMutateInRange(t *testing.T) {
+	number := 300
+	cm, _ := NewConcurrentMapOf[int, int](4, nil)
+	for i := 0; i < number; i++ {
+		_, _ = cm.Put(i, i)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cm.Range(func(key int, value int) bool {
+			if key%2 == 0 {
+				cm.Delete(key)
+			} else {
+				_, _ = cm.Put(key, value*10)
+			}
+			return true
+		})
+		cm.ForEach(func(key int, value int) {
+			if key < number {
+				_, _ = cm.Put(key+number, value)
+			}
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Deadlock when mutating the cmap in range!")
+	}
+	if cm.Len() != uint64(number) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, cm.Len())
+	}
+	for i := 1; i < number; i += 2 {
+		if actual := cm.Get(i); actual != i*10 {
+			t.Fatalf("Inconsistent element: expected: %d, actual: %d (key: %d)", i*10, actual, i)
+		}
+	}
+}
+
+func TestCmapPanicInRange(t *testing.T) {
+	cm, _ := NewConcurrentMapOf[int, int](1, nil)
+	_, _ = cm.Put(1, 1)
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Fatal("No panic in range, but should not be the case!")
+			}
+		}()
+		cm.Range(func(key int, value int) bool {
+			panic("panic in range")
+		})
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = cm.Put(2, 2)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("The segment is still locked after a panic in range!")
+	}
+}
+
 func TestCmapDelete(t *testing.T) {
 	number := 30
 	testCases := genTestingPairs(number)
@@ -291,6 +515,200 @@ func TestCmapDeleteInParallel(t *testing.T) {
 	}
 }
 
+func TestCmapPutIfAbsent(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(number/2, nil)
+	for _, p := range testCases {
+		ok, err := cm.PutIfAbsent(p.Key(), p.Element())
+		if err != nil {
+			t.Fatalf("An error occurs when putting a key-element to the cmap: %s (key: %s, element: %#v)",
+				err, p.Key(), p.Element())
+		}
+		if !ok {
+			t.Fatalf("Couldn't put key-element to the cmap! (key: %s, element: %#v)",
+				p.Key(), p.Element())
+		}
+		ok, err = cm.PutIfAbsent(p.Key(), randString())
+		if err != nil {
+			t.Fatalf("An error occurs when putting a repeated key-element to the cmap! %s (key: %s)",
+				err, p.Key())
+		}
+		if ok {
+			t.Fatalf("Put a repeated key-element to the cmap! (key: %s)", p.Key())
+		}
+		if actualElement := cm.Get(p.Key()); actualElement != p.Element() {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v",
+				p.Element(), actualElement)
+		}
+	}
+	if cm.Len() != uint64(number) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, cm.Len())
+	}
+	if _, err := cm.PutIfAbsent("nil", nil); err == nil {
+		t.Fatal("No error when putting a nil element to the cmap, but should not be the case!")
+	}
+}
+
+func TestCmapComputeInParallel(t *testing.T) {
+	keyNumber := 10
+	goroutineNumber := 50
+	increments := 200
+	cm, _ := NewConcurrentMapOf[int, int](4, nil)
+	var wg sync.WaitGroup
+	wg.Add(goroutineNumber)
+	for i := 0; i < goroutineNumber; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				_, _, err := cm.Compute(j%keyNumber, func(oldElement int, exists bool) (int, bool) {
+					return oldElement + 1, true
+				})
+				if err != nil {
+					t.Errorf("An error occurs when computing an element: %s", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if cm.Len() != uint64(keyNumber) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", keyNumber, cm.Len())
+	}
+	expected := goroutineNumber * increments / keyNumber
+	for i := 0; i < keyNumber; i++ {
+		if actual := cm.Get(i); actual != expected {
+			t.Fatalf("Inconsistent element: expected: %d, actual: %d (key: %d)", expected, actual, i)
+		}
+	}
+	element, ok, err := cm.Compute(0, func(oldElement int, exists bool) (int, bool) {
+		return 0, false
+	})
+	if err != nil || ok || element != 0 {
+		t.Fatalf("Couldn't delete a key-element by compute! (element: %d, ok: %v, err: %v)", element, ok, err)
+	}
+	if cm.Len() != uint64(keyNumber-1) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", keyNumber-1, cm.Len())
+	}
+}
+
+func TestCmapComputeIfAbsentAndPresent(t *testing.T) {
+	cm, _ := NewConcurrentMapOf[string, int](4, nil)
+	element, ok, err := cm.ComputeIfPresent("a", func(oldElement int) (int, bool) {
+		t.Fatal("The compute function is called for an absent key!")
+		return 0, true
+	})
+	if err != nil || ok || element != 0 {
+		t.Fatalf("Inconsistent result: element: %d, ok: %v, err: %v", element, ok, err)
+	}
+	element, ok, err = cm.ComputeIfAbsent("a", func() (int, bool) {
+		return 1, false
+	})
+	if err != nil || ok || cm.Len() != 0 {
+		t.Fatalf("Inconsistent result: element: %d, ok: %v, err: %v, len: %d", element, ok, err, cm.Len())
+	}
+	element, ok, err = cm.ComputeIfAbsent("a", func() (int, bool) {
+		return 1, true
+	})
+	if err != nil || !ok || element != 1 || cm.Len() != 1 {
+		t.Fatalf("Inconsistent result: element: %d, ok: %v, err: %v, len: %d", element, ok, err, cm.Len())
+	}
+	element, ok, err = cm.ComputeIfAbsent("a", func() (int, bool) {
+		t.Fatal("The compute function is called for a present key!")
+		return 2, true
+	})
+	if err != nil || !ok || element != 1 {
+		t.Fatalf("Inconsistent result: element: %d, ok: %v, err: %v", element, ok, err)
+	}
+	element, ok, err = cm.ComputeIfPresent("a", func(oldElement int) (int, bool) {
+		return oldElement * 10, true
+	})
+	if err != nil || !ok || element != 10 || cm.Get("a") != 10 {
+		t.Fatalf("Inconsistent result: element: %d, ok: %v, err: %v", element, ok, err)
+	}
+	_, ok, err = cm.ComputeIfPresent("a", func(oldElement int) (int, bool) {
+		return 0, false
+	})
+	if err != nil || ok || cm.Len() != 0 {
+		t.Fatalf("Inconsistent result: ok: %v, err: %v, len: %d", ok, err, cm.Len())
+	}
+}
+
+func TestCmapMerge(t *testing.T) {
+	cm, _ := NewConcurrentMapOf[string, []string](4, nil)
+	appendFunc := func(oldElement, element []string) ([]string, bool) {
+		return append(oldElement, element...), true
+	}
+	for _, word := range []string{"a", "b", "c"} {
+		if _, _, err := cm.Merge("words", []string{word}, appendFunc); err != nil {
+			t.Fatalf("An error occurs when merging an element: %s", err)
+		}
+	}
+	if actual := fmt.Sprint(cm.Get("words")); actual != "[a b c]" {
+		t.Fatalf("Inconsistent element: expected: %s, actual: %s", "[a b c]", actual)
+	}
+	_, ok, err := cm.Merge("words", nil, func(oldElement, element []string) ([]string, bool) {
+		return nil, false
+	})
+	if err != nil || ok || cm.Len() != 0 {
+		t.Fatalf("Inconsistent result: ok: %v, err: %v, len: %d", ok, err, cm.Len())
+	}
+}
+
+func TestCmapCompareAndSwap(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	if cm.CompareAndSwap("state", "init", "running") {
+		t.Fatal("Swapped an absent key, but should not be the case!")
+	}
+	_, _ = cm.Put("state", "init")
+	if cm.CompareAndSwap("state", "stopped", "running") {
+		t.Fatal("Swapped with a mismatched old element, but should not be the case!")
+	}
+	if !cm.CompareAndSwap("state", "init", "running") {
+		t.Fatal("Couldn't swap with a matched old element!")
+	}
+	if actual := cm.Get("state"); actual != "running" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "running", actual)
+	}
+	if cm.CompareAndSwap("state", "running", nil) {
+		t.Fatal("Swapped to a nil element, but should not be the case!")
+	}
+	if cm.CompareAndDelete("state", "init") {
+		t.Fatal("Deleted with a mismatched old element, but should not be the case!")
+	}
+	if !cm.CompareAndDelete("state", "running") {
+		t.Fatal("Couldn't delete with a matched old element!")
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 0, cm.Len())
+	}
+}
+
+func TestCmapCompareAndSwapInParallel(t *testing.T) {
+	goroutineNumber := 20
+	increments := 500
+	cm, _ := NewConcurrentMapOf[string, int](4, nil)
+	_, _ = cm.Put("counter", 0)
+	var wg sync.WaitGroup
+	wg.Add(goroutineNumber)
+	for i := 0; i < goroutineNumber; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; {
+				old := cm.Get("counter")
+				if cm.CompareAndSwap("counter", old, old+1) {
+					j++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	expected := goroutineNumber * increments
+	if actual := cm.Get("counter"); actual != expected {
+		t.Fatalf("Inconsistent element: expected: %d, actual: %d", expected, actual)
+	}
+}
+
 var testCaseNumberForCmapTest = 200000
 var testCasesForCmapTest = genNoRepetitiveTestingPairs(testCaseNumberForCmapTest)
 var testCases1ForCmapTest = testCasesForCmapTest[:testCaseNumberForCmapTest/2]
@@ -0,0 +1,214 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec 代表元素的编解码器的接口
+// 快照和预写日志等需要持久化字典内容的功能都通过它将元素转换为字节序列
+// 本包提供了GobCodec、JSONCodec和RawCodec三种实现
+// 其实现必须是并发安全的
+type Codec interface {
+	// Encode 将给定的值编码为字节序列
+	Encode(v any) ([]byte, error)
+	// Decode 将字节序列解码为值
+	Decode(data []byte) (any, error)
+}
+
+// typedDecoder 代表能够直接解码为指定类型的编解码器的接口
+// 若Codec实现了此接口,则解码键和元素时优先使用它,以免经由any转换时丢失类型信息
+type typedDecoder interface {
+	// decodeType 将字节序列解码为类型t的值
+	decodeType(data []byte, t reflect.Type) (any, error)
+}
+
+// GobCodec 代表基于encoding/gob的Codec的实现类型
+// 它以接口值的形式编码,因此解码结果的动态类型与编码前相同
+// 注意!除基本类型之外,自定义的类型必须先通过RegisterGobType注册
+type GobCodec struct{}
+
+// Encode 将给定的值编码为字节序列
+func (GobCodec) Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode 将字节序列解码为值
+func (GobCodec) Decode(data []byte) (any, error) {
+	var v any
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// RegisterGobType 向GobCodec注册一个具体类型,参数value为该类型的任意值
+// 同一类型可以重复注册,但不同的类型不能使用相同的名称
+func RegisterGobType(value any) (err error) {
+	if value == nil {
+		return newIllegalParameterError("gob type is nil")
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = newIllegalParameterError(fmt.Sprintf("cannot register gob type %T: %v", value, p))
+		}
+	}()
+	gob.Register(value)
+	return nil
+}
+
+// JSONCodec 代表基于encoding/json的Codec的实现类型
+// 解码键和元素时会直接解码为其类型,因此结构体及大整数均可以无损地往返
+// 当元素类型为接口类型时,解码结果遵循encoding/json的规则,例如数值会被解码为float64
+type JSONCodec struct{}
+
+// Encode 将给定的值编码为字节序列
+func (JSONCodec) Encode(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode 将字节序列解码为值
+func (JSONCodec) Decode(data []byte) (any, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeType 将字节序列解码为类型t的值
+func (JSONCodec) decodeType(data []byte, t reflect.Type) (any, error) {
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// RawCodec 代表原样传递字节切片的Codec的实现类型
+// 它只能编码[]byte类型的值,适用于元素本身已是序列化结果的字典
+type RawCodec struct{}
+
+// Encode 原样返回给定的字节切片
+func (RawCodec) Encode(v any) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, newIllegalParameterError(fmt.Sprintf("raw codec cannot encode %T", v))
+	}
+	return data, nil
+}
+
+// Decode 原样返回给定的字节序列
+// 调用方在解码之后不应再修改data
+func (RawCodec) Decode(data []byte) (any, error) {
+	return data, nil
+}
+
+// encodeKey 将键编码为字节序列
+// 字符串、整数和布尔类型的键采用固定的紧凑编码,其他类型的键由codec编码
+func encodeKey[K comparable](key K, codec Codec) ([]byte, error) {
+	v := reflect.ValueOf(&key).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(nil, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(nil, v.Uint()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	}
+	return codec.Encode(key)
+}
+
+// decodeKey 将字节序列解码为键,它是encodeKey的逆操作
+func decodeKey[K comparable](data []byte, codec Codec) (K, error) {
+	var key K
+	v := reflect.ValueOf(&key).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(data))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, n := binary.Varint(data)
+		if n <= 0 || n != len(data) || v.OverflowInt(x) {
+			return key, newDecodedTypeError(data, v.Type())
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, n := binary.Uvarint(data)
+		if n <= 0 || n != len(data) || v.OverflowUint(x) {
+			return key, newDecodedTypeError(data, v.Type())
+		}
+		v.SetUint(x)
+	case reflect.Bool:
+		if len(data) != 1 || data[0] > 1 {
+			return key, newDecodedTypeError(data, v.Type())
+		}
+		v.SetBool(data[0] == 1)
+	default:
+		return decodeAs[K](data, codec)
+	}
+	return key, nil
+}
+
+// decodeAs 用codec解码字节序列并将结果转换为类型T
+// 若codec能够直接解码为指定类型,则直接解码为T
+// 否则在解码结果与T的底层类型相同或同为数值类型时进行类型转换,
+// 例如JSON解码得到的float64可以转换为int
+func decodeAs[T any](data []byte, codec Codec) (T, error) {
+	var zero T
+	target := reflect.TypeOf(&zero).Elem()
+	var decoded any
+	var err error
+	if td, ok := codec.(typedDecoder); ok {
+		decoded, err = td.decodeType(data, target)
+	} else {
+		decoded, err = codec.Decode(data)
+	}
+	if err != nil {
+		return zero, err
+	}
+	if t, ok := decoded.(T); ok {
+		return t, nil
+	}
+	if decoded != nil {
+		v := reflect.ValueOf(decoded)
+		if convertible(v.Type(), target) {
+			return v.Convert(target).Interface().(T), nil
+		}
+	}
+	return zero, newDecodedTypeError(decoded, target)
+}
+
+// convertible 判断解码结果的类型from是否可以转换为类型to
+func convertible(from reflect.Type, to reflect.Type) bool {
+	if !from.ConvertibleTo(to) {
+		return false
+	}
+	if from.Kind() == to.Kind() {
+		return true
+	}
+	return isNumber(from.Kind()) && isNumber(to.Kind())
+}
+
+// isNumber 判断给定的类型种类是否为数值类型
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
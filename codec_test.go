@@ -0,0 +1,125 @@
+package cmap
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// gobTestPoint 代表测试用的需要向gob注册的类型
+type gobTestPoint struct {
+	X, Y int
+}
+
+func TestGobCodec(t *testing.T) {
+	if err := RegisterGobType(gobTestPoint{}); err != nil {
+		t.Fatalf("An error occurs when registering gob type: %s", err)
+	}
+	if err := RegisterGobType(gobTestPoint{}); err != nil {
+		t.Fatalf("An error occurs when registering gob type twice: %s", err)
+	}
+	if err := RegisterGobType(nil); err == nil {
+		t.Fatal("No error when registering a nil gob type, but should not be the case!")
+	}
+	codec := GobCodec{}
+	for _, v := range []any{42, "a", 3.5, []byte("raw"), gobTestPoint{1, 2}} {
+		data, err := codec.Encode(v)
+		if err != nil {
+			t.Fatalf("An error occurs when encoding %v: %s", v, err)
+		}
+		decoded, err := codec.Decode(data)
+		if err != nil {
+			t.Fatalf("An error occurs when decoding %v: %s", v, err)
+		}
+		if !reflect.DeepEqual(decoded, v) {
+			t.Fatalf("Inconsistent decoded value: expected: %#v, actual: %#v", v, decoded)
+		}
+	}
+	type unregistered struct{ A int }
+	if _, err := codec.Encode(unregistered{1}); err == nil {
+		t.Fatal("No error when encoding an unregistered type, but should not be the case!")
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	codec := JSONCodec{}
+	data, err := codec.Encode(map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("An error occurs when encoding: %s", err)
+	}
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatalf("An error occurs when decoding: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, map[string]any{"a": 1.0}) {
+		t.Fatalf("Inconsistent decoded value: %#v", decoded)
+	}
+	// 直接解码为元素类型时,大整数不会经由float64丢失精度
+	data, _ = codec.Encode(int64(math.MaxInt64))
+	if n, err := decodeAs[int64](data, codec); err != nil || n != math.MaxInt64 {
+		t.Fatalf("Inconsistent decoded integer: %d, error: %v", n, err)
+	}
+	if _, err := decodeAs[int]([]byte("{"), codec); err == nil {
+		t.Fatal("No error when decoding malformed JSON, but should not be the case!")
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	codec := RawCodec{}
+	data, err := codec.Encode([]byte("raw"))
+	if err != nil || string(data) != "raw" {
+		t.Fatalf("Inconsistent encoded bytes: %q, error: %v", data, err)
+	}
+	if _, err := codec.Encode("raw"); !errors.As(err, new(IllegalParameterError)) {
+		t.Fatalf("Inconsistent error when encoding a string: %v", err)
+	}
+	decoded, err := decodeAs[[]byte](data, codec)
+	if err != nil || string(decoded) != "raw" {
+		t.Fatalf("Inconsistent decoded bytes: %q, error: %v", decoded, err)
+	}
+}
+
+func TestCodecsWithSnapshotAndWAL(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	src, _ := New[point, gobTestPoint]()
+	src.Put(point{1, 2}, gobTestPoint{3, 4})
+	// 不依赖其他测试的注册,以便单独运行本测试
+	for _, value := range []any{point{}, gobTestPoint{}} {
+		if err := RegisterGobType(value); err != nil {
+			t.Fatalf("An error occurs when registering gob type: %s", err)
+		}
+	}
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		var buf bytes.Buffer
+		if err := src.SaveSnapshot(&buf, codec); err != nil {
+			t.Fatalf("An error occurs when saving snapshot with %T: %s", codec, err)
+		}
+		dst, _ := New[point, gobTestPoint]()
+		if err := dst.LoadSnapshot(&buf, codec); err != nil {
+			t.Fatalf("An error occurs when loading snapshot with %T: %s", codec, err)
+		}
+		if element := dst.Get(point{1, 2}); element != (gobTestPoint{3, 4}) {
+			t.Fatalf("Inconsistent element with %T: %v", codec, element)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	cm, err := New[string, []byte](WithWAL(path, RawCodec{}))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map with wal: %s", err)
+	}
+	cm.Put("a", []byte("raw"))
+	cm.Close()
+	replayed, err := New[string, []byte](WithWAL(path, RawCodec{}))
+	if err != nil {
+		t.Fatalf("An error occurs when replaying wal: %s", err)
+	}
+	defer replayed.Close()
+	if string(replayed.Get("a")) != "raw" {
+		t.Fatalf("Inconsistent replayed element: %q", replayed.Get("a"))
+	}
+}
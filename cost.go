@@ -0,0 +1,157 @@
+package cmap
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// CostOverflowAction 代表写操作超出成本预算时的处理方式
+type CostOverflowAction uint8
+
+const (
+	// COST_OVERFLOW_EVICT 代表淘汰当前散列段中的键-元素对以腾出预算
+	// 若当前散列段中的其他键-元素对不足以腾出预算,则仍会拒绝写入
+	COST_OVERFLOW_EVICT CostOverflowAction = 0
+	// COST_OVERFLOW_REJECT 代表拒绝写入并返回CostExceededError
+	COST_OVERFLOW_REJECT CostOverflowAction = 1
+)
+
+// MAX_COST_ESTIMATE_DEPTH 代表默认的成本估算器递归估算的最大深度
+const MAX_COST_ESTIMATE_DEPTH int = 8
+
+// costTracker 代表字典中所有散列段共用的成本记录器
+type costTracker[K comparable, V any] struct {
+	// maxCost 代表成本预算
+	maxCost int64
+	// total 代表所有键-元素对的成本之和
+	total atomic.Int64
+	// cost 代表计算键-元素对成本的函数
+	cost func(key K, element V) int64
+	// action 代表超出成本预算时的处理方式
+	action CostOverflowAction
+}
+
+// newCostTracker 创建一个costTracker类型的实例
+// 参数cost为nil时使用DefaultCost
+func newCostTracker[K comparable, V any](maxCost int64, cost func(key K, element V) int64,
+	action CostOverflowAction) *costTracker[K, V] {
+	if cost == nil {
+		cost = DefaultCost[K, V]
+	}
+	return &costTracker[K, V]{
+		maxCost: maxCost,
+		cost:    cost,
+		action:  action,
+	}
+}
+
+// weigh 计算键-元素对的成本
+// 负的成本会被视为0
+func (t *costTracker[K, V]) weigh(key K, element V) int64 {
+	cost := t.cost(key, element)
+	if cost < 0 {
+		return 0
+	}
+	return cost
+}
+
+// tryAdd 仅当不会超出成本预算时才累加成本增量
+// 返回值表示是否完成了累加
+func (t *costTracker[K, V]) tryAdd(delta int64) bool {
+	for {
+		total := t.total.Load()
+		if delta > 0 && total+delta > t.maxCost {
+			return false
+		}
+		if t.total.CompareAndSwap(total, total+delta) {
+			return true
+		}
+	}
+}
+
+// overflowed 判断所有键-元素对的成本之和是否超出了成本预算
+func (t *costTracker[K, V]) overflowed() bool {
+	return t.total.Load() > t.maxCost
+}
+
+// DefaultCost 是默认的成本估算器
+// 它基于反射粗略地估算键和元素占用的字节数,包括字符串、切片、映射及指针所引用的数据
+// 超过MAX_COST_ESTIMATE_DEPTH层的嵌套数据不再计入
+func DefaultCost[K comparable, V any](key K, element V) int64 {
+	return estimateSize(reflect.ValueOf(&key).Elem(), 0) +
+		estimateSize(reflect.ValueOf(&element).Elem(), 0)
+}
+
+// estimateSize 估算给定值占用的字节数
+func estimateSize(v reflect.Value, depth int) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	size := int64(v.Type().Size())
+	if depth >= MAX_COST_ESTIMATE_DEPTH {
+		return size
+	}
+	switch v.Kind() {
+	case reflect.String:
+		size += int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+		size += estimateElements(v, depth)
+	case reflect.Array:
+		// 数组的元素已包含在其类型的尺寸中,这里只计入元素所引用的数据
+		size += estimateElements(v, depth) - int64(v.Len())*int64(v.Type().Elem().Size())
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			size += estimateSize(iter.Key(), depth+1) + estimateSize(iter.Value(), depth+1)
+		}
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			break
+		}
+		size += estimateSize(v.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			size += estimateSize(field, depth+1) - int64(field.Type().Size())
+		}
+	}
+	return size
+}
+
+// estimateElements 估算切片或数组的所有元素占用的字节数
+// 若元素类型不含引用,则直接按元素尺寸计算
+func estimateElements(v reflect.Value, depth int) int64 {
+	elemType := v.Type().Elem()
+	if !hasReferences(elemType) {
+		return int64(v.Len()) * int64(elemType.Size())
+	}
+	var size int64
+	for i := 0; i < v.Len(); i++ {
+		size += estimateSize(v.Index(i), depth+1)
+	}
+	return size
+}
+
+// hasReferences 判断给定类型的值是否可能引用其他数据
+func hasReferences(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Pointer, reflect.Interface,
+		reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	case reflect.Array:
+		return hasReferences(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasReferences(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package cmap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDefaultCost(t *testing.T) {
+	type record struct {
+		name string
+		tags []string
+	}
+	small := DefaultCost[string, int]("a", 1)
+	large := DefaultCost[string, int]("aaaaaaaaaa", 1)
+	if large-small != 9 {
+		t.Fatalf("Inconsistent cost of string keys: small: %d, large: %d", small, large)
+	}
+	if cost := DefaultCost[int, []byte](1, make([]byte, 100)); cost < 100 {
+		t.Fatalf("The cost of a slice does not include its elements: %d", cost)
+	}
+	empty := DefaultCost[int, *record](1, &record{})
+	full := DefaultCost[int, *record](1, &record{name: "abcd", tags: []string{"ef", "gh"}})
+	if full-empty < 8 {
+		t.Fatalf("The cost of a pointer does not include the referenced data: empty: %d, full: %d", empty, full)
+	}
+	if cost := DefaultCost[string, interface{}]("", nil); cost <= 0 {
+		t.Fatalf("Inconsistent cost of a nil interface: %d", cost)
+	}
+}
+
+func TestMaxCostEvict(t *testing.T) {
+	var evicted []string
+	cm, err := New[string, int](
+		WithConcurrency(1),
+		WithMaxCost(10),
+		WithCost(func(key string, element int) int64 { return int64(element) }),
+		WithEvictionCallback(func(key string, element int) {
+			evicted = append(evicted, key)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.Put("a", 4)
+	cm.Put("b", 4)
+	cm.Get("a")
+	if ok, err := cm.Put("c", 5); !ok || err != nil {
+		t.Fatalf("Couldn't put pair beyond the cost budget: ok: %v, error: %v", ok, err)
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("Inconsistent evicted keys: %v", evicted)
+	}
+	stats := cm.Stats()
+	if stats.Cost != 9 || stats.MaxCost != 10 || stats.Evictions != 1 {
+		t.Fatalf("Inconsistent stats: cost: %d, max cost: %d, evictions: %d",
+			stats.Cost, stats.MaxCost, stats.Evictions)
+	}
+	// 更新元素时按新旧成本之差计算
+	cm.Put("a", 5)
+	if cost := cm.Stats().Cost; cost != 10 || cm.Len() != 2 {
+		t.Fatalf("Inconsistent map after updating: cost: %d, len: %d", cost, cm.Len())
+	}
+	_, err = cm.Put("d", 11)
+	var costErr CostExceededError
+	if !errors.As(err, &costErr) || costErr.Cost != 11 || costErr.MaxCost != 10 {
+		t.Fatalf("Inconsistent error when putting an oversize pair: %v", err)
+	}
+	if cm.Get("d") != 0 || cm.Len() != 2 {
+		t.Fatal("The oversize pair is stored, but should not be the case!")
+	}
+	cm.Delete("a")
+	if cost := cm.Stats().Cost; cost != 5 {
+		t.Fatalf("Inconsistent cost after deleting: expected: %d, actual: %d", 5, cost)
+	}
+	cm.Clear()
+	if cost := cm.Stats().Cost; cost != 0 {
+		t.Fatalf("Inconsistent cost after clearing: expected: %d, actual: %d", 0, cost)
+	}
+}
+
+func TestMaxCostReject(t *testing.T) {
+	cm, err := New[string, int](
+		WithMaxCost(10),
+		WithCost(func(key string, element int) int64 { return int64(element) }),
+		WithCostOverflowAction(COST_OVERFLOW_REJECT),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.Put("a", 6)
+	if _, err := cm.Put("b", 5); !errors.As(err, new(CostExceededError)) {
+		t.Fatalf("Inconsistent error when exceeding the cost budget: %v", err)
+	}
+	_, _, err = cm.Compute("b", func(int, bool) (int, bool) { return 5, true })
+	if !errors.As(err, new(CostExceededError)) {
+		t.Fatalf("Inconsistent error when computing beyond the cost budget: %v", err)
+	}
+	if cm.Get("a") != 6 || cm.Len() != 1 || cm.Stats().Evictions != 0 {
+		t.Fatal("The map is changed by a rejected write, but should not be the case!")
+	}
+	if ok, err := cm.Put("a", 10); ok || err != nil {
+		t.Fatalf("Couldn't update pair within the cost budget: ok: %v, error: %v", ok, err)
+	}
+	if cost := cm.Stats().Cost; cost != 10 {
+		t.Fatalf("Inconsistent cost: expected: %d, actual: %d", 10, cost)
+	}
+}
@@ -1,6 +1,9 @@
 package cmap
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
 // IllegalParameterError 代表非法的参数错误类型
 type IllegalParameterError struct {
@@ -25,7 +28,7 @@ type IllegalPairTypeError struct {
 }
 
 // newIllegalPairTypeError 创建一个IllegalPairTypeError类型的实例
-func newIllegalPairTypeError(pair Pair) IllegalPairTypeError {
+func newIllegalPairTypeError(pair any) IllegalPairTypeError {
 	return IllegalPairTypeError{
 		msg: fmt.Sprintf("concurrency map: illegal pair type: %T", pair),
 	}
@@ -52,3 +55,99 @@ func newPairRedistributorError(errMsg string) PairRedistributorError {
 func (pre PairRedistributorError) Error() string {
 	return pre.msg
 }
+
+// CostExceededError 代表写操作超出成本预算的错误类型
+type CostExceededError struct {
+	msg string
+	// Cost 代表被拒绝写入的键-元素对的成本
+	Cost int64
+	// MaxCost 代表成本预算
+	MaxCost int64
+}
+
+// newCostExceededError 创建一个CostExceededError类型的实例
+func newCostExceededError(cost int64, maxCost int64) CostExceededError {
+	return CostExceededError{
+		msg:     fmt.Sprintf("concurrency map: cost exceeded: cost %d, max cost %d", cost, maxCost),
+		Cost:    cost,
+		MaxCost: maxCost,
+	}
+}
+
+// Error error接口方法
+func (cee CostExceededError) Error() string {
+	return cee.msg
+}
+
+// LoaderPanicError 代表加载函数引发恐慌的错误类型
+type LoaderPanicError struct {
+	msg string
+	// Value 代表恐慌的值
+	Value any
+}
+
+// newLoaderPanicError 创建一个LoaderPanicError类型的实例
+func newLoaderPanicError(value any) LoaderPanicError {
+	return LoaderPanicError{
+		msg:   fmt.Sprintf("concurrency map: loader panicked: %v", value),
+		Value: value,
+	}
+}
+
+// Error error接口方法
+func (lpe LoaderPanicError) Error() string {
+	return lpe.msg
+}
+
+// IllegalSnapshotError 代表非法快照的错误类型
+// 快照的格式、版本或校验和不正确时会返回此错误
+type IllegalSnapshotError struct {
+	msg string
+}
+
+// newIllegalSnapshotError 创建一个IllegalSnapshotError类型的实例
+func newIllegalSnapshotError(errMsg string) IllegalSnapshotError {
+	return IllegalSnapshotError{
+		msg: fmt.Sprintf("concurrency map: illegal snapshot: %s", errMsg),
+	}
+}
+
+// Error error接口方法
+func (ise IllegalSnapshotError) Error() string {
+	return ise.msg
+}
+
+// DecodedTypeError 代表解码结果的类型与键或元素的类型不符的错误类型
+type DecodedTypeError struct {
+	msg string
+}
+
+// newDecodedTypeError 创建一个DecodedTypeError类型的实例
+func newDecodedTypeError(decoded any, expected reflect.Type) DecodedTypeError {
+	return DecodedTypeError{
+		msg: fmt.Sprintf("concurrency map: mismatched decoded type: %T, expected: %s", decoded, expected),
+	}
+}
+
+// Error error接口方法
+func (dte DecodedTypeError) Error() string {
+	return dte.msg
+}
+
+// IllegalWALError 代表非法预写日志的错误类型
+// 日志的格式或版本不正确,或者校验无误的记录无法解析时会返回此错误
+type IllegalWALError struct {
+	msg string
+}
+
+// newIllegalWALError 创建一个IllegalWALError类型的实例
+func newIllegalWALError(errMsg string) IllegalWALError {
+	return IllegalWALError{
+		msg: fmt.Sprintf("concurrency map: illegal write-ahead log: %s", errMsg),
+	}
+}
+
+// Error error接口方法
+func (iwe IllegalWALError) Error() string {
+	return iwe.msg
+}
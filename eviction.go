@@ -0,0 +1,182 @@
+package cmap
+
+import (
+	"container/list"
+	"sync"
+)
+
+// EvictionPolicy 代表散列段的淘汰策略的接口
+// 每个散列段拥有独立的淘汰策略实例,因此记录访问时只会在散列段内竞争
+// Access会在不持有段锁的情况下被调用,所以其实现必须是并发安全的
+type EvictionPolicy[K comparable] interface {
+	// Access 记录一次对已有键的访问
+	Access(key K)
+	// Add 记录一个新增的键
+	Add(key K)
+	// Remove 记录一个被删除(而非被淘汰)的键
+	Remove(key K)
+	// Evict 选出并移除一个应被淘汰的键
+	// 被选出的键有可能就是刚刚新增的键,这代表拒绝接纳该键
+	// 若第二个返回值为false,则说明没有可淘汰的键
+	Evict() (key K, ok bool)
+	// Clear 移除所有的键
+	Clear()
+}
+
+// policyEntry 代表淘汰策略中一个键的状态,用于在调整并发量时迁移淘汰状态
+type policyEntry[K comparable] struct {
+	// key 代表键
+	key K
+	// region 代表键所在的区域,其含义由淘汰策略决定
+	region uint8
+	// frequency 代表键的近似访问频率,不记录访问频率的淘汰策略为0
+	frequency uint8
+}
+
+// migratablePolicy 代表能够导出和导入淘汰状态的淘汰策略
+// 未实现该接口的淘汰策略在迁移时只能通过Evict得到淘汰顺序,再通过Add依次重新记录各个键
+type migratablePolicy[K comparable] interface {
+	// export 按淘汰顺序返回所有键的状态,最先被淘汰的在前
+	export() []policyEntry[K]
+	// adopt 按顺序记录由export返回的键的状态,越靠后的键越晚被淘汰
+	adopt(entries []policyEntry[K])
+}
+
+// missRecorder 代表需要记录对不存在的键的访问的淘汰策略
+// 基于访问频率的淘汰策略据此得知频繁未命中的键,以便在放入该键时接纳它
+type missRecorder[K comparable] interface {
+	// recordMiss 记录一次对不存在的键的访问
+	recordMiss(key K)
+}
+
+// exportPolicy 按淘汰顺序取出淘汰策略中所有键的状态,最先被淘汰的在前,之后淘汰策略变为空
+func exportPolicy[K comparable](policy EvictionPolicy[K]) []policyEntry[K] {
+	var entries []policyEntry[K]
+	if mp, ok := policy.(migratablePolicy[K]); ok {
+		entries = mp.export()
+	} else {
+		for key, ok := policy.Evict(); ok; key, ok = policy.Evict() {
+			entries = append(entries, policyEntry[K]{key: key})
+		}
+	}
+	policy.Clear()
+	return entries
+}
+
+// adoptPolicy 按顺序将由exportPolicy取出的键的状态记录到淘汰策略中
+func adoptPolicy[K comparable](policy EvictionPolicy[K], entries []policyEntry[K]) {
+	if mp, ok := policy.(migratablePolicy[K]); ok {
+		mp.adopt(entries)
+		return
+	}
+	for _, e := range entries {
+		policy.Add(e.key)
+	}
+}
+
+// DEFAULT_POLICY_CAPACITY 代表只限制成本而不限制数量时传给淘汰策略工厂函数的容量
+const DEFAULT_POLICY_CAPACITY int = 1024
+
+// EvictionPolicyFactory 代表淘汰策略的工厂函数
+// 字典会为每个散列段调用一次该函数
+// 参数capacity代表单个散列段能容纳的键-元素对的最大数量
+// 若只限制了成本,则参数capacity为DEFAULT_POLICY_CAPACITY
+type EvictionPolicyFactory[K comparable] func(capacity int) EvictionPolicy[K]
+
+// lruPolicy 代表基于最近最少使用(LRU)算法的EvictionPolicy的实现类型
+type lruPolicy[K comparable] struct {
+	// entries 代表按最近使用的顺序排列的键,表头为最近使用的键
+	entries *list.List
+	// elements 代表键与其在链表中的位置的映射
+	elements map[K]*list.Element
+	// lock 保护链表及映射的互斥锁
+	lock sync.Mutex
+}
+
+// NewLRUPolicy 创建一个基于LRU算法的EvictionPolicy类型的实例
+// 它是有容量限制的字典的默认淘汰策略
+func NewLRUPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &lruPolicy[K]{
+		entries:  list.New(),
+		elements: make(map[K]*list.Element, capacity),
+	}
+}
+
+// Access 记录一次对已有键的访问
+func (p *lruPolicy[K]) Access(key K) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if e, ok := p.elements[key]; ok {
+		p.entries.MoveToFront(e)
+	}
+}
+
+// Add 记录一个新增的键
+func (p *lruPolicy[K]) Add(key K) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if e, ok := p.elements[key]; ok {
+		p.entries.MoveToFront(e)
+		return
+	}
+	p.elements[key] = p.entries.PushFront(key)
+}
+
+// Remove 记录一个被删除的键
+func (p *lruPolicy[K]) Remove(key K) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if e, ok := p.elements[key]; ok {
+		p.entries.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+// Evict 选出并移除最久未使用的键
+func (p *lruPolicy[K]) Evict() (K, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	e := p.entries.Back()
+	if e == nil {
+		var zero K
+		return zero, false
+	}
+	key := p.entries.Remove(e).(K)
+	delete(p.elements, key)
+	return key, true
+}
+
+// Clear 移除所有的键
+func (p *lruPolicy[K]) Clear() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.entries.Init()
+	p.elements = make(map[K]*list.Element)
+}
+
+// export 按淘汰顺序返回所有键的状态,即从最久未使用的键到最近使用的键
+func (p *lruPolicy[K]) export() []policyEntry[K] {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	entries := make([]policyEntry[K], 0, p.entries.Len())
+	for e := p.entries.Back(); e != nil; e = e.Prev() {
+		entries = append(entries, policyEntry[K]{key: e.Value.(K)})
+	}
+	return entries
+}
+
+// adopt 按顺序记录由export返回的键的状态,越靠后的键越晚被淘汰
+func (p *lruPolicy[K]) adopt(entries []policyEntry[K]) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, entry := range entries {
+		if e, ok := p.elements[entry.key]; ok {
+			p.entries.MoveToFront(e)
+			continue
+		}
+		p.elements[entry.key] = p.entries.PushFront(entry.key)
+	}
+}
@@ -0,0 +1,144 @@
+package cmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestLRUPolicy(t *testing.T) {
+	p := NewLRUPolicy[string](3)
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Access("a")
+	p.Access("missing")
+	if key, ok := p.Evict(); !ok || key != "b" {
+		t.Fatalf("Inconsistent victim: expected: %q, actual: %q (%v)", "b", key, ok)
+	}
+	p.Remove("c")
+	if key, ok := p.Evict(); !ok || key != "a" {
+		t.Fatalf("Inconsistent victim: expected: %q, actual: %q (%v)", "a", key, ok)
+	}
+	if key, ok := p.Evict(); ok {
+		t.Fatalf("Evicted %q from an empty policy, but should not be the case!", key)
+	}
+	p.Add("d")
+	p.Clear()
+	if _, ok := p.Evict(); ok {
+		t.Fatal("Evicted a key after clearing, but should not be the case!")
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	var evicted []string
+	cm, err := New[string, int](
+		WithConcurrency(1),
+		WithMaxEntries(3),
+		WithEvictionCallback(func(key string, element int) {
+			evicted = append(evicted, key+"="+strconv.Itoa(element))
+		}),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var deleted []string
+	cm.Hooks().OnDelete(func(event Event[string, int]) {
+		deleted = append(deleted, event.Key)
+	})
+	cm.Put("a", 1)
+	cm.Put("b", 2)
+	cm.Put("c", 3)
+	cm.Get("a")
+	if ok, err := cm.Put("d", 4); !ok || err != nil {
+		t.Fatalf("Couldn't put pair to a full map: ok: %v, error: %v", ok, err)
+	}
+	if len(evicted) != 1 || evicted[0] != "b=2" {
+		t.Fatalf("Inconsistent evicted pairs: %v", evicted)
+	}
+	if len(deleted) != 1 || deleted[0] != "b" {
+		t.Fatalf("Inconsistent deleted keys: %v", deleted)
+	}
+	if cm.Len() != 3 || cm.Get("b") != 0 {
+		t.Fatalf("Inconsistent map after eviction: len: %d, b: %d", cm.Len(), cm.Get("b"))
+	}
+	// 更新和删除不应触发淘汰
+	cm.Put("a", 5)
+	cm.Delete("c")
+	cm.Put("e", 6)
+	if len(evicted) != 1 {
+		t.Fatalf("Inconsistent evicted pairs: %v", evicted)
+	}
+	cm.Compute("f", func(int, bool) (int, bool) { return 7, true })
+	if len(evicted) != 2 || evicted[1] != "d=4" {
+		t.Fatalf("Inconsistent evicted pairs: %v", evicted)
+	}
+	if evictions := cm.Stats().Evictions; evictions != 2 {
+		t.Fatalf("Inconsistent evictions: expected: %d, actual: %d", 2, evictions)
+	}
+}
+
+func TestMaxEntriesPerSegment(t *testing.T) {
+	cm, err := New[string, int](WithConcurrency(4), WithMaxEntries(100))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(g*1000 + i)
+				cm.Put(key, i)
+				cm.Get(strconv.Itoa(i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	for i, s := range cm.Stats().Segments {
+		if s.PairTotal > 25 {
+			t.Fatalf("Segment %d exceeds its capacity: %d", i, s.PairTotal)
+		}
+	}
+	if cm.Len() > 100 {
+		t.Fatalf("The map exceeds its capacity: %d", cm.Len())
+	}
+	var count uint64
+	cm.ForEach(func(string, int) { count++ })
+	if count != cm.Len() {
+		t.Fatalf("Inconsistent pair number: expected: %d, actual: %d", cm.Len(), count)
+	}
+}
+
+func TestMaxEntriesNotExceeded(t *testing.T) {
+	// 容量不能被并发量整除时,各散列段的容量之和仍恰为maxEntries;
+	// 容量小于并发量时,每个散列段仍至少能容纳1个键-元素对
+	testCases := []struct {
+		maxEntries int
+		expected   uint64
+	}{
+		{maxEntries: 100, expected: 100},
+		{maxEntries: 10, expected: 16},
+	}
+	for _, tc := range testCases {
+		cm, err := New[int, int](WithConcurrency(16), WithMaxEntries(tc.maxEntries))
+		if err != nil {
+			t.Fatalf("An error occurs when new a concurrent map: %s", err)
+		}
+		var capacity uint64
+		for _, s := range cm.(*myConcurrentMap[int, int]).table.Load().segments {
+			capacity += s.(*segment[int, int]).capacity
+		}
+		if capacity != tc.expected {
+			t.Fatalf("Inconsistent total capacity with max entries %d: expected: %d, actual: %d",
+				tc.maxEntries, tc.expected, capacity)
+		}
+		for i := 0; i < 10000; i++ {
+			cm.Put(i, i)
+		}
+		if cm.Len() > tc.expected {
+			t.Fatalf("The map exceeds its capacity %d: %d", tc.expected, cm.Len())
+		}
+	}
+}
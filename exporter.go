@@ -0,0 +1,219 @@
+package cmap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StatsProvider 代表可以提供运行状况快照的字典
+// 任意类型参数的ConcurrentMap都实现了该接口
+type StatsProvider interface {
+	// Len 返回当前字典中键-元素对的数量
+	Len() uint64
+	// Stats 返回当前字典运行状况的快照
+	Stats() Stats
+}
+
+// Exporter 代表字典指标的导出器
+// 它实现了expvar.Var接口,可以通过expvar.Publish发布,
+// 同时实现了http.Handler接口,以Prometheus文本格式输出指标
+type Exporter struct {
+	// name 代表字典的名称,会作为Prometheus指标的map标签
+	name string
+	// provider 代表指标的来源
+	provider StatsProvider
+}
+
+// NewExporter 创建一个Exporter类型的实例
+// 参数name代表字典的名称,参数provider通常是一个ConcurrentMap
+func NewExporter(name string, provider StatsProvider) (*Exporter, error) {
+	if provider == nil {
+		return nil, newIllegalParameterError("stats provider is nil")
+	}
+	return &Exporter{name: name, provider: provider}, nil
+}
+
+// exportedSegment 代表以expvar形式导出的散列段指标
+type exportedSegment struct {
+	Pairs           uint64 `json:"pairs"`
+	Buckets         int    `json:"buckets"`
+	LockWaitNanos   int64  `json:"lock_wait_ns"`
+	LockContentions uint64 `json:"lock_contentions"`
+}
+
+// exportedRedistribution 代表以expvar形式导出的再分布事件
+type exportedRedistribution struct {
+	Segment         int   `json:"segment"`
+	UnixNano        int64 `json:"unix_nano"`
+	OldBucketNumber int   `json:"old_buckets"`
+	NewBucketNumber int   `json:"new_buckets"`
+}
+
+// exportedMetrics 代表以expvar形式导出的字典指标
+type exportedMetrics struct {
+	Len             uint64                   `json:"len"`
+	Puts            uint64                   `json:"puts"`
+	Hits            uint64                   `json:"hits"`
+	Misses          uint64                   `json:"misses"`
+	HitRatio        float64                  `json:"hit_ratio"`
+	Deletes         uint64                   `json:"deletes"`
+	Expirations     uint64                   `json:"expirations"`
+	Evictions       uint64                   `json:"evictions"`
+	Cost            int64                    `json:"cost"`
+	MaxCost         int64                    `json:"max_cost"`
+	GrowCount       uint64                   `json:"grow_count"`
+	ShrinkCount     uint64                   `json:"shrink_count"`
+	LockWaitNanos   int64                    `json:"lock_wait_ns"`
+	LockContentions uint64                   `json:"lock_contentions"`
+	Segments        []exportedSegment        `json:"segments"`
+	Redistributions []exportedRedistribution `json:"redistributions"`
+}
+
+// String 以JSON格式返回字典的指标
+// 这是expvar.Var接口的方法
+func (e *Exporter) String() string {
+	stats := e.provider.Stats()
+	metrics := exportedMetrics{
+		Len:             e.provider.Len(),
+		Puts:            stats.Puts,
+		Hits:            stats.Hits,
+		Misses:          stats.Misses,
+		HitRatio:        stats.HitRatio,
+		Deletes:         stats.Deletes,
+		Expirations:     stats.Expirations,
+		Evictions:       stats.Evictions,
+		Cost:            stats.Cost,
+		MaxCost:         stats.MaxCost,
+		GrowCount:       stats.GrowCount,
+		ShrinkCount:     stats.ShrinkCount,
+		LockWaitNanos:   int64(stats.LockWaitTime),
+		LockContentions: stats.LockContentions,
+		Segments:        make([]exportedSegment, len(stats.Segments)),
+		Redistributions: make([]exportedRedistribution, len(stats.Redistributions)),
+	}
+	for i, s := range stats.Segments {
+		metrics.Segments[i] = exportedSegment{
+			Pairs:           s.PairTotal,
+			Buckets:         s.BucketNumber,
+			LockWaitNanos:   int64(s.LockWaitTime),
+			LockContentions: s.LockContentions,
+		}
+	}
+	for i, event := range stats.Redistributions {
+		metrics.Redistributions[i] = exportedRedistribution{
+			Segment:         event.Segment,
+			UnixNano:        event.Time.UnixNano(),
+			OldBucketNumber: event.OldBucketNumber,
+			NewBucketNumber: event.NewBucketNumber,
+		}
+	}
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// ServeHTTP 以Prometheus文本格式输出字典的指标
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = e.WritePrometheus(w)
+}
+
+// WritePrometheus 以Prometheus文本格式将字典的指标写入w
+func (e *Exporter) WritePrometheus(w io.Writer) error {
+	stats := e.provider.Stats()
+	length := e.provider.Len()
+	bw := bufio.NewWriter(w)
+	mapLabel := "map=\"" + escapeLabelValue(e.name) + "\""
+
+	writeMetricHeader(bw, "cmap_pairs", "gauge", "Current number of key-element pairs.")
+	writeMetric(bw, "cmap_pairs", mapLabel, float64(length))
+
+	writeMetricHeader(bw, "cmap_operations_total", "counter", "Number of map operations by type.")
+	for _, op := range []struct {
+		name  string
+		count uint64
+	}{
+		{"put", stats.Puts},
+		{"hit", stats.Hits},
+		{"miss", stats.Misses},
+		{"delete", stats.Deletes},
+		{"expire", stats.Expirations},
+		{"evict", stats.Evictions},
+	} {
+		writeMetric(bw, "cmap_operations_total", mapLabel+",op=\""+op.name+"\"", float64(op.count))
+	}
+
+	writeMetricHeader(bw, "cmap_hit_ratio", "gauge", "Ratio of lookup hits to all lookups.")
+	writeMetric(bw, "cmap_hit_ratio", mapLabel, stats.HitRatio)
+
+	if stats.MaxCost > 0 {
+		writeMetricHeader(bw, "cmap_cost", "gauge", "Current total cost of key-element pairs.")
+		writeMetric(bw, "cmap_cost", mapLabel, float64(stats.Cost))
+		writeMetricHeader(bw, "cmap_max_cost", "gauge", "Cost budget of the map.")
+		writeMetric(bw, "cmap_max_cost", mapLabel, float64(stats.MaxCost))
+	}
+
+	writeMetricHeader(bw, "cmap_redistributions_total", "counter", "Number of redistributions that changed the bucket number.")
+	writeMetric(bw, "cmap_redistributions_total", mapLabel+",type=\"grow\"", float64(stats.GrowCount))
+	writeMetric(bw, "cmap_redistributions_total", mapLabel+",type=\"shrink\"", float64(stats.ShrinkCount))
+
+	if n := len(stats.Redistributions); n > 0 {
+		last := stats.Redistributions[n-1]
+		writeMetricHeader(bw, "cmap_last_redistribution_timestamp_seconds", "gauge", "Unix time of the latest redistribution.")
+		writeMetric(bw, "cmap_last_redistribution_timestamp_seconds", mapLabel,
+			float64(last.Time.UnixNano())/1e9)
+	}
+
+	writeMetricHeader(bw, "cmap_segment_pairs", "gauge", "Current number of key-element pairs per segment.")
+	for i, s := range stats.Segments {
+		writeMetric(bw, "cmap_segment_pairs", segmentLabels(mapLabel, i), float64(s.PairTotal))
+	}
+	writeMetricHeader(bw, "cmap_segment_buckets", "gauge", "Current number of buckets per segment.")
+	for i, s := range stats.Segments {
+		writeMetric(bw, "cmap_segment_buckets", segmentLabels(mapLabel, i), float64(s.BucketNumber))
+	}
+	writeMetricHeader(bw, "cmap_segment_lock_wait_seconds_total", "counter", "Total time spent waiting for segment locks.")
+	for i, s := range stats.Segments {
+		writeMetric(bw, "cmap_segment_lock_wait_seconds_total", segmentLabels(mapLabel, i), s.LockWaitTime.Seconds())
+	}
+	writeMetricHeader(bw, "cmap_segment_lock_contentions_total", "counter", "Number of contended segment lock acquisitions.")
+	for i, s := range stats.Segments {
+		writeMetric(bw, "cmap_segment_lock_contentions_total", segmentLabels(mapLabel, i), float64(s.LockContentions))
+	}
+	return bw.Flush()
+}
+
+// writeMetricHeader 写入Prometheus指标的HELP和TYPE行
+func writeMetricHeader(w *bufio.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeMetric 写入一个Prometheus样本
+func writeMetric(w *bufio.Writer, name string, labels string, value float64) {
+	w.WriteString(name)
+	w.WriteString("{")
+	w.WriteString(labels)
+	w.WriteString("} ")
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteString("\n")
+}
+
+// segmentLabels 生成带有散列段索引的标签
+func segmentLabels(mapLabel string, index int) string {
+	return mapLabel + ",segment=\"" + strconv.Itoa(index) + "\""
+}
+
+// labelValueEscaper 用于转义Prometheus标签值中的特殊字符
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// escapeLabelValue 转义Prometheus标签值
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,71 @@
+package cmap
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExporterExpvar(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	_, _ = cm.Put("a", 1)
+	_, _ = cm.Put("a", 2)
+	_, _ = cm.Put("b", 3)
+	_ = cm.Get("a")
+	_ = cm.Get("c")
+	cm.Delete("b")
+	exporter, err := NewExporter("test", cm)
+	if err != nil {
+		t.Fatalf("An error occurs when new an exporter: %s", err)
+	}
+	expvar.Publish("cmap_exporter_test", exporter)
+	if expvar.Get("cmap_exporter_test") == nil {
+		t.Fatal("Couldn't find the published exporter!")
+	}
+	var metrics exportedMetrics
+	if err := json.Unmarshal([]byte(exporter.String()), &metrics); err != nil {
+		t.Fatalf("An error occurs when decoding the exported metrics: %s (metrics: %s)", err, exporter.String())
+	}
+	if metrics.Len != 1 || metrics.Puts != 3 || metrics.Hits != 1 || metrics.Misses != 1 || metrics.Deletes != 1 ||
+		metrics.HitRatio != 0.5 {
+		t.Fatalf("Inconsistent metrics: %s", exporter.String())
+	}
+	if len(metrics.Segments) != cm.Concurrency() {
+		t.Fatalf("Inconsistent segment number: expected: %d, actual: %d", cm.Concurrency(), len(metrics.Segments))
+	}
+	if _, err := NewExporter("nil", nil); err == nil {
+		t.Fatal("No error when new an exporter with a nil provider, but should not be the case!")
+	}
+}
+
+func TestExporterPrometheus(t *testing.T) {
+	cm, _ := New[int, int](WithConcurrency(2))
+	for i := 0; i < 10; i++ {
+		_, _ = cm.Put(i, i)
+	}
+	exporter, _ := NewExporter(`my "map"`, cm)
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("Inconsistent content type: %s", contentType)
+	}
+	body := recorder.Body.String()
+	expectedLines := []string{
+		"# TYPE cmap_pairs gauge",
+		`cmap_pairs{map="my \"map\""} 10`,
+		"# TYPE cmap_operations_total counter",
+		`cmap_operations_total{map="my \"map\"",op="put"} 10`,
+		`cmap_operations_total{map="my \"map\"",op="miss"} 0`,
+		`cmap_hit_ratio{map="my \"map\""} 0`,
+		`cmap_redistributions_total{map="my \"map\"",type="grow"} 0`,
+		`cmap_segment_buckets{map="my \"map\"",segment="1"} 16`,
+		"# TYPE cmap_segment_lock_wait_seconds_total counter",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("Couldn't find line %q in the exported metrics:\n%s", line, body)
+		}
+	}
+}
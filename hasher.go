@@ -0,0 +1,79 @@
+package cmap
+
+import "hash/maphash"
+
+// Hasher 代表键的哈希函数的接口
+// 同一个字典中的所有散列段共用同一个Hasher,因此其实现必须是并发安全的
+type Hasher[K comparable] interface {
+	// Hash 返回给定键的哈希值
+	Hash(key K) uint64
+}
+
+// bkdrHasher 代表基于BKDR哈希算法的Hasher实现类型
+type bkdrHasher[K ~string] struct{}
+
+// NewBKDRHasher 创建一个基于BKDR哈希算法的Hasher类型的实例
+// 它是字符串键的默认哈希函数,速度快但容易构造出碰撞的键
+func NewBKDRHasher[K ~string]() Hasher[K] {
+	return bkdrHasher[K]{}
+}
+
+// Hash 返回给定键的哈希值
+func (h bkdrHasher[K]) Hash(key K) uint64 {
+	return hash(string(key))
+}
+
+// fnv1aHasher 代表基于FNV-1a哈希算法的Hasher实现类型
+type fnv1aHasher[K ~string] struct{}
+
+// NewFNV1aHasher 创建一个基于FNV-1a哈希算法的Hasher类型的实例
+func NewFNV1aHasher[K ~string]() Hasher[K] {
+	return fnv1aHasher[K]{}
+}
+
+// Hash 返回给定键的哈希值
+func (h fnv1aHasher[K]) Hash(key K) uint64 {
+	return fnv1a(string(key))
+}
+
+// md5Hasher 代表基于MD5摘要算法的Hasher实现类型
+type md5Hasher[K ~string] struct{}
+
+// NewMD5Hasher 创建一个基于MD5摘要算法的Hasher类型的实例
+// 它的分布最均匀但速度最慢
+func NewMD5Hasher[K ~string]() Hasher[K] {
+	return md5Hasher[K]{}
+}
+
+// Hash 返回给定键的哈希值
+func (h md5Hasher[K]) Hash(key K) uint64 {
+	return hash2(string(key))
+}
+
+// mapHasher 代表基于hash/maphash的Hasher实现类型
+type mapHasher[K comparable] struct {
+	// seed 代表哈希种子
+	seed maphash.Seed
+}
+
+// NewMapHasher 创建一个基于hash/maphash的Hasher类型的实例
+// 每个实例都拥有一个随机的哈希种子,外部无法预知其哈希值,
+// 因此可以抵御针对散列桶的哈希洪水攻击
+// 它支持任意可比较类型的键
+func NewMapHasher[K comparable]() Hasher[K] {
+	return mapHasher[K]{seed: maphash.MakeSeed()}
+}
+
+// Hash 返回给定键的哈希值
+func (h mapHasher[K]) Hash(key K) uint64 {
+	return maphash.Comparable(h.seed, key)
+}
+
+// newDefaultHasher 创建一个默认的Hasher类型的实例
+// 字符串键沿用BKDR哈希算法,其他可比较类型的键使用带有随机种子的maphash
+func newDefaultHasher[K comparable]() Hasher[K] {
+	if h, ok := any(bkdrHasher[string]{}).(Hasher[K]); ok {
+		return h
+	}
+	return NewMapHasher[K]()
+}
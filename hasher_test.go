@@ -0,0 +1,102 @@
+package cmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashers(t *testing.T) {
+	testCases := map[string]Hasher[string]{
+		"BKDR":    NewBKDRHasher[string](),
+		"FNV-1a":  NewFNV1aHasher[string](),
+		"MD5":     NewMD5Hasher[string](),
+		"maphash": NewMapHasher[string](),
+	}
+	keys := genTestingKeyElementSlice(100)
+	for name, hasher := range testCases {
+		t.Run(name, func(t *testing.T) {
+			hashes := make(map[uint64]struct{}, len(keys))
+			for _, ke := range keys {
+				h := hasher.Hash(ke.key)
+				if h != hasher.Hash(ke.key) {
+					t.Fatalf("Inconsistent hash for the same key! (key: %s)", ke.key)
+				}
+				hashes[h] = struct{}{}
+			}
+			if len(hashes) < len(keys)/2 {
+				t.Fatalf("Too many collisions: %d distinct hashes for %d keys", len(hashes), len(keys))
+			}
+		})
+	}
+}
+
+func TestFNV1aHasher(t *testing.T) {
+	// 参考值来自FNV算法的官方测试向量
+	testCases := map[string]uint64{
+		"":       0xcbf29ce484222325,
+		"a":      0xaf63dc4c8601ec8c,
+		"foobar": 0x85944171f73967e8,
+	}
+	hasher := NewFNV1aHasher[string]()
+	for key, expected := range testCases {
+		if actual := hasher.Hash(key); actual != expected {
+			t.Fatalf("Inconsistent hash: expected: %x, actual: %x (key: %q)", expected, actual, key)
+		}
+	}
+}
+
+func TestMapHasherSeed(t *testing.T) {
+	h1 := NewMapHasher[string]()
+	h2 := NewMapHasher[string]()
+	var same int
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if h1.Hash(key) == h2.Hash(key) {
+			same++
+		}
+	}
+	if same == 10 {
+		t.Fatal("Two map hashers share the same seed, but should not be the case!")
+	}
+}
+
+func TestDefaultHasher(t *testing.T) {
+	if _, ok := newDefaultHasher[string]().(bkdrHasher[string]); !ok {
+		t.Fatalf("Inconsistent default hasher for string keys: %T", newDefaultHasher[string]())
+	}
+	if _, ok := newDefaultHasher[int]().(mapHasher[int]); !ok {
+		t.Fatalf("Inconsistent default hasher for int keys: %T", newDefaultHasher[int]())
+	}
+}
+
+func TestCmapWithHasher(t *testing.T) {
+	number := 1000
+	type userID string
+	cm, err := New[userID, int](WithConcurrency(4), WithHasher(NewFNV1aHasher[userID]()))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i := 0; i < number; i++ {
+		_, _ = cm.Put(userID(fmt.Sprintf("user%d", i)), i)
+	}
+	for i := 0; i < number; i++ {
+		key := userID(fmt.Sprintf("user%d", i))
+		if actual := cm.Get(key); actual != i {
+			t.Fatalf("Inconsistent element: expected: %d, actual: %d (key: %s)", i, actual, key)
+		}
+	}
+	for i := 0; i < number; i++ {
+		if !cm.Delete(userID(fmt.Sprintf("user%d", i))) {
+			t.Fatalf("Couldn't delete a key-element from cmap! (key: user%d)", i)
+		}
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 0, cm.Len())
+	}
+	if _, err := New[string, int](WithHasher(NewMapHasher[int]())); err == nil {
+		t.Fatal("No error when new a concurrent map with a mismatched hasher, but should not be the case!")
+	}
+	if _, err := New[string, int](WithHasher[string](nil)); err == nil {
+		t.Fatal("No error when new a concurrent map with a nil hasher, but should not be the case!")
+	}
+}
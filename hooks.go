@@ -0,0 +1,227 @@
+package cmap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventType 代表变更事件的类型
+type EventType uint8
+
+const (
+	// EVENT_INSERT 代表新增了键-元素对
+	EVENT_INSERT EventType = 1
+	// EVENT_UPDATE 代表替换了已有键-元素对的元素
+	EVENT_UPDATE EventType = 2
+	// EVENT_DELETE 代表删除了键-元素对
+	EVENT_DELETE EventType = 3
+)
+
+// String 返回事件类型的字符串表示形式
+func (t EventType) String() string {
+	switch t {
+	case EVENT_INSERT:
+		return "insert"
+	case EVENT_UPDATE:
+		return "update"
+	case EVENT_DELETE:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// RemovalReason 代表键-元素对被删除的原因
+type RemovalReason uint8
+
+const (
+	// REMOVAL_EXPLICIT 代表被调用方显式地删除,包括Delete、Compute等方法的删除以及Clear
+	REMOVAL_EXPLICIT RemovalReason = 1
+	// REMOVAL_EXPIRED 代表因过期而被删除
+	REMOVAL_EXPIRED RemovalReason = 2
+	// REMOVAL_EVICTED 代表因超出容量或成本预算而被淘汰
+	REMOVAL_EVICTED RemovalReason = 3
+)
+
+// String 返回删除原因的字符串表示形式
+func (r RemovalReason) String() string {
+	switch r {
+	case REMOVAL_EXPLICIT:
+		return "explicit"
+	case REMOVAL_EXPIRED:
+		return "expired"
+	case REMOVAL_EVICTED:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// Event 代表键-元素对的变更事件
+type Event[K comparable, V any] struct {
+	// Type 代表事件的类型
+	Type EventType
+	// Key 代表被变更的键
+	Key K
+	// OldElement 代表变更之前的元素,对于EVENT_INSERT为V的零值
+	OldElement V
+	// NewElement 代表变更之后的元素,对于EVENT_DELETE为V的零值
+	NewElement V
+	// Segment 代表键所在散列段的索引
+	Segment int
+	// Reason 代表键-元素对被删除的原因,仅对EVENT_DELETE有效,其他事件为0
+	Reason RemovalReason
+}
+
+// Hooks 代表变更事件钩子的注册表
+// 钩子在持有段锁的情况下被同步调用,因此同一个键的事件总是按发生的顺序送达
+// 注意!钩子应尽快返回,且不能访问触发它的字典,否则会造成死锁
+// 钩子引发的恐慌会被恢复并记录日志,不会影响字典的操作
+type Hooks[K comparable, V any] struct {
+	insert       hookList[Event[K, V]]
+	update       hookList[Event[K, V]]
+	delete       hookList[Event[K, V]]
+	redistribute hookList[RedistributionEvent]
+}
+
+// OnInsert 注册一个在新增键-元素对之后调用的钩子
+// 返回值用于注销该钩子
+func (h *Hooks[K, V]) OnInsert(fn func(event Event[K, V])) (remove func()) {
+	return h.insert.add(fn)
+}
+
+// OnUpdate 注册一个在替换已有键-元素对的元素之后调用的钩子
+// 返回值用于注销该钩子
+func (h *Hooks[K, V]) OnUpdate(fn func(event Event[K, V])) (remove func()) {
+	return h.update.add(fn)
+}
+
+// OnDelete 注册一个在删除键-元素对之后调用的钩子
+// 返回值用于注销该钩子
+func (h *Hooks[K, V]) OnDelete(fn func(event Event[K, V])) (remove func()) {
+	return h.delete.add(fn)
+}
+
+// OnRedistribute 注册一个在散列段改变了散列桶数量之后调用的钩子
+// 返回值用于注销该钩子
+func (h *Hooks[K, V]) OnRedistribute(fn func(event RedistributionEvent)) (remove func()) {
+	return h.redistribute.add(fn)
+}
+
+// hasUpdate 判断是否注册了OnUpdate钩子
+// 以便在没有钩子时省去查找旧元素的开销
+func (h *Hooks[K, V]) hasUpdate() bool {
+	return h != nil && !h.update.empty()
+}
+
+// hasDelete 判断是否注册了OnDelete钩子
+func (h *Hooks[K, V]) hasDelete() bool {
+	return h != nil && !h.delete.empty()
+}
+
+// fire 调用与事件类型对应的钩子
+// 参数onPanic用于处理钩子引发的恐慌
+func (h *Hooks[K, V]) fire(event Event[K, V], onPanic func(p interface{})) {
+	if h == nil {
+		return
+	}
+	switch event.Type {
+	case EVENT_INSERT:
+		h.insert.fire(event, onPanic)
+	case EVENT_UPDATE:
+		h.update.fire(event, onPanic)
+	case EVENT_DELETE:
+		h.delete.fire(event, onPanic)
+	}
+}
+
+// fireRedistribute 调用OnRedistribute钩子
+func (h *Hooks[K, V]) fireRedistribute(event RedistributionEvent, onPanic func(p interface{})) {
+	if h == nil {
+		return
+	}
+	h.redistribute.fire(event, onPanic)
+}
+
+// hookEntry 代表一个已注册的钩子
+type hookEntry[T any] struct {
+	id uint64
+	fn func(T)
+}
+
+// hookList 代表同一类钩子的列表
+// 列表是写时复制的,调用钩子时无需加锁
+type hookList[T any] struct {
+	lock    sync.Mutex
+	nextID  uint64
+	entries atomic.Pointer[[]hookEntry[T]]
+}
+
+// add 添加一个钩子并返回注销它的函数
+func (l *hookList[T]) add(fn func(T)) func() {
+	if fn == nil {
+		return func() {}
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.nextID++
+	id := l.nextID
+	var entries []hookEntry[T]
+	if old := l.entries.Load(); old != nil {
+		entries = append(entries, *old...)
+	}
+	entries = append(entries, hookEntry[T]{id: id, fn: fn})
+	l.entries.Store(&entries)
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.remove(id) })
+	}
+}
+
+// remove 注销指定的钩子
+func (l *hookList[T]) remove(id uint64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	old := l.entries.Load()
+	if old == nil {
+		return
+	}
+	entries := make([]hookEntry[T], 0, len(*old))
+	for _, e := range *old {
+		if e.id != id {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		l.entries.Store(nil)
+		return
+	}
+	l.entries.Store(&entries)
+}
+
+// empty 判断列表中是否没有钩子
+func (l *hookList[T]) empty() bool {
+	return l.entries.Load() == nil
+}
+
+// fire 依次调用列表中的钩子
+// 单个钩子引发的恐慌不会影响其他钩子的调用
+func (l *hookList[T]) fire(event T, onPanic func(p interface{})) {
+	entries := l.entries.Load()
+	if entries == nil {
+		return
+	}
+	for _, e := range *entries {
+		callHook(e.fn, event, onPanic)
+	}
+}
+
+// callHook 调用单个钩子并恢复其引发的恐慌
+func callHook[T any](fn func(T), event T, onPanic func(p interface{})) {
+	defer func() {
+		if p := recover(); p != nil && onPanic != nil {
+			onPanic(p)
+		}
+	}()
+	fn(event)
+}
@@ -0,0 +1,157 @@
+package cmap
+
+import (
+	"bytes"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	cm, err := New[string, int](WithConcurrency(4))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var events []Event[string, int]
+	record := func(event Event[string, int]) {
+		events = append(events, event)
+	}
+	cm.Hooks().OnInsert(record)
+	cm.Hooks().OnUpdate(record)
+	cm.Hooks().OnDelete(record)
+
+	cm.Put("a", 1)
+	cm.Put("a", 2)
+	cm.Delete("a")
+	cm.Delete("a")
+	cm.Compute("b", func(int, bool) (int, bool) { return 3, true })
+	cm.Merge("b", 4, func(old, element int) (int, bool) { return old + element, true })
+	cm.ComputeIfPresent("b", func(int) (int, bool) { return 0, false })
+	cm.Put("c", 5)
+	cm.Clear()
+
+	hm := cm.(*myConcurrentMap[string, int])
+	expected := []Event[string, int]{
+		{Type: EVENT_INSERT, Key: "a", NewElement: 1},
+		{Type: EVENT_UPDATE, Key: "a", OldElement: 1, NewElement: 2},
+		{Type: EVENT_DELETE, Key: "a", OldElement: 2, Reason: REMOVAL_EXPLICIT},
+		{Type: EVENT_INSERT, Key: "b", NewElement: 3},
+		{Type: EVENT_UPDATE, Key: "b", OldElement: 3, NewElement: 7},
+		{Type: EVENT_DELETE, Key: "b", OldElement: 7, Reason: REMOVAL_EXPLICIT},
+		{Type: EVENT_INSERT, Key: "c", NewElement: 5},
+		{Type: EVENT_DELETE, Key: "c", OldElement: 5, Reason: REMOVAL_EXPLICIT},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Inconsistent event number: expected: %d, actual: %d (%v)", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		e.Segment = hm.segmentIndex(hm.hasher.Hash(e.Key))
+		if events[i] != e {
+			t.Fatalf("Inconsistent event #%d: expected: %+v, actual: %+v", i, e, events[i])
+		}
+	}
+}
+
+func TestHooksRemovalReason(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](WithClock(clock), WithConcurrency(1), WithMaxEntries(2))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	reasons := make(map[string]RemovalReason)
+	cm.Hooks().OnDelete(func(event Event[string, int]) {
+		reasons[event.Key] = event.Reason
+	})
+	cm.PutWithTTL("expired", 1, time.Second)
+	cm.Put("evicted", 2)
+	clock.Advance(time.Second)
+	// 过期的键在被再次放入时会先被删除
+	cm.Put("expired", 3)
+	cm.Put("new", 4)
+	cm.Delete("new")
+	expected := map[string]RemovalReason{
+		"expired": REMOVAL_EXPIRED,
+		"evicted": REMOVAL_EVICTED,
+		"new":     REMOVAL_EXPLICIT,
+	}
+	for key, reason := range expected {
+		if reasons[key] != reason {
+			t.Fatalf("Inconsistent removal reason of %q: expected: %s, actual: %s", key, reason, reasons[key])
+		}
+	}
+}
+
+func TestHooksRemove(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var count int
+	remove := cm.Hooks().OnInsert(func(Event[string, int]) { count++ })
+	cm.Put("a", 1)
+	remove()
+	remove()
+	cm.Put("b", 2)
+	if count != 1 {
+		t.Fatalf("Inconsistent hook call count: expected: %d, actual: %d", 1, count)
+	}
+	if !cm.Hooks().insert.empty() {
+		t.Fatal("The insert hook list is not empty after removing, but should be!")
+	}
+}
+
+func TestHooksRedistribute(t *testing.T) {
+	cm, err := New[string, int](
+		WithConcurrency(1),
+		WithBucketNumber(2),
+		WithMaxBucketSize(1),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var events []RedistributionEvent
+	cm.Hooks().OnRedistribute(func(event RedistributionEvent) {
+		events = append(events, event)
+	})
+	for i := 0; i < 100; i++ {
+		cm.Put(strconv.Itoa(i), i)
+	}
+	if len(events) == 0 {
+		t.Fatal("No redistribution event, but should not be the case!")
+	}
+	first := events[0]
+	if first.Segment != 0 || first.OldBucketNumber != 2 || !first.Grow() || first.Time.IsZero() {
+		t.Fatalf("Inconsistent redistribution event: %+v", first)
+	}
+	if growCount := cm.Stats().GrowCount; uint64(len(events)) != growCount {
+		t.Fatalf("Inconsistent redistribution event number: expected: %d, actual: %d", growCount, len(events))
+	}
+}
+
+func TestHooksPanic(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	cm, err := New[string, int](WithLogger(logger))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var called bool
+	cm.Hooks().OnInsert(func(Event[string, int]) { panic("oops") })
+	cm.Hooks().OnInsert(func(Event[string, int]) { called = true })
+	ok, err := cm.Put("a", 1)
+	if !ok || err != nil {
+		t.Fatalf("Couldn't put pair with a panicking hook: ok: %v, error: %v", ok, err)
+	}
+	if !called {
+		t.Fatal("The hook after a panicking one was not called, but should be!")
+	}
+	if !strings.Contains(buf.String(), "cmap: hook panicked") {
+		t.Fatalf("No hook panic log: %s", buf.String())
+	}
+	// 段锁必须已被释放
+	if cm.Get("a") != 1 {
+		t.Fatalf("Inconsistent element: expected: %d, actual: %d", 1, cm.Get("a"))
+	}
+}
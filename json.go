@@ -0,0 +1,190 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// jsonEntry 代表待写入JSON对象的一个成员
+type jsonEntry[K comparable, V any] struct {
+	// name 代表成员的名称,即编码为字符串的键
+	name string
+	// pair 代表成员对应的键-元素对
+	pair Pair[K, V]
+}
+
+// MarshalJSON 将字典编码为JSON对象,json.Marshaler接口方法
+// 键按照encoding/json编码映射键的规则转换为字符串,
+// 即字符串类型、实现了encoding.TextMarshaler的类型、整数类型或动态类型为字符串的接口类型
+// 各散列段依次加锁获取键-元素对,编码时不持有任何段锁,因此不会同时持有所有的段锁,
+// 但结果也不是整个字典在某一时刻的快照
+// 若设置了WithSortedJSONKeys,则成员按名称排序,否则按散列段的顺序逐段写入
+func (cmap *myConcurrentMap[K, V]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	writeEntry := func(name string, p Pair[K, V]) error {
+		element, err := json.Marshal(p.Element())
+		if err != nil {
+			return err
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		quoted, _ := json.Marshal(name)
+		buf.Write(quoted)
+		buf.WriteByte(':')
+		buf.Write(element)
+		return nil
+	}
+	var entries []jsonEntry[K, V]
+	err := cmap.forEachPair(func(p Pair[K, V]) error {
+		name, err := jsonKeyName(p.Key())
+		if err != nil {
+			return err
+		}
+		if cmap.sortedJSONKeys {
+			entries = append(entries, jsonEntry[K, V]{name: name, pair: p})
+			return nil
+		}
+		return writeEntry(name, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cmap.sortedJSONKeys {
+		slices.SortFunc(entries, func(a, b jsonEntry[K, V]) int {
+			if a.name < b.name {
+				return -1
+			}
+			if a.name > b.name {
+				return 1
+			}
+			return 0
+		})
+		for _, e := range entries {
+			if err := writeEntry(e.name, e.pair); err != nil {
+				return nil, err
+			}
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON 将JSON对象中的成员放入字典,json.Unmarshaler接口方法
+// 与encoding/json解码映射时一致,字典中已有的键-元素对会被保留,同名的键会被替换
+// 成员被逐个解码并放入字典,若中途出错,则之前的成员已经放入了字典
+// 若设置了WithJSONValueType,则元素会先被解码为该类型,否则直接解码为元素的类型
+func (cmap *myConcurrentMap[K, V]) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return newIllegalParameterError(fmt.Sprintf("json value is not an object: %v", token))
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, err := parseJSONKey[K](token.(string))
+		if err != nil {
+			return err
+		}
+		element, err := cmap.decodeJSONElement(decoder)
+		if err != nil {
+			return err
+		}
+		if _, err := cmap.Put(key, element); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+// decodeJSONElement 从decoder中解码下一个元素
+func (cmap *myConcurrentMap[K, V]) decodeJSONElement(decoder *json.Decoder) (V, error) {
+	var element V
+	if cmap.jsonValueType == nil {
+		err := decoder.Decode(&element)
+		return element, err
+	}
+	ptr := reflect.New(cmap.jsonValueType)
+	if err := decoder.Decode(ptr.Interface()); err != nil {
+		return element, err
+	}
+	reflect.ValueOf(&element).Elem().Set(ptr.Elem())
+	return element, nil
+}
+
+// jsonKeyName 将键转换为JSON对象成员的名称
+func jsonKeyName[K comparable](key K) (string, error) {
+	v := reflect.ValueOf(&key).Elem()
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	if tm, ok := any(key).(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Interface:
+		if s, ok := v.Interface().(string); ok {
+			return s, nil
+		}
+	}
+	return "", newIllegalParameterError(fmt.Sprintf("unsupported json key: %T", v.Interface()))
+}
+
+// parseJSONKey 将JSON对象成员的名称转换为键,它是jsonKeyName的逆操作
+// 接口类型的键会被解析为字符串
+func parseJSONKey[K comparable](name string) (K, error) {
+	var key K
+	v := reflect.ValueOf(&key).Elem()
+	if v.Kind() == reflect.String {
+		v.SetString(name)
+		return key, nil
+	}
+	if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return key, tu.UnmarshalText([]byte(name))
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := strconv.ParseInt(name, 10, v.Type().Bits())
+		if err != nil {
+			return key, newIllegalParameterError(fmt.Sprintf("illegal json key %q: %s", name, err))
+		}
+		v.SetInt(x)
+		return key, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, err := strconv.ParseUint(name, 10, v.Type().Bits())
+		if err != nil {
+			return key, newIllegalParameterError(fmt.Sprintf("illegal json key %q: %s", name, err))
+		}
+		v.SetUint(x)
+		return key, nil
+	case reflect.Interface:
+		if reflect.TypeOf(name).AssignableTo(v.Type()) {
+			v.Set(reflect.ValueOf(name))
+			return key, nil
+		}
+	}
+	return key, newIllegalParameterError(fmt.Sprintf("unsupported json key type: %s", v.Type()))
+}
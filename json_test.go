@@ -0,0 +1,119 @@
+package cmap
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	cm, err := New[string, int](WithSortedJSONKeys(true))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		cm.Put("key"+strconv.Itoa(i), i)
+	}
+	cm.Put("<b>", 10)
+	data, err := json.Marshal(cm)
+	if err != nil {
+		t.Fatalf("An error occurs when marshalling map: %s", err)
+	}
+	// 与encoding/json一致,HTML字符会被转义
+	expected := `{"\u003cb\u003e":10,"key0":0,"key1":1,"key2":2,"key3":3,"key4":4,"key5":5,"key6":6,"key7":7,"key8":8,"key9":9}`
+	if string(data) != expected {
+		t.Fatalf("Inconsistent json: expected: %s, actual: %s", expected, data)
+	}
+
+	unsorted, _ := New[int, []string]()
+	unsorted.Put(-1, []string{"a"})
+	unsorted.Put(2, nil)
+	data, err = json.Marshal(unsorted)
+	if err != nil {
+		t.Fatalf("An error occurs when marshalling map: %s", err)
+	}
+	var decoded map[int][]string
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("An error occurs when unmarshalling json: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, map[int][]string{-1: {"a"}, 2: nil}) {
+		t.Fatalf("Inconsistent decoded map: %v", decoded)
+	}
+
+	type point struct{ X, Y int }
+	structs, _ := New[point, int]()
+	structs.Put(point{1, 2}, 1)
+	if _, err := json.Marshal(structs); err == nil {
+		t.Fatal("No error when marshalling a struct key, but should not be the case!")
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	cm, _ := New[netip.Addr, int]()
+	cm.Put(netip.MustParseAddr("10.0.0.1"), 1)
+	if err := json.Unmarshal([]byte(`{"10.0.0.2":2,"::1":3}`), cm); err != nil {
+		t.Fatalf("An error occurs when unmarshalling json: %s", err)
+	}
+	if cm.Len() != 3 || cm.Get(netip.MustParseAddr("::1")) != 3 {
+		t.Fatalf("Inconsistent map after unmarshalling: len: %d", cm.Len())
+	}
+	data, err := json.Marshal(cm)
+	if err != nil {
+		t.Fatalf("An error occurs when marshalling map: %s", err)
+	}
+	roundTrip, _ := New[netip.Addr, int]()
+	if err := json.Unmarshal(data, roundTrip); err != nil || roundTrip.Len() != 3 {
+		t.Fatalf("Inconsistent round trip: len: %d, error: %v", roundTrip.Len(), err)
+	}
+	if err := json.Unmarshal([]byte(`null`), cm); err != nil || cm.Len() != 3 {
+		t.Fatalf("Inconsistent map after unmarshalling null: len: %d, error: %v", cm.Len(), err)
+	}
+
+	ints, _ := New[uint8, int]()
+	testCases := map[string]string{
+		"not an object":   `[1]`,
+		"key overflow":    `{"256":1}`,
+		"illegal element": `{"1":"a"}`,
+		"truncated":       `{"1":1`,
+	}
+	for name, data := range testCases {
+		if err := ints.UnmarshalJSON([]byte(data)); err == nil {
+			t.Fatalf("No error when unmarshalling %s json, but should not be the case!", name)
+		}
+	}
+}
+
+func TestUnmarshalJSONValueType(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	cm, err := NewConcurrentMap(2, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	data := []byte(`{"a":{"Name":"alice","Age":30}}`)
+	if err := json.Unmarshal(data, cm); err != nil {
+		t.Fatalf("An error occurs when unmarshalling json: %s", err)
+	}
+	if _, ok := cm.Get("a").(map[string]interface{}); !ok {
+		t.Fatalf("Inconsistent element type without hint: %T", cm.Get("a"))
+	}
+	hinted, err := New[string, interface{}](WithJSONValueType[user]())
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if err := json.Unmarshal(data, hinted); err != nil {
+		t.Fatalf("An error occurs when unmarshalling json: %s", err)
+	}
+	if element := hinted.Get("a"); element != (user{Name: "alice", Age: 30}) {
+		t.Fatalf("Inconsistent element with hint: %#v", element)
+	}
+	_, err = New[string, int](WithJSONValueType[user]())
+	if !errors.As(err, new(IllegalParameterError)) {
+		t.Fatalf("Inconsistent error when the hint is not assignable: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package cmap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MIN_NEGATIVE_SWEEP_SIZE 代表清理过期的加载错误时被缓存的错误数量的最小阈值
+// 每次缓存新的错误时,若缓存的数量达到阈值,则清理所有过期的错误,之后阈值调整为剩余数量的两倍,
+// 因此缓存的数量最多为未过期错误数量的两倍,而清理的均摊开销为常数
+const MIN_NEGATIVE_SWEEP_SIZE int = 64
+
+// loadCall 代表对某个键的一次正在进行的加载
+type loadCall[V any] struct {
+	// done 代表加载完成的信号,加载完成之后会被关闭
+	done chan struct{}
+	// element 代表加载得到的元素,仅在done关闭之后有效
+	element V
+	// err 代表加载的错误,仅在done关闭之后有效
+	err error
+	// waiters 代表仍在等待加载结果的调用方的数量,由loadGroup的互斥锁保护
+	waiters int
+	// cancel 用于在所有调用方都放弃等待之后取消加载
+	cancel context.CancelFunc
+}
+
+// negativeEntry 代表被缓存的加载错误
+type negativeEntry struct {
+	// err 代表加载的错误
+	err error
+	// expiry 代表过期时间(Unix纳秒)
+	expiry int64
+}
+
+// loadGroup 代表字典的加载调度器
+// 它保证同一时刻每个键最多只有一个加载函数在执行
+type loadGroup[K comparable, V any] struct {
+	// calls 代表正在进行的加载
+	calls map[K]*loadCall[V]
+	// negatives 代表被缓存的加载错误
+	negatives map[K]negativeEntry
+	// negativeTTL 代表加载错误的缓存时间,0代表不缓存
+	negativeTTL time.Duration
+	// sweepSize 代表下一次清理过期的加载错误时被缓存的错误数量的阈值
+	sweepSize int
+	// lock 保护以上映射的互斥锁
+	lock sync.Mutex
+}
+
+// newLoadGroup 创建一个loadGroup类型的实例
+func newLoadGroup[K comparable, V any](negativeTTL time.Duration) *loadGroup[K, V] {
+	return &loadGroup[K, V]{
+		calls:       make(map[K]*loadCall[V]),
+		negatives:   make(map[K]negativeEntry),
+		negativeTTL: negativeTTL,
+		sweepSize:   MIN_NEGATIVE_SWEEP_SIZE,
+	}
+}
+
+// GetOrLoad 获取与指定键关联的元素,若键不存在则调用loader加载并放入字典
+// 同一时刻每个键最多只有一个loader在执行,其他调用方会等待并共享它的结果
+// loader返回的错误会原样返回给所有等待的调用方,除非启用了WithNegativeCache,否则不会被缓存
+// 若ctx在加载完成之前被取消,则返回ctx.Err();只有当所有调用方都放弃等待时,传给loader的ctx才会被取消
+// 加载得到的元素通过与PutIfAbsent相同的方式放入字典,因此同样会受到存活时间、容量和成本预算的约束
+// 若加载期间该键已被写入,则保留已写入的元素,并将其返回给所有等待的调用方
+func (cmap *myConcurrentMap[K, V]) GetOrLoad(ctx context.Context, key K,
+	loader func(ctx context.Context) (V, error)) (V, error) {
+	var zero V
+	if loader == nil {
+		return zero, newIllegalParameterError("loader is nil")
+	}
+	if element, ok := cmap.get(key); ok {
+		return element, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	g := cmap.loads
+	g.lock.Lock()
+	if entry, ok := g.negatives[key]; ok {
+		if cmap.clock.Now().UnixNano() < entry.expiry {
+			g.lock.Unlock()
+			return zero, entry.err
+		}
+		delete(g.negatives, key)
+	}
+	call, ok := g.calls[key]
+	if ok {
+		call.waiters++
+	} else {
+		// 加载不应因发起者一方的取消而中止,但仍保留ctx中的值
+		loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &loadCall[V]{
+			done:    make(chan struct{}),
+			waiters: 1,
+			cancel:  cancel,
+		}
+		g.calls[key] = call
+		go cmap.load(loadCtx, key, call, loader)
+	}
+	g.lock.Unlock()
+	select {
+	case <-call.done:
+		return call.element, call.err
+	case <-ctx.Done():
+		g.abandon(key, call)
+		return zero, ctx.Err()
+	}
+}
+
+// load 执行加载函数并将结果放入字典
+// 加载函数引发的恐慌会被转换为LoaderPanicError
+func (cmap *myConcurrentMap[K, V]) load(ctx context.Context, key K, call *loadCall[V],
+	loader func(ctx context.Context) (V, error)) {
+	defer call.cancel()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				call.err = newLoaderPanicError(r)
+			}
+		}()
+		call.element, call.err = loader(ctx)
+	}()
+	// 只缓存加载函数的错误,放入字典时的错误不会被缓存
+	negative := call.err != nil
+	// 所有调用方都已放弃等待时,加载的结果可能已经过时,因此既不放入字典也不缓存错误
+	if ctx.Err() != nil {
+		negative = false
+	} else if call.err == nil {
+		// 加载期间该键有可能已被写入,此时保留已写入的元素,以免用过时的结果覆盖它
+		element, exists, err := cmap.compute(key, func(oldElement V, exists bool) (V, ComputeOperation) {
+			if exists {
+				return oldElement, COMPUTE_NONE
+			}
+			return call.element, COMPUTE_STORE
+		})
+		if err != nil {
+			var zero V
+			call.element, call.err = zero, err
+		} else if exists {
+			call.element = element
+		}
+	}
+	cmap.loads.finish(key, call, negative, cmap.clock)
+	close(call.done)
+}
+
+// finish 移除已完成的加载
+// 若参数negative为true且启用了错误缓存,则缓存加载的错误
+func (g *loadGroup[K, V]) finish(key K, call *loadCall[V], negative bool, clock Clock) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+	if negative && g.negativeTTL > 0 {
+		now := clock.Now().UnixNano()
+		g.negatives[key] = negativeEntry{
+			err:    call.err,
+			expiry: now + int64(g.negativeTTL),
+		}
+		if len(g.negatives) >= g.sweepSize {
+			g.sweepNegatives(now)
+		}
+	}
+}
+
+// sweepNegatives 移除所有在给定时刻(Unix纳秒)已过期的加载错误,并调整下一次清理的阈值
+// 注意!必须在互斥锁的保护下调用本方法
+func (g *loadGroup[K, V]) sweepNegatives(now int64) {
+	for key, entry := range g.negatives {
+		if now >= entry.expiry {
+			delete(g.negatives, key)
+		}
+	}
+	g.sweepSize = max(2*len(g.negatives), MIN_NEGATIVE_SWEEP_SIZE)
+}
+
+// abandon 记录一个调用方放弃等待
+// 若所有调用方都已放弃等待,则取消加载,之后的调用方会发起新的加载
+func (g *loadGroup[K, V]) abandon(key K, call *loadCall[V]) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	call.cancel()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// clearNegatives 移除所有被缓存的加载错误
+func (g *loadGroup[K, V]) clearNegatives() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	clear(g.negatives)
+	g.sweepSize = MIN_NEGATIVE_SWEEP_SIZE
+}
@@ -0,0 +1,201 @@
+package cmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+	number := 50
+	var wg sync.WaitGroup
+	results := make(chan int, number)
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			element, err := cm.GetOrLoad(context.Background(), "a", loader)
+			if err != nil {
+				t.Errorf("An error occurs when loading: %s", err)
+			}
+			results <- element
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+	for element := range results {
+		if element != 42 {
+			t.Fatalf("Inconsistent loaded element: expected: %d, actual: %d", 42, element)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("Inconsistent loader calls: expected: %d, actual: %d", 1, calls.Load())
+	}
+	if cm.Get("a") != 42 {
+		t.Fatalf("The loaded element is not stored: %d", cm.Get("a"))
+	}
+	if _, err := cm.GetOrLoad(context.Background(), "a", loader); err != nil || calls.Load() != 1 {
+		t.Fatalf("The loader is called for an existing key: calls: %d, error: %v", calls.Load(), err)
+	}
+	if _, err := cm.GetOrLoad(context.Background(), "b", nil); err == nil {
+		t.Fatal("No error when loading with a nil loader, but should not be the case!")
+	}
+}
+
+func TestGetOrLoadConcurrentPut(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	result := make(chan int, 1)
+	go func() {
+		element, _ := cm.GetOrLoad(context.Background(), "a", func(ctx context.Context) (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		result <- element
+	}()
+	<-started
+	// 加载期间写入的元素比加载的结果更新,不应被覆盖
+	cm.Put("a", 100)
+	close(release)
+	if element := <-result; element != 100 {
+		t.Fatalf("Inconsistent loaded element: expected: %d, actual: %d", 100, element)
+	}
+	if element := cm.Get("a"); element != 100 {
+		t.Fatalf("The concurrent put is overwritten by the loaded element: %d", element)
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	errLoad := errors.New("load failed")
+	var calls int
+	loader := func(ctx context.Context) (int, error) {
+		calls++
+		return 0, errLoad
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cm.GetOrLoad(context.Background(), "a", loader); err != errLoad {
+			t.Fatalf("Inconsistent error: expected: %v, actual: %v", errLoad, err)
+		}
+	}
+	if calls != 2 || cm.Len() != 0 {
+		t.Fatalf("The loader error is cached: calls: %d, len: %d", calls, cm.Len())
+	}
+	_, err = cm.GetOrLoad(context.Background(), "b", func(ctx context.Context) (int, error) {
+		panic("boom")
+	})
+	var panicErr LoaderPanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Fatalf("Inconsistent error when the loader panics: %v", err)
+	}
+}
+
+func TestGetOrLoadNegativeCache(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](WithClock(clock), WithNegativeCache(time.Second))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	errLoad := errors.New("load failed")
+	var calls int
+	loader := func(ctx context.Context) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, errLoad
+		}
+		return calls, nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cm.GetOrLoad(context.Background(), "a", loader); err != errLoad {
+			t.Fatalf("Inconsistent error: expected: %v, actual: %v", errLoad, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("The loader error is not cached: calls: %d", calls)
+	}
+	clock.Advance(time.Second)
+	if element, err := cm.GetOrLoad(context.Background(), "a", loader); err != nil || element != 2 {
+		t.Fatalf("Couldn't load after the cached error expired: element: %d, error: %v", element, err)
+	}
+}
+
+func TestGetOrLoadNegativeSweep(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[int, int](WithClock(clock), WithNegativeCache(time.Second))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	errLoad := errors.New("load failed")
+	loader := func(ctx context.Context) (int, error) { return 0, errLoad }
+	g := cm.(*myConcurrentMap[int, int]).loads
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 1000; i++ {
+			cm.GetOrLoad(context.Background(), round*1000+i, loader)
+		}
+		clock.Advance(time.Second)
+	}
+	// 每轮的错误都会在下一轮过期,因此缓存的数量不应随轮数增长
+	g.lock.Lock()
+	size := len(g.negatives)
+	g.lock.Unlock()
+	if size > 2*1000 {
+		t.Fatalf("The expired negative entries are not swept: %d", size)
+	}
+}
+
+func TestGetOrLoadCancel(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	loaderCanceled := make(chan struct{})
+	loader := func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		close(loaderCanceled)
+		return 1, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cm.GetOrLoad(ctx, "a", loader); err != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", context.DeadlineExceeded, err)
+	}
+	select {
+	case <-loaderCanceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The loader is not canceled after all callers gave up!")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if cm.Len() != 0 {
+		t.Fatal("The result of an abandoned load is stored, but should not be the case!")
+	}
+	element, err := cm.GetOrLoad(context.Background(), "a", func(ctx context.Context) (int, error) {
+		return 2, nil
+	})
+	if err != nil || element != 2 {
+		t.Fatalf("Couldn't load after an abandoned load: element: %d, error: %v", element, err)
+	}
+}
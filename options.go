@@ -0,0 +1,472 @@
+package cmap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
+	"time"
+)
+
+// PairRedistributorFactory 代表键-元素对再分布器的工厂函数
+// 字典会为每个散列段调用一次该函数,以便各散列段拥有独立的再分布器
+// 参数loadFactor代表装载因子
+// 参数bucketNumber代表散列段初始的散列桶数量
+// 参数maxBucketSize代表单个散列桶的最大尺寸
+type PairRedistributorFactory[K comparable, V any] func(loadFactor float64, bucketNumber int, maxBucketSize uint64) PairRedistributor[K, V]
+
+// Option 代表创建字典时的可选配置项
+type Option func(opts *options) error
+
+// options 代表创建字典时的配置
+type options struct {
+	// concurrency 代表并发量,即散列段的数量
+	concurrency int
+	// bucketNumber 代表每个散列段初始的散列桶数量
+	bucketNumber int
+	// initialCapacity 代表预计容纳的键-元素对总数
+	initialCapacity int
+	// loadFactor 代表装载因子
+	loadFactor float64
+	// maxBucketSize 代表单个散列桶的最大尺寸
+	maxBucketSize uint64
+	// redistributorFactory 代表键-元素对再分布器的工厂函数
+	// 其类型为PairRedistributorFactory[K, V],在创建字典时才会进行类型检查
+	redistributorFactory interface{}
+	// hasher 代表键的哈希函数
+	// 其类型为Hasher[K],在创建字典时才会进行类型检查
+	hasher interface{}
+	// logger 代表日志记录器
+	logger *slog.Logger
+	// ttl 代表键-元素对默认的存活时间,0代表永不过期
+	ttl time.Duration
+	// clock 代表用于判断过期的时钟
+	clock Clock
+	// janitorInterval 代表清理过期键-元素对的间隔时间
+	janitorInterval time.Duration
+	// maxEntries 代表字典能容纳的键-元素对的最大数量,0代表不限制
+	maxEntries int
+	// evictionPolicyFactory 代表淘汰策略的工厂函数
+	// 其类型为EvictionPolicyFactory[K],在创建字典时才会进行类型检查
+	evictionPolicyFactory interface{}
+	// evictionCallback 代表键-元素对被淘汰之后调用的回调函数
+	// 其类型为func(K, V),在创建字典时才会进行类型检查
+	evictionCallback interface{}
+	// maxCost 代表字典中所有键-元素对的成本预算,0代表不限制
+	maxCost int64
+	// cost 代表计算键-元素对成本的函数
+	// 其类型为func(K, V) int64,在创建字典时才会进行类型检查
+	cost interface{}
+	// costOverflowAction 代表写操作超出成本预算时的处理方式
+	costOverflowAction CostOverflowAction
+	// negativeCacheTTL 代表GetOrLoad缓存加载错误的时间,0代表不缓存
+	negativeCacheTTL time.Duration
+	// refreshAfter 代表写入之后多久需要异步刷新,0代表不刷新
+	refreshAfter time.Duration
+	// refreshLoader 代表重新加载元素的函数
+	// 其类型为func(context.Context, K, V) (V, error),在创建字典时才会进行类型检查
+	refreshLoader interface{}
+	// refreshConcurrency 代表最大并发刷新数量
+	refreshConcurrency int
+	// refreshFailureCallback 代表刷新失败时调用的回调函数
+	// 其类型为func(K, error),在创建字典时才会进行类型检查
+	refreshFailureCallback interface{}
+	// wal 代表预写日志的配置,为nil时代表不启用预写日志
+	wal *walConfig
+	// sortedJSONKeys 代表编码为JSON时是否按名称排序成员
+	sortedJSONKeys bool
+	// jsonValueType 代表从JSON解码元素时使用的类型,为nil时代表直接解码为元素的类型
+	jsonValueType reflect.Type
+}
+
+// newOptions 根据给定的配置项生成配置
+func newOptions(opts ...Option) (*options, error) {
+	o := &options{
+		concurrency:        DEFAULT_CONCURRENCY,
+		bucketNumber:       DEFAULT_BUCKET_NUMBER,
+		loadFactor:         DEFAULT_BUCKET_LOAD_FACTOR,
+		maxBucketSize:      DEFAULT_BUCKET_MAX_SIZE,
+		logger:             discardLogger,
+		clock:              systemClock{},
+		janitorInterval:    DEFAULT_JANITOR_INTERVAL,
+		refreshConcurrency: DEFAULT_REFRESH_CONCURRENCY,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// segmentCapacity 返回第index个散列段能容纳的键-元素对的最大数量
+// 容量是按散列段尽量平均地分配的,余数分给索引较小的散列段,因此各散列段的容量之和恰为maxEntries,
+// 但每个散列段至少能容纳1个键-元素对;若为0则代表不限制
+// 参数concurrency代表并发量,调整并发量之后需要重新计算
+func (o *options) segmentCapacity(index int, concurrency int) int {
+	if o.maxEntries <= 0 {
+		return 0
+	}
+	capacity := o.maxEntries / concurrency
+	if index < o.maxEntries%concurrency {
+		capacity++
+	}
+	return max(capacity, 1)
+}
+
+// segmentBucketNumber 返回每个散列段初始的散列桶数量
+// 若设置了预计容量,则保证散列段在容纳相应数量的键-元素对之前不必再分布
+func (o *options) segmentBucketNumber() int {
+	bucketNumber := o.bucketNumber
+	if o.initialCapacity > 0 {
+		perSegment := (o.initialCapacity + o.concurrency - 1) / o.concurrency
+		if needed := bucketNumberFor(perSegment, o.loadFactor); needed > bucketNumber {
+			bucketNumber = needed
+		}
+	}
+	return bucketNumber
+}
+
+// bucketNumberFor 返回容纳pairTotal个键-元素对而不必再分布所需的散列桶数量
+// 散列桶的平均尺寸只取重量阈值的一半,因为各散列桶的尺寸会随机波动,
+// 平均尺寸接近阈值时仍会有相当多的散列桶过重而触发再分布
+func bucketNumberFor(pairTotal int, loadFactor float64) int {
+	return int(math.Ceil(float64(pairTotal) / (BUCKET_MIN_AVERAGE * loadFactor / 2)))
+}
+
+// WithConcurrency 设置并发量,即散列段的数量
+// 为了能以掩码的方式选择散列段,并发量会被向上取整为2的幂
+func WithConcurrency(concurrency int) Option {
+	return func(opts *options) error {
+		if concurrency <= 0 {
+			return newIllegalParameterError("concurrency is too small")
+		}
+		if concurrency > MAX_CONCURRENCY {
+			return newIllegalParameterError("concurrency is too large")
+		}
+		opts.concurrency = ceilPowerOfTwo(concurrency)
+		return nil
+	}
+}
+
+// WithBucketNumber 设置每个散列段初始的散列桶数量
+func WithBucketNumber(bucketNumber int) Option {
+	return func(opts *options) error {
+		if bucketNumber <= 0 {
+			return newIllegalParameterError("bucket number is too small")
+		}
+		opts.bucketNumber = bucketNumber
+		return nil
+	}
+}
+
+// WithInitialCapacity 设置预计容纳的键-元素对总数
+// 字典会据此预先分配足够的散列桶,以避免频繁的再分布
+func WithInitialCapacity(capacity int) Option {
+	return func(opts *options) error {
+		if capacity < 0 {
+			return newIllegalParameterError("initial capacity is negative")
+		}
+		opts.initialCapacity = capacity
+		return nil
+	}
+}
+
+// WithLoadFactor 设置装载因子
+func WithLoadFactor(loadFactor float64) Option {
+	return func(opts *options) error {
+		if math.IsNaN(loadFactor) || math.IsInf(loadFactor, 0) || loadFactor <= 0 {
+			return newIllegalParameterError(fmt.Sprintf("invalid load factor: %v", loadFactor))
+		}
+		opts.loadFactor = loadFactor
+		return nil
+	}
+}
+
+// WithMaxBucketSize 设置单个散列桶的最大尺寸
+func WithMaxBucketSize(maxBucketSize uint64) Option {
+	return func(opts *options) error {
+		if maxBucketSize == 0 {
+			return newIllegalParameterError("max bucket size is too small")
+		}
+		opts.maxBucketSize = maxBucketSize
+		return nil
+	}
+}
+
+// WithRedistributorFactory 设置键-元素对再分布器的工厂函数
+// 工厂函数的键和元素类型必须与所创建字典的类型一致
+func WithRedistributorFactory[K comparable, V any](factory PairRedistributorFactory[K, V]) Option {
+	return func(opts *options) error {
+		if factory == nil {
+			return newIllegalParameterError("redistributor factory is nil")
+		}
+		opts.redistributorFactory = factory
+		return nil
+	}
+}
+
+// WithHasher 设置键的哈希函数
+// 哈希函数的键类型必须与所创建字典的键类型一致
+// 对于面向公网的服务,建议使用NewMapHasher以抵御哈希洪水攻击
+func WithHasher[K comparable](hasher Hasher[K]) Option {
+	return func(opts *options) error {
+		if hasher == nil {
+			return newIllegalParameterError("hasher is nil")
+		}
+		opts.hasher = hasher
+		return nil
+	}
+}
+
+// WithLogger 设置日志记录器
+// 再分布、阈值更新以及再分布器的恐慌等事件会以结构化日志的形式输出,
+// 每条日志都带有散列段索引等属性
+// 默认不记录任何日志
+func WithLogger(logger *slog.Logger) Option {
+	return func(opts *options) error {
+		if logger == nil {
+			return newIllegalParameterError("logger is nil")
+		}
+		opts.logger = logger
+		return nil
+	}
+}
+
+// WithTTL 设置键-元素对默认的存活时间
+// 参数ttl为0时代表永不过期
+func WithTTL(ttl time.Duration) Option {
+	return func(opts *options) error {
+		if ttl < 0 {
+			return newIllegalParameterError("ttl is negative")
+		}
+		opts.ttl = ttl
+		return nil
+	}
+}
+
+// WithClock 设置用于判断过期的时钟
+func WithClock(clock Clock) Option {
+	return func(opts *options) error {
+		if clock == nil {
+			return newIllegalParameterError("clock is nil")
+		}
+		opts.clock = clock
+		return nil
+	}
+}
+
+// WithJanitorInterval 设置在后台清理过期键-元素对的间隔时间
+func WithJanitorInterval(interval time.Duration) Option {
+	return func(opts *options) error {
+		if interval <= 0 {
+			return newIllegalParameterError("janitor interval is too small")
+		}
+		opts.janitorInterval = interval
+		return nil
+	}
+}
+
+// WithMaxEntries 设置字典能容纳的键-元素对的最大数量
+// 容量是按散列段平均分配并独立执行的,当某个散列段超出容量时会依照淘汰策略淘汰其中的键-元素对
+// 因此在键分布不均时,字典实际容纳的键-元素对可能少于maxEntries
+// 每个散列段至少能容纳1个键-元素对,所以当maxEntries小于并发量时,字典最多能容纳并发量个键-元素对,
+// 否则字典容纳的键-元素对不会超过maxEntries
+func WithMaxEntries(maxEntries int) Option {
+	return func(opts *options) error {
+		if maxEntries <= 0 {
+			return newIllegalParameterError("max entries is too small")
+		}
+		opts.maxEntries = maxEntries
+		return nil
+	}
+}
+
+// WithEvictionPolicy 设置淘汰策略的工厂函数
+// 只有在设置了容量限制时才会生效,默认使用NewLRUPolicy
+// 工厂函数的键类型必须与所创建字典的键类型一致
+func WithEvictionPolicy[K comparable](factory EvictionPolicyFactory[K]) Option {
+	return func(opts *options) error {
+		if factory == nil {
+			return newIllegalParameterError("eviction policy factory is nil")
+		}
+		opts.evictionPolicyFactory = factory
+		return nil
+	}
+}
+
+// WithEvictionCallback 设置键-元素对被淘汰之后调用的回调函数
+// 回调函数在持有段锁的情况下被调用,因此不能访问当前字典
+// 回调函数的键和元素类型必须与所创建字典的类型一致
+func WithEvictionCallback[K comparable, V any](fn func(key K, element V)) Option {
+	return func(opts *options) error {
+		if fn == nil {
+			return newIllegalParameterError("eviction callback is nil")
+		}
+		opts.evictionCallback = fn
+		return nil
+	}
+}
+
+// WithMaxCost 设置字典中所有键-元素对的成本预算
+// 成本预算由所有散列段共用,当写操作超出预算时会依照淘汰策略淘汰当前散列段中的键-元素对,
+// 或者依照WithCostOverflowAction的设置拒绝写入
+func WithMaxCost(maxCost int64) Option {
+	return func(opts *options) error {
+		if maxCost <= 0 {
+			return newIllegalParameterError("max cost is too small")
+		}
+		opts.maxCost = maxCost
+		return nil
+	}
+}
+
+// WithCost 设置计算键-元素对成本的函数
+// 只有在设置了成本预算时才会生效,默认使用DefaultCost
+// 该函数在持有段锁的情况下被调用,因此不能访问当前字典
+// 该函数的键和元素类型必须与所创建字典的类型一致
+func WithCost[K comparable, V any](fn func(key K, element V) int64) Option {
+	return func(opts *options) error {
+		if fn == nil {
+			return newIllegalParameterError("cost function is nil")
+		}
+		opts.cost = fn
+		return nil
+	}
+}
+
+// WithCostOverflowAction 设置写操作超出成本预算时的处理方式
+// 默认为COST_OVERFLOW_EVICT
+func WithCostOverflowAction(action CostOverflowAction) Option {
+	return func(opts *options) error {
+		if action != COST_OVERFLOW_EVICT && action != COST_OVERFLOW_REJECT {
+			return newIllegalParameterError(fmt.Sprintf("unknown cost overflow action: %d", action))
+		}
+		opts.costOverflowAction = action
+		return nil
+	}
+}
+
+// WithNegativeCache 设置GetOrLoad缓存加载错误的时间
+// 在此期间对同一个键的GetOrLoad会直接返回被缓存的错误,而不再调用加载函数
+// 放入该键的元素会立即生效,不受被缓存的错误的影响
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(opts *options) error {
+		if ttl <= 0 {
+			return newIllegalParameterError("negative cache ttl is too small")
+		}
+		opts.negativeCacheTTL = ttl
+		return nil
+	}
+}
+
+// WithRefreshAfterWrite 设置写入之后多久需要异步刷新
+// 写入时间早于此时长之前的键-元素对被Get读取时,Get会立即返回旧的元素,并在后台通过WithRefreshLoader设置的函数重新加载
+// 必须同时设置WithRefreshLoader
+func WithRefreshAfterWrite(refreshAfter time.Duration) Option {
+	return func(opts *options) error {
+		if refreshAfter <= 0 {
+			return newIllegalParameterError("refresh after write is too small")
+		}
+		opts.refreshAfter = refreshAfter
+		return nil
+	}
+}
+
+// WithRefreshLoader 设置异步刷新时重新加载元素的函数
+// 参数oldElement为刷新之前的元素
+// 参数ctx的截止时间为调用之后的refreshAfter,超时之后刷新即视为失败并归还刷新名额,
+// 该函数之后返回的结果会被丢弃,因此它应在ctx被取消之后尽快返回
+// 该函数的键和元素类型必须与所创建字典的类型一致
+func WithRefreshLoader[K comparable, V any](loader func(ctx context.Context, key K, oldElement V) (V, error)) Option {
+	return func(opts *options) error {
+		if loader == nil {
+			return newIllegalParameterError("refresh loader is nil")
+		}
+		opts.refreshLoader = loader
+		return nil
+	}
+}
+
+// WithRefreshConcurrency 设置最大并发刷新数量
+// 名额用尽时,需要刷新的键会在之后被读取时再次尝试刷新
+func WithRefreshConcurrency(concurrency int) Option {
+	return func(opts *options) error {
+		if concurrency <= 0 {
+			return newIllegalParameterError("refresh concurrency is too small")
+		}
+		opts.refreshConcurrency = concurrency
+		return nil
+	}
+}
+
+// WithRefreshFailureCallback 设置刷新失败时调用的回调函数
+// 刷新失败时旧的元素会被保留,直到其过期或被下一次刷新替换
+// 回调函数的键类型必须与所创建字典的键类型一致
+func WithRefreshFailureCallback[K comparable](fn func(key K, err error)) Option {
+	return func(opts *options) error {
+		if fn == nil {
+			return newIllegalParameterError("refresh failure callback is nil")
+		}
+		opts.refreshFailureCallback = fn
+		return nil
+	}
+}
+
+// WithWAL 为字典启用预写日志,日志文件位于path
+// 每次成功的写操作都会向日志追加一条记录,创建字典时会重放日志以恢复其内容
+// 元素由codec编解码,非字符串、整数及布尔类型的键也由codec编解码
+// 启用预写日志的字典在不再使用时必须调用Close
+func WithWAL(path string, codec Codec, walOpts ...WALOption) Option {
+	return func(opts *options) error {
+		if path == "" {
+			return newIllegalParameterError("wal path is empty")
+		}
+		if codec == nil {
+			return newIllegalParameterError("wal codec is nil")
+		}
+		config := &walConfig{
+			path:  path,
+			codec: codec,
+			opts: walOptions{
+				syncPolicy:       WAL_SYNC_INTERVAL,
+				syncInterval:     DEFAULT_WAL_SYNC_INTERVAL,
+				compactThreshold: DEFAULT_WAL_COMPACT_THRESHOLD,
+			},
+		}
+		for _, opt := range walOpts {
+			if opt == nil {
+				continue
+			}
+			if err := opt(&config.opts); err != nil {
+				return err
+			}
+		}
+		opts.wal = config
+		return nil
+	}
+}
+
+// WithSortedJSONKeys 设置编码为JSON时是否按名称排序成员
+// 排序需要先收集所有的键-元素对,因此只建议在需要确定输出的场景(如黄金测试)中使用
+func WithSortedJSONKeys(sorted bool) Option {
+	return func(opts *options) error {
+		opts.sortedJSONKeys = sorted
+		return nil
+	}
+}
+
+// WithJSONValueType 设置从JSON解码元素时使用的类型T
+// 它适用于元素类型为接口类型的字典,例如以interface{}为元素类型时,
+// 元素会被解码为T而不是map[string]interface{}
+// 类型T必须可以赋值给元素类型,这会在创建字典时检查
+func WithJSONValueType[T any]() Option {
+	return func(opts *options) error {
+		opts.jsonValueType = reflect.TypeFor[T]()
+		return nil
+	}
+}
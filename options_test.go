@@ -0,0 +1,153 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"testing"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if cm.Concurrency() != DEFAULT_CONCURRENCY {
+		t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d", DEFAULT_CONCURRENCY, cm.Concurrency())
+	}
+	cm, err = New[string, int](
+		WithConcurrency(4),
+		WithBucketNumber(8),
+		WithLoadFactor(0.5),
+		WithMaxBucketSize(10),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if cm.Concurrency() != 4 {
+		t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d", 4, cm.Concurrency())
+	}
+	s := cm.(*myConcurrentMap[string, int]).table.Load().segments[0].(*segment[string, int])
+	if s.bucketsLen != 8 {
+		t.Fatalf("Inconsistent bucket number: expected: %d, actual: %d", 8, s.bucketsLen)
+	}
+	pr := s.pairRedistributor.(*myPairRedistributor[string, int])
+	if pr.loadFactor != 0.5 || pr.maxBucketSize != 10 {
+		t.Fatalf("Inconsistent redistributor: loadFactor: %v, maxBucketSize: %d", pr.loadFactor, pr.maxBucketSize)
+	}
+}
+
+func TestNewWithIllegalOptions(t *testing.T) {
+	testCases := map[string]Option{
+		"concurrency too small":  WithConcurrency(0),
+		"concurrency too large":  WithConcurrency(MAX_CONCURRENCY + 1),
+		"bucket number":          WithBucketNumber(0),
+		"initial capacity":       WithInitialCapacity(-1),
+		"zero load factor":       WithLoadFactor(0),
+		"NaN load factor":        WithLoadFactor(math.NaN()),
+		"infinite load factor":   WithLoadFactor(math.Inf(1)),
+		"max bucket size":        WithMaxBucketSize(0),
+		"nil factory":            WithRedistributorFactory[string, int](nil),
+		"mismatched factory key": WithRedistributorFactory(newDefaultPairRedistributor[int, int]),
+		"negative ttl":           WithTTL(-1),
+		"nil clock":              WithClock(nil),
+		"janitor interval":       WithJanitorInterval(0),
+		"max entries":            WithMaxEntries(0),
+		"nil eviction policy":    WithEvictionPolicy[string](nil),
+		"mismatched callback":    WithEvictionCallback(func(int, int) {}),
+		"max cost":               WithMaxCost(0),
+		"nil cost function":      WithCost[string, int](nil),
+		"mismatched cost":        WithCost(func(int, int) int64 { return 0 }),
+		"cost overflow action":   WithCostOverflowAction(2),
+		"negative cache ttl":     WithNegativeCache(0),
+		"refresh after write":    WithRefreshAfterWrite(0),
+		"nil refresh loader":     WithRefreshLoader[string, int](nil),
+		"refresh concurrency":    WithRefreshConcurrency(0),
+		"refresh callback type":  WithRefreshFailureCallback(func(int, error) {}),
+		"empty wal path":         WithWAL("", jsonTestCodec{}),
+		"nil wal codec":          WithWAL("cmap.wal", nil),
+		"wal sync policy":        WithWAL("cmap.wal", jsonTestCodec{}, WithWALSyncPolicy(3)),
+		"wal sync interval":      WithWAL("cmap.wal", jsonTestCodec{}, WithWALSyncInterval(0)),
+		"wal compact threshold":  WithWAL("cmap.wal", jsonTestCodec{}, WithWALCompactThreshold(0)),
+	}
+	for name, opt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New[string, int](opt)
+			if err == nil {
+				t.Fatal("No error when new a concurrent map with an illegal option, but should not be the case!")
+			}
+			if _, ok := err.(IllegalParameterError); !ok {
+				t.Fatalf("Inconsistent error type: expected: %T, actual: %T", IllegalParameterError{}, err)
+			}
+		})
+	}
+}
+
+func TestNewWithInitialCapacity(t *testing.T) {
+	concurrency := 4
+	capacity := 100000
+	cm, err := New[int, int](WithConcurrency(concurrency), WithInitialCapacity(capacity))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	s := cm.(*myConcurrentMap[int, int]).table.Load().segments[0].(*segment[int, int])
+	if s.bucketsLen*int(BUCKET_MIN_AVERAGE*DEFAULT_BUCKET_LOAD_FACTOR) < capacity/concurrency {
+		t.Fatalf("Too few buckets for the initial capacity: %d (capacity: %d)", s.bucketsLen, capacity)
+	}
+}
+
+func TestNewWithRedistributorFactory(t *testing.T) {
+	var count int
+	cm, err := New[string, int](
+		WithConcurrency(4),
+		WithRedistributorFactory(func(loadFactor float64, bucketNumber int, maxBucketSize uint64) PairRedistributor[string, int] {
+			count++
+			return newDefaultPairRedistributor[string, int](loadFactor, bucketNumber, maxBucketSize)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if count != cm.Concurrency() {
+		t.Fatalf("Inconsistent factory calls: expected: %d, actual: %d", cm.Concurrency(), count)
+	}
+	if _, err := cm.Put("key", 1); err != nil {
+		t.Fatalf("An error occurs when putting a key-element to the cmap: %s", err)
+	}
+}
+
+func TestNewWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	cm, err := New[int, int](WithConcurrency(2), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i := 0; i < 10000; i++ {
+		_, _ = cm.Put(i, i)
+	}
+	levels := make(map[string]int)
+	messages := make(map[string]int)
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("An error occurs when decoding the log record: %s", err)
+		}
+		if _, ok := record["segment"]; !ok {
+			t.Fatalf("No segment attribute in log record: %v", record)
+		}
+		levels[record["level"].(string)]++
+		messages[record["msg"].(string)]++
+	}
+	if messages["cmap: threshold updated"] == 0 || messages["cmap: segment redistributed"] == 0 {
+		t.Fatalf("Missing log records: %v", messages)
+	}
+	if levels["INFO"] != messages["cmap: segment redistributed"] {
+		t.Fatalf("Inconsistent log levels: %v", levels)
+	}
+	if _, err := New[int, int](WithLogger(nil)); err == nil {
+		t.Fatal("No error when new a concurrent map with a nil logger, but should not be the case!")
+	}
+}
@@ -4,123 +4,198 @@ import (
 	"bytes"
 	"fmt"
 	"sync/atomic"
-	"unsafe"
+	"time"
 )
 
 // linkedPair 代表单向链接的键-元素对接口
-type linkedPair interface {
+type linkedPair[K comparable, V any] interface {
 	// Next 用于获得下一个键-元素对
 	// 若返回值为nil,则说明当前已在单链表的末尾
-	Next() Pair
+	Next() Pair[K, V]
 	// SetNext 用于设置一个键-元素对
 	// 这样就可以形成一个键-元素对的单键表
-	SetNext(nextPair Pair) error
+	SetNext(nextPair Pair[K, V]) error
 }
 
 // Pair 代表并发安全的键-元素对的接口
-type Pair interface {
+type Pair[K comparable, V any] interface {
 	// linkedPair 代表单链键-元素对接口
-	linkedPair
+	linkedPair[K, V]
 	// Key 返回键的值
-	Key() string
+	Key() K
 	// Hash 返回键的哈希值
 	Hash() uint64
 	// Element 返回元素的值
-	Element() interface{}
+	Element() V
 	// SetElement 设置元素的值
-	SetElement(element interface{}) error
+	SetElement(element V) error
+	// Expiry 返回过期时间(Unix纳秒)
+	// 若返回值为0,则说明永不过期
+	Expiry() int64
+	// SetExpiry 设置过期时间(Unix纳秒),0代表永不过期
+	SetExpiry(expiry int64)
+	// TTL 返回放入时指定的存活时间
+	// 若返回值为0,则说明永不过期或存活时间未知(例如从快照中恢复的键-元素对)
+	TTL() time.Duration
+	// SetTTL 设置放入时指定的存活时间
+	SetTTL(ttl time.Duration)
+	// Cost 返回键-元素对的成本
+	Cost() int64
+	// SetCost 设置键-元素对的成本
+	SetCost(cost int64)
+	// Written 返回最近一次写入元素的时间(Unix纳秒)
+	// 若返回值为0,则说明未记录写入时间
+	Written() int64
+	// SetWritten 设置最近一次写入元素的时间(Unix纳秒)
+	SetWritten(written int64)
 	// Copy 生成一个当前键-元素对的副本并返回
-	Copy() Pair
+	Copy() Pair[K, V]
 	// String 返回当前键-元素对的字符串表示形式
 	String() string
 }
 
 // pair 代表键-元素对的类型
-type pair struct {
-	key     string
+type pair[K comparable, V any] struct {
+	key     K
 	hash    uint64 //代表键的哈希值
-	element unsafe.Pointer
-	next    unsafe.Pointer
+	element atomic.Pointer[V]
+	expiry  atomic.Int64 //代表过期时间(Unix纳秒),0代表永不过期
+	ttl     atomic.Int64 //代表放入时指定的存活时间,0代表永不过期或未知
+	cost    atomic.Int64 //代表键-元素对的成本
+	written atomic.Int64 //代表最近一次写入元素的时间(Unix纳秒),0代表未记录
+	next    atomic.Pointer[pair[K, V]]
 }
 
 // newPair 创建一个Pair类型的实例
-func newPair(key string, element interface{}) (Pair, error) {
-	p := &pair{key: key, hash: hash(key)}
-	if element == nil {
+// 注意!参数keyHash应该是由字典的Hasher基于参数key计算得出哈希值
+func newPair[K comparable, V any](key K, keyHash uint64, element V) (Pair[K, V], error) {
+	p := &pair[K, V]{key: key, hash: keyHash}
+	if isNil(element) {
 		return nil, newIllegalParameterError("element is nil")
 	}
-	p.element = unsafe.Pointer(&element)
+	p.element.Store(&element)
 	return p, nil
 }
 
 // Key 返回键的值
-func (p *pair) Key() string {
+func (p *pair[K, V]) Key() K {
 	return p.key
 }
 
 // Hash 返回键的哈希值
-func (p *pair) Hash() uint64 {
+func (p *pair[K, V]) Hash() uint64 {
 	return p.hash
 }
 
 // Element 返回元素的值
-func (p *pair) Element() interface{} {
-	pointer := atomic.LoadPointer(&p.element)
+// 若元素未设置,则返回V的零值
+func (p *pair[K, V]) Element() V {
+	pointer := p.element.Load()
 	if pointer == nil {
-		return nil
+		var zero V
+		return zero
 	}
-	return *(*interface{})(pointer)
+	return *pointer
 }
 
 // SetElement 设置元素的值
-func (p *pair) SetElement(element interface{}) error {
-	if element == nil {
+func (p *pair[K, V]) SetElement(element V) error {
+	if isNil(element) {
 		return newIllegalParameterError("element is nil")
 	}
-	atomic.StorePointer(&p.element, unsafe.Pointer(&element))
+	p.element.Store(&element)
 	return nil
 }
 
+// Expiry 返回过期时间(Unix纳秒)
+// 若返回值为0,则说明永不过期
+func (p *pair[K, V]) Expiry() int64 {
+	return p.expiry.Load()
+}
+
+// SetExpiry 设置过期时间(Unix纳秒),0代表永不过期
+func (p *pair[K, V]) SetExpiry(expiry int64) {
+	p.expiry.Store(expiry)
+}
+
+// TTL 返回放入时指定的存活时间
+// 若返回值为0,则说明永不过期或存活时间未知(例如从快照中恢复的键-元素对)
+func (p *pair[K, V]) TTL() time.Duration {
+	return time.Duration(p.ttl.Load())
+}
+
+// SetTTL 设置放入时指定的存活时间
+func (p *pair[K, V]) SetTTL(ttl time.Duration) {
+	p.ttl.Store(int64(ttl))
+}
+
+// Cost 返回键-元素对的成本
+func (p *pair[K, V]) Cost() int64 {
+	return p.cost.Load()
+}
+
+// SetCost 设置键-元素对的成本
+func (p *pair[K, V]) SetCost(cost int64) {
+	p.cost.Store(cost)
+}
+
+// Written 返回最近一次写入元素的时间(Unix纳秒)
+// 若返回值为0,则说明未记录写入时间
+func (p *pair[K, V]) Written() int64 {
+	return p.written.Load()
+}
+
+// SetWritten 设置最近一次写入元素的时间(Unix纳秒)
+func (p *pair[K, V]) SetWritten(written int64) {
+	p.written.Store(written)
+}
+
 // Next 用于获得下一个键-元素对
 // 若返回值为nil,则说明当前已在单链表的末尾
-func (p *pair) Next() Pair {
-	pointer := atomic.LoadPointer(&p.next)
+func (p *pair[K, V]) Next() Pair[K, V] {
+	pointer := p.next.Load()
 	if pointer == nil {
 		return nil
 	}
-	return (*pair)(pointer)
+	return pointer
 }
 
 // SetNext 用于设置一个键-元素对
 // 这样就可以形成一个键-元素对的单键表
-func (p *pair) SetNext(nextPair Pair) error {
+func (p *pair[K, V]) SetNext(nextPair Pair[K, V]) error {
 	if nextPair == nil {
-		atomic.StorePointer(&p.next, nil)
+		p.next.Store(nil)
+		return nil
 	}
-	pp, ok := nextPair.(*pair)
+	pp, ok := nextPair.(*pair[K, V])
 	if !ok {
 		return newIllegalPairTypeError(nextPair)
 	}
-	atomic.StorePointer(&p.next, unsafe.Pointer(pp))
+	p.next.Store(pp)
 	return nil
 }
 
 // Copy 生成一个当前键-元素对的副本并返回
-func (p *pair) Copy() Pair {
-	pCopy, _ := newPair(p.key, p.Element())
+func (p *pair[K, V]) Copy() Pair[K, V] {
+	pCopy := &pair[K, V]{key: p.key, hash: p.hash}
+	pCopy.element.Store(p.element.Load())
+	pCopy.expiry.Store(p.expiry.Load())
+	pCopy.ttl.Store(p.ttl.Load())
+	pCopy.cost.Store(p.cost.Load())
+	pCopy.written.Store(p.written.Load())
 	return pCopy
 }
 
 // String 返回当前键-元素对的字符串表示形式
-func (p *pair) String() string {
+func (p *pair[K, V]) String() string {
 	return p.genString(false)
 }
 
 // genString 用于生成并返回当前键-元素对的字符形式
-func (p *pair) genString(nextDetail bool) string {
+func (p *pair[K, V]) genString(nextDetail bool) string {
 	var buf bytes.Buffer
 	buf.WriteString("pair{key:")
-	buf.WriteString(p.Key())
+	buf.WriteString(fmt.Sprintf("%v", p.Key()))
 	buf.WriteString(",hash:")
 	buf.WriteString(fmt.Sprintf("%d", p.Hash()))
 	buf.WriteString(", element:")
@@ -128,7 +203,7 @@ func (p *pair) genString(nextDetail bool) string {
 	if nextDetail {
 		buf.WriteString(", next:")
 		if next := p.Next(); next != nil {
-			if npp, ok := next.(*pair); ok {
+			if npp, ok := next.(*pair[K, V]); ok {
 				buf.WriteString(npp.genString(nextDetail))
 			} else {
 				buf.WriteString("<ignore>")
@@ -137,7 +212,7 @@ func (p *pair) genString(nextDetail bool) string {
 	} else {
 		buf.WriteString(", nextKey:")
 		if next := p.Next(); next != nil {
-			buf.WriteString(next.Key())
+			buf.WriteString(fmt.Sprintf("%v", next.Key()))
 		}
 	}
 	buf.WriteString("}")
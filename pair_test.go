@@ -20,7 +20,7 @@ func TestPairNew(t *testing.T) {
 	testCases[0] = &KeyElement{"", randElement()}
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("Key=%s,Element=%#v", tc.key, tc.element), func(t *testing.T) {
-			p, err := newPair(tc.key, tc.element)
+			p, err := newPair(tc.key, hash(tc.key), tc.element)
 			if err != nil {
 				t.Fatalf("An error occurs when new a pair: %s (key: %s, element: %#v)", err, tc.key, tc.element)
 			}
@@ -35,7 +35,7 @@ func TestPairKeyAndHashElement(t *testing.T) {
 	testCases := genTestingKeyElementSlice(30)
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("Key=%s,Element=%#v", tc.key, tc.element), func(t *testing.T) {
-			p, err := newPair(tc.key, tc.element)
+			p, err := newPair(tc.key, hash(tc.key), tc.element)
 			if err != nil {
 				t.Fatalf("An error occurs when new a pair: %s (key: %s, element: %#v)", err, tc.key, tc.element)
 			}
@@ -57,7 +57,7 @@ func TestPairSet(t *testing.T) {
 	testCases := genTestingKeyElementSlice(30)
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("Key=%s,Element:%#v", tc.key, tc.element), func(t *testing.T) {
-			p, err := newPair(tc.key, tc.element)
+			p, err := newPair(tc.key, hash(tc.key), tc.element)
 			if err != nil {
 				t.Fatalf("An error occurs when new a pair: %s (key:%s, element: %#v)", err, tc.key, tc.element)
 			}
@@ -73,10 +73,10 @@ func TestPairSet(t *testing.T) {
 func TestPairNext(t *testing.T) {
 	number := 30
 	testCases := genTestingKeyElementSlice(number)
-	var current, prev Pair
+	var current, prev Pair[string, interface{}]
 	var err error
 	for _, tc := range testCases {
-		current, err = newPair(tc.key, tc.element)
+		current, err = newPair(tc.key, hash(tc.key), tc.element)
 		if err != nil {
 			t.Fatalf("An error occurs when new a pair: %s (key:%s,element:%#v)", err, tc.key, tc.element)
 		}
@@ -111,7 +111,7 @@ func TestPairCopy(t *testing.T) {
 	testCases := genTestingKeyElementSlice(30)
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("Key=%s,Element=%#v", tc.key, tc.element), func(t *testing.T) {
-			p, err := newPair(tc.key, tc.element)
+			p, err := newPair(tc.key, hash(tc.key), tc.element)
 			if err != nil {
 				t.Fatalf("An error occurs when new a pair: %s (key: %s, element: %#v)", err, tc.key, tc.element)
 			}
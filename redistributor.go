@@ -1,6 +1,8 @@
 package cmap
 
 import (
+	"context"
+	"log/slog"
 	"sync/atomic"
 )
 
@@ -16,21 +18,24 @@ const (
 	BUCKET_STATUS_OVERWEIGHT BucketStatus = 2
 )
 
-//
-//
-type PairRedistributor interface {
+// PairRedistributor 代表针对键-元素对的再分布器
+// 用于当散列段内的键-元素对分布不均时进行重新分布
+type PairRedistributor[K comparable, V any] interface {
 	// UpdateThreshold 根据键-元素对总数和散列桶总数计算并更新阈值
 	UpdateThreshold(pairTotal uint64, bucketNumber int)
 	// CheckBucketStatus 用于检查散列桶的状态
 	CheckBucketStatus(pairTotal uint64, bucketSize uint64) (bucketStatus BucketStatus)
 	// Redistribe 用于实施键-元素对的再分布
-	Redistribe(bucketStatus BucketStatus, buckets []Bucket) (newBuckets []Bucket, changed bool)
+	Redistribe(bucketStatus BucketStatus, buckets []Bucket[K, V]) (newBuckets []Bucket[K, V], changed bool)
 }
 
 // myPairRedistributor 代表PairRedistributor的默认实现类型
-type myPairRedistributor struct {
+type myPairRedistributor[K comparable, V any] struct {
 	// loadFactor 代表装载因子
 	loadFactor float64
+	// maxBucketSize 代表单个散列桶的最大尺寸
+	// 当某个散列桶的尺寸超过此值时一定会被视为过重
+	maxBucketSize uint64
 	// upperThreshold 代表散列桶重量的上阈值
 	// 当某个散列桶的尺寸增至此值时会触发再散列
 	upperThreshold uint64
@@ -38,62 +43,69 @@ type myPairRedistributor struct {
 	overweightBucketCount uint64
 	// emptyBucketCount 代表空的散列桶的计数
 	emptyBucketCount uint64
+	// logger 代表日志记录器
+	logger *slog.Logger
 }
 
 // newDefaultPairRedistributor 创建一个PairRedistributor类型的实例
 // 参数loadFactor代表散列桶的负载因子
 // 参数bucketNumber代表散列桶的数量
-func newDefaultPairRedistributor(loadFactor float64, bucketNumber int) PairRedistributor {
+// 参数maxBucketSize代表单个散列桶的最大尺寸
+func newDefaultPairRedistributor[K comparable, V any](loadFactor float64, bucketNumber int, maxBucketSize uint64) PairRedistributor[K, V] {
+	return newLoggingPairRedistributor[K, V](loadFactor, bucketNumber, maxBucketSize, nil)
+}
+
+// newLoggingPairRedistributor 创建一个带有日志记录器的PairRedistributor类型的实例
+// 参数logger可以为nil,此时不记录任何日志
+func newLoggingPairRedistributor[K comparable, V any](loadFactor float64, bucketNumber int, maxBucketSize uint64,
+	logger *slog.Logger) PairRedistributor[K, V] {
 	if loadFactor <= 0 {
 		loadFactor = DEFAULT_BUCKET_LOAD_FACTOR
 	}
-	pr := &myPairRedistributor{}
+	if maxBucketSize == 0 {
+		maxBucketSize = DEFAULT_BUCKET_MAX_SIZE
+	}
+	if logger == nil {
+		logger = discardLogger
+	}
+	pr := &myPairRedistributor[K, V]{}
 	pr.loadFactor = loadFactor
+	pr.maxBucketSize = maxBucketSize
+	pr.logger = logger
 	pr.UpdateThreshold(0, bucketNumber)
 	return pr
 }
 
-// bucketCountTemplate 代表调试用散列桶状态信息模板
-var bucketCountTemplate = `Bucket count:
-	pairTotal: %d
-	bucketNumber: %d
-	average: %f
-	upperThreshold: %d
-	emptyBucketCount: %d
-`
-
 // UpdateThreshold 根据键-元素对总数和散列桶总数计算并更新阈值
-func (pr *myPairRedistributor) UpdateThreshold(pairTotal uint64, bucketNumber int) {
+func (pr *myPairRedistributor[K, V]) UpdateThreshold(pairTotal uint64, bucketNumber int) {
 	var average float64
 	average = float64(pairTotal / uint64(bucketNumber))
-	if average < 100 {
-		average = 100
+	if average < BUCKET_MIN_AVERAGE {
+		average = BUCKET_MIN_AVERAGE
+	}
+	upperThreshold := uint64(average * pr.loadFactor)
+	atomic.StoreUint64(&pr.upperThreshold, upperThreshold)
+	if pr.logger.Enabled(context.Background(), slog.LevelDebug) {
+		pr.logger.LogAttrs(context.Background(), slog.LevelDebug, "cmap: threshold updated",
+			slog.Uint64("pair_total", pairTotal),
+			slog.Int("bucket_number", bucketNumber),
+			slog.Float64("average", average),
+			slog.Uint64("upper_threshold", upperThreshold))
 	}
-	defer func() {
-		logMsg(bucketCountTemplate, pairTotal, bucketNumber, average,
-			atomic.LoadUint64(&pr.upperThreshold), atomic.LoadUint64(&pr.emptyBucketCount))
-	}()
-	atomic.StoreUint64(&pr.upperThreshold, uint64(average*pr.loadFactor))
 }
 
-var bucketStatusTemplate = `Check bucket status:
-	pairTotal: %d
-	bucketSize: %d
-	upperThreshold: %d
-	overweightBucketCount: %d
-	emptyBucketCount: %d
-	bucketStatus: %d
-`
-
 // CheckBucketStatus 用于检查散列桶的状态
-func (pr *myPairRedistributor) CheckBucketStatus(pairTotal uint64, bucketSize uint64) (bucketStatus BucketStatus) {
-	defer func() {
-		logMsg(bucketStatusTemplate, pairTotal, bucketSize, atomic.LoadUint64(&pr.upperThreshold),
-			atomic.LoadUint64(&pr.overweightBucketCount), atomic.LoadUint64(&pr.emptyBucketCount), bucketStatus)
-	}()
-	if bucketSize > DEFAULT_BUCKET_MAX_SIZE || bucketSize >= atomic.LoadUint64(&pr.upperThreshold) {
-		atomic.AddUint64(&pr.overweightBucketCount, 1)
+func (pr *myPairRedistributor[K, V]) CheckBucketStatus(pairTotal uint64, bucketSize uint64) (bucketStatus BucketStatus) {
+	if bucketSize > pr.maxBucketSize || bucketSize >= atomic.LoadUint64(&pr.upperThreshold) {
+		overweightBucketCount := atomic.AddUint64(&pr.overweightBucketCount, 1)
 		bucketStatus = BUCKET_STATUS_OVERWEIGHT
+		if pr.logger.Enabled(context.Background(), slog.LevelDebug) {
+			pr.logger.LogAttrs(context.Background(), slog.LevelDebug, "cmap: bucket overweight",
+				slog.Uint64("pair_total", pairTotal),
+				slog.Uint64("bucket_size", bucketSize),
+				slog.Uint64("upper_threshold", atomic.LoadUint64(&pr.upperThreshold)),
+				slog.Uint64("overweight_bucket_count", overweightBucketCount))
+		}
 		return
 	}
 	if bucketSize == 0 {
@@ -102,20 +114,10 @@ func (pr *myPairRedistributor) CheckBucketStatus(pairTotal uint64, bucketSize ui
 	return
 }
 
-// redistributionTemplate 代表重新分配信息模板
-var redistributionTemplate = `Redistributing:
-	bucketStatus: %d
-	bucketNumber: %d
-	newNumber: %d
-`
-
 // Redistribe 用于实施键-元素对的再分布
-func (pr *myPairRedistributor) Redistribe(bucketStatus BucketStatus, buckets []Bucket) (newBuckets []Bucket, changed bool) {
+func (pr *myPairRedistributor[K, V]) Redistribe(bucketStatus BucketStatus, buckets []Bucket[K, V]) (newBuckets []Bucket[K, V], changed bool) {
 	currentNumber := uint64(len(buckets))
 	newNumber := currentNumber
-	defer func() {
-		logMsg(redistributionTemplate, bucketStatus, currentNumber, newNumber)
-	}()
 	//扩张或裁减散桶的大小
 	switch bucketStatus {
 	case BUCKET_STATUS_OVERWEIGHT:
@@ -141,11 +143,12 @@ func (pr *myPairRedistributor) Redistribe(bucketStatus BucketStatus, buckets []B
 		return nil, false
 	}
 	//重新分配键-元素对
-	var pairs []Pair
+	var pairs []Pair[K, V]
 	//复制到副本
+	//这里不能复用原有的键-元素对,否则会修改其链接,破坏正在被迭代的单链表
 	for _, b := range buckets {
 		for e := b.GetFirstPair(); e != nil; e = e.Next() {
-			pairs = append(pairs, e)
+			pairs = append(pairs, e.Copy())
 		}
 	}
 	//清空所有的原散列桶
@@ -155,13 +158,13 @@ func (pr *myPairRedistributor) Redistribe(bucketStatus BucketStatus, buckets []B
 		}
 		//扩展新桶
 		for j := newNumber - currentNumber; j > 0; j-- {
-			buckets = append(buckets, newBucket())
+			buckets = append(buckets, newBucket[K, V]())
 		}
 	} else {
 		//裁减原桶
-		buckets = make([]Bucket, newNumber)
+		buckets = make([]Bucket[K, V], newNumber)
 		for i := uint64(0); i < newNumber; i++ {
-			buckets[i] = newBucket()
+			buckets[i] = newBucket[K, V]()
 		}
 	}
 	var count int
@@ -174,5 +177,12 @@ func (pr *myPairRedistributor) Redistribe(bucketStatus BucketStatus, buckets []B
 	}
 	atomic.StoreUint64(&pr.overweightBucketCount, 0)
 	atomic.StoreUint64(&pr.emptyBucketCount, 0)
+	if pr.logger.Enabled(context.Background(), slog.LevelDebug) {
+		pr.logger.LogAttrs(context.Background(), slog.LevelDebug, "cmap: pairs redistributed",
+			slog.Int("bucket_status", int(bucketStatus)),
+			slog.Uint64("bucket_number", currentNumber),
+			slog.Uint64("new_bucket_number", newNumber),
+			slog.Int("pair_total", count))
+	}
 	return buckets, true
 }
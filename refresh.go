@@ -0,0 +1,153 @@
+package cmap
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DEFAULT_REFRESH_CONCURRENCY 代表默认的最大并发刷新数量
+const DEFAULT_REFRESH_CONCURRENCY int = 4
+
+// refresher 代表字典的异步刷新器
+// 写入时间早于refreshAfter之前的键-元素对被Get读取时,会在后台重新加载,而Get仍立即返回旧的元素
+type refresher[K comparable, V any] struct {
+	// after 代表写入之后多久需要刷新
+	after time.Duration
+	// loader 代表重新加载元素的函数
+	loader func(ctx context.Context, key K, oldElement V) (V, error)
+	// onFailure 代表刷新失败时调用的回调函数,可以为nil
+	onFailure func(key K, err error)
+	// logger 代表日志记录器
+	logger *slog.Logger
+	// slots 代表刷新的并发名额,其容量即最大并发刷新数量
+	slots chan struct{}
+	// pending 代表正在刷新的键
+	pending map[K]struct{}
+	// lock 保护pending的互斥锁
+	lock sync.Mutex
+}
+
+// newRefresher 创建一个refresher类型的实例
+func newRefresher[K comparable, V any](after time.Duration, loader func(ctx context.Context, key K, oldElement V) (V, error),
+	concurrency int, onFailure func(key K, err error), logger *slog.Logger) *refresher[K, V] {
+	return &refresher[K, V]{
+		after:     after,
+		loader:    loader,
+		onFailure: onFailure,
+		logger:    logger,
+		slots:     make(chan struct{}, concurrency),
+		pending:   make(map[K]struct{}),
+	}
+}
+
+// stale 判断键-元素对是否需要刷新
+func (r *refresher[K, V]) stale(p Pair[K, V], now time.Time) bool {
+	written := p.Written()
+	return written != 0 && now.UnixNano()-written >= int64(r.after)
+}
+
+// acquire 为指定的键获取一个刷新名额
+// 若该键正在刷新或名额已用尽,则返回false,该键会在之后被读取时再次尝试刷新
+func (r *refresher[K, V]) acquire(key K) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.pending[key]; ok {
+		return false
+	}
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		return false
+	}
+	r.pending[key] = struct{}{}
+	return true
+}
+
+// release 归还指定键的刷新名额
+func (r *refresher[K, V]) release(key K) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.pending, key)
+	<-r.slots
+}
+
+// refreshResult 代表一次重新加载的结果
+type refreshResult[V any] struct {
+	element V
+	err     error
+}
+
+// load 调用加载函数,最多等待refreshAfter
+// 超时之后返回ctx.Err(),以免挂起的加载函数一直占用刷新名额,
+// 此时加载函数仍在后台执行,但其结果会被丢弃
+func (r *refresher[K, V]) load(key K, oldElement V) (V, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.after)
+	defer cancel()
+	done := make(chan refreshResult[V], 1)
+	go func() {
+		element, err := r.call(ctx, key, oldElement)
+		done <- refreshResult[V]{element: element, err: err}
+	}()
+	select {
+	case result := <-done:
+		return result.element, result.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// call 调用加载函数,加载函数引发的恐慌会被转换为LoaderPanicError
+func (r *refresher[K, V]) call(ctx context.Context, key K, oldElement V) (element V, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = newLoaderPanicError(p)
+		}
+	}()
+	return r.loader(ctx, key, oldElement)
+}
+
+// fail 报告刷新失败
+func (r *refresher[K, V]) fail(key K, err error) {
+	if r.onFailure == nil {
+		return
+	}
+	callHook(func(err error) { r.onFailure(key, err) }, err, func(p interface{}) {
+		r.logger.Error("cmap: refresh failure callback panicked", slog.Any("panic", p))
+	})
+}
+
+// maybeRefresh 若键-元素对需要刷新,则在后台重新加载它
+func (cmap *myConcurrentMap[K, V]) maybeRefresh(p Pair[K, V]) {
+	r := cmap.refresher
+	if !r.stale(p, cmap.clock.Now()) || !r.acquire(p.Key()) {
+		return
+	}
+	go cmap.refresh(p.Key(), p.Hash(), p.Element(), p.Written())
+}
+
+// refresh 重新加载指定键的元素
+// 仅当该键在刷新期间没有被写入或删除时,才会放入新的元素
+// 新的元素沿用该键自身的存活时间并重新开始计时,因此被频繁读取的键不会因过期而阻塞调用方
+func (cmap *myConcurrentMap[K, V]) refresh(key K, keyHash uint64, oldElement V, written int64) {
+	r := cmap.refresher
+	defer r.release(key)
+	element, err := r.load(key, oldElement)
+	if err != nil {
+		r.fail(key, err)
+		return
+	}
+	p, err := newPair(key, keyHash, element)
+	if err != nil {
+		r.fail(key, err)
+		return
+	}
+	s, gate := cmap.enterSegment(keyHash)
+	_, err = s.Refresh(p, written)
+	gate.RUnlock()
+	if err != nil {
+		r.fail(key, err)
+	}
+}
@@ -0,0 +1,210 @@
+package cmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询直到cond返回true或超时
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRefreshAfterWrite(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	var calls atomic.Int32
+	cm, err := New[string, int](
+		WithClock(clock),
+		WithRefreshAfterWrite(time.Minute),
+		WithRefreshLoader(func(ctx context.Context, key string, oldElement int) (int, error) {
+			calls.Add(1)
+			<-release
+			return oldElement + 1, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.Put("a", 1)
+	if cm.Get("a") != 1 || calls.Load() != 0 {
+		t.Fatal("A fresh pair is refreshed, but should not be the case!")
+	}
+	clock.Advance(time.Minute)
+	for i := 0; i < 10; i++ {
+		if element := cm.Get("a"); element != 1 {
+			t.Fatalf("Get does not return the stale element immediately: %d", element)
+		}
+	}
+	close(release)
+	waitFor(t, func() bool { return cm.Get("a") == 2 }, "The stale pair is not refreshed!")
+	if calls.Load() != 1 {
+		t.Fatalf("Inconsistent loader calls: expected: %d, actual: %d", 1, calls.Load())
+	}
+	// 刷新会重新记录写入时间
+	cm.Get("a")
+	time.Sleep(10 * time.Millisecond)
+	if calls.Load() != 1 {
+		t.Fatalf("A refreshed pair is refreshed again: calls: %d", calls.Load())
+	}
+}
+
+func TestRefreshConflict(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	done := make(chan struct{})
+	cm, err := New[string, int](
+		WithClock(clock),
+		WithRefreshAfterWrite(time.Minute),
+		WithRefreshLoader(func(ctx context.Context, key string, oldElement int) (int, error) {
+			defer close(done)
+			<-release
+			return 100, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.Put("a", 1)
+	clock.Advance(time.Minute)
+	cm.Get("a")
+	cm.Put("a", 2)
+	close(release)
+	<-done
+	time.Sleep(10 * time.Millisecond)
+	if element := cm.Get("a"); element != 2 {
+		t.Fatalf("The refresh overwrote a newer element: %d", element)
+	}
+}
+
+func TestRefreshWithTTL(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](
+		WithClock(clock),
+		WithRefreshAfterWrite(time.Minute),
+		WithRefreshLoader(func(ctx context.Context, key string, oldElement int) (int, error) {
+			return oldElement + 1, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if _, err := cm.PutWithTTL("a", 1, 2*time.Minute); err != nil {
+		t.Fatalf("An error occurs when putting with ttl: %s", err)
+	}
+	clock.Advance(time.Minute)
+	cm.Get("a")
+	waitFor(t, func() bool { return cm.Get("a") == 2 }, "The stale pair is not refreshed!")
+	// 刷新之后按该键自身的存活时间重新计时,因此超过原有的过期时间也不会过期
+	clock.Advance(90 * time.Second)
+	if element := cm.Get("a"); element != 2 {
+		t.Fatalf("The refreshed pair expires on the old schedule: %d", element)
+	}
+	waitFor(t, func() bool { return cm.Get("a") == 3 }, "The stale pair is not refreshed again!")
+	// 但仍不会采用字典默认的存活时间(永不过期)
+	clock.Advance(10 * time.Minute)
+	if element := cm.Get("a"); element != 0 {
+		t.Fatalf("The refreshed pair does not expire: %d", element)
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 0, cm.Len())
+	}
+}
+
+func TestRefreshFailure(t *testing.T) {
+	clock := newFakeClock()
+	errLoad := errors.New("load failed")
+	var lock sync.Mutex
+	var failures []string
+	cm, err := New[string, int](
+		WithClock(clock),
+		WithRefreshAfterWrite(time.Minute),
+		WithRefreshConcurrency(1),
+		WithRefreshLoader(func(ctx context.Context, key string, oldElement int) (int, error) {
+			if key == "panic" {
+				panic("boom")
+			}
+			return 0, errLoad
+		}),
+		WithRefreshFailureCallback(func(key string, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			failures = append(failures, key)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.Put("a", 1)
+	cm.Put("panic", 2)
+	clock.Advance(time.Minute)
+	cm.Get("a")
+	waitFor(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(failures) == 1
+	}, "The refresh failure is not reported!")
+	cm.Get("panic")
+	waitFor(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(failures) == 2
+	}, "The refresh panic is not reported!")
+	if cm.Get("a") != 1 || cm.Get("panic") != 2 {
+		t.Fatal("The stale elements are not kept after failed refreshes!")
+	}
+}
+
+func TestRefreshTimeout(t *testing.T) {
+	clock := newFakeClock()
+	hang := make(chan struct{})
+	defer close(hang)
+	var calls atomic.Int32
+	failures := make(chan error, 1)
+	cm, err := New[string, int](
+		WithClock(clock),
+		WithRefreshAfterWrite(50*time.Millisecond),
+		WithRefreshConcurrency(1),
+		WithRefreshLoader(func(ctx context.Context, key string, oldElement int) (int, error) {
+			// 第一次加载忽略ctx并一直挂起
+			if calls.Add(1) == 1 {
+				<-hang
+			}
+			return oldElement + 1, nil
+		}),
+		WithRefreshFailureCallback(func(key string, err error) { failures <- err }),
+	)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.Put("a", 1)
+	clock.Advance(time.Minute)
+	cm.Get("a")
+	select {
+	case err := <-failures:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Inconsistent refresh error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The hung refresh is not timed out!")
+	}
+	// 超时之后刷新名额被归还,该键可以再次刷新
+	waitFor(t, func() bool { return cm.Get("a") == 2 }, "The key is not refreshed after a timeout!")
+}
+
+func TestRefreshWithoutLoader(t *testing.T) {
+	if _, err := New[string, int](WithRefreshAfterWrite(time.Minute)); err == nil {
+		t.Fatal("No error when new a refreshing map without loader, but should not be the case!")
+	}
+}
@@ -0,0 +1,232 @@
+package cmap
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// segmentTable 代表散列段表,即字典在某一并发量下的所有散列段
+// 调整并发量时,旧表中的散列段会被逐个迁移到新表中,
+// 每个键在任一时刻只存在于其在旧表中的散列段(尚未迁移时)或新表中
+type segmentTable[K comparable, V any] struct {
+	// segments 代表散列段切片
+	segments []Segment[K, V]
+	// mask 代表选择散列段时使用的掩码
+	mask uint64
+	// gates 代表各散列段的迁移闸门
+	// 访问散列段时持有读锁,迁移散列段时持有写锁
+	gates []sync.RWMutex
+	// moved 代表各散列段是否已迁移到next中,受对应的迁移闸门保护
+	moved []bool
+	// next 代表迁移的目标散列段表,为nil时代表未在迁移
+	next atomic.Pointer[segmentTable[K, V]]
+	// retired 代表之前所有已被替换的散列段表的累计计数
+	// 它随本表一起发布,之后不再修改,因此统计时不会重复计入或遗漏旧散列段的计数
+	retired SegmentStats
+}
+
+// migrant 代表迁移中的键-元素对及其淘汰状态
+type migrant[K comparable, V any] struct {
+	// pair 代表键-元素对
+	pair Pair[K, V]
+	// entry 代表该键在淘汰策略中的状态,不限制容量时为零值
+	entry policyEntry[K]
+}
+
+// sortMigrants 按淘汰策略导出的顺序排列待迁移的键-元素对,并附上各自的淘汰状态
+// 淘汰策略中没有记录的键-元素对排在最前面,即最先被淘汰
+func sortMigrants[K comparable, V any](migrants []migrant[K, V], entries []policyEntry[K]) []migrant[K, V] {
+	positions := make(map[K]int, len(migrants))
+	for i, m := range migrants {
+		positions[m.pair.Key()] = i
+	}
+	tracked := make([]migrant[K, V], 0, len(migrants))
+	for _, e := range entries {
+		if i, ok := positions[e.key]; ok {
+			delete(positions, e.key)
+			tracked = append(tracked, migrant[K, V]{pair: migrants[i].pair, entry: e})
+		}
+	}
+	sorted := make([]migrant[K, V], 0, len(migrants))
+	for _, m := range migrants {
+		if _, ok := positions[m.pair.Key()]; ok {
+			sorted = append(sorted, migrant[K, V]{pair: m.pair, entry: policyEntry[K]{key: m.pair.Key()}})
+		}
+	}
+	return append(sorted, tracked...)
+}
+
+// newSegmentTable 创建一个含有concurrency个散列段的散列段表
+func (cmap *myConcurrentMap[K, V]) newSegmentTable(concurrency int, bucketNumber int) (*segmentTable[K, V], error) {
+	t := &segmentTable[K, V]{
+		segments: make([]Segment[K, V], concurrency),
+		mask:     uint64(concurrency - 1),
+		gates:    make([]sync.RWMutex, concurrency),
+		moved:    make([]bool, concurrency),
+	}
+	for i := range t.segments {
+		s, err := cmap.newSegment(i, concurrency, bucketNumber)
+		if err != nil {
+			return nil, err
+		}
+		t.segments[i] = s
+	}
+	return t, nil
+}
+
+// index 根据给定的哈希值计算对应散列段的索引
+// 散列桶是依据哈希值的低位选择的,所以这里先对哈希值进行混淆再取其高位,
+// 使散列段的选择与散列桶的选择互不相关,同一散列段中的键仍能均匀地分布到各散列桶中
+func (t *segmentTable[K, V]) index(keyHash uint64) int {
+	return int((mixHash(keyHash) >> 32) & t.mask)
+}
+
+// successors 返回next中可能含有本表第i个散列段的键的散列段的索引
+// 两表的并发量都是2的幂,因此这些散列段的索引与i在较小的掩码下相同
+func (t *segmentTable[K, V]) successors(next *segmentTable[K, V], i int) []int {
+	mask := min(t.mask, next.mask)
+	var indexes []int
+	for j := i & int(mask); j < len(next.segments); j += int(mask) + 1 {
+		indexes = append(indexes, j)
+	}
+	return indexes
+}
+
+// enterSegment 返回指定哈希值对应的散列段,并持有其迁移闸门的读锁
+// 若该散列段已迁移,则转而寻找新散列段表中的散列段
+// 注意!调用方在访问完散列段之后必须释放返回的迁移闸门的读锁
+func (cmap *myConcurrentMap[K, V]) enterSegment(keyHash uint64) (Segment[K, V], *sync.RWMutex) {
+	t := cmap.table.Load()
+	for {
+		i := t.index(keyHash)
+		gate := &t.gates[i]
+		gate.RLock()
+		if !t.moved[i] {
+			return t.segments[i], gate
+		}
+		gate.RUnlock()
+		t = t.next.Load()
+	}
+}
+
+// eachSegment 在持有迁移闸门读锁的情况下依次对每个散列段调用fn
+// 迁移期间会同时访问新旧两个散列段表,已迁移的散列段是空的,因此不会重复访问键-元素对,
+// 但在访问的过程中被迁移的键-元素对有可能被访问两次
+// 注意!fn中不能访问当前字典
+func (cmap *myConcurrentMap[K, V]) eachSegment(fn func(s Segment[K, V])) {
+	for t := cmap.table.Load(); t != nil; t = t.next.Load() {
+		for i, s := range t.segments {
+			t.gates[i].RLock()
+			fn(s)
+			t.gates[i].RUnlock()
+		}
+	}
+}
+
+// segmentPairs 返回散列段表t中第i个散列段所负责的所有未过期的键-元素对
+// 若该散列段已迁移,则从新散列段表中筛选出原属于它的键-元素对,
+// 因此依次获取旧表中每个散列段的键-元素对时,每个键都恰好出现一次
+func (cmap *myConcurrentMap[K, V]) segmentPairs(t *segmentTable[K, V], i int) []Pair[K, V] {
+	t.gates[i].RLock()
+	if !t.moved[i] {
+		defer t.gates[i].RUnlock()
+		return t.segments[i].Pairs()
+	}
+	t.gates[i].RUnlock()
+	next := t.next.Load()
+	var pairs []Pair[K, V]
+	for _, j := range t.successors(next, i) {
+		for _, p := range cmap.segmentPairs(next, j) {
+			if t.index(p.Hash()) == i {
+				pairs = append(pairs, p)
+			}
+		}
+	}
+	return pairs
+}
+
+// Resize 将并发量调整为newConcurrency,newConcurrency会被向上取整为2的幂
+// 旧散列段中的键-元素对会被逐个散列段地迁移到新的散列段中,迁移期间读写操作可以照常进行,
+// 只有访问正在迁移的散列段的操作需要等待该散列段迁移完成
+// 迁移不会触发钩子,也不会记录到预写日志中
+// 若限制了容量,则迁移完成之后超出各自容量的新散列段会依照淘汰策略淘汰多余的键-元素对,
+// 这些淘汰与写操作引发的淘汰一样会触发钩子并记录到预写日志中
+// 迁移完成之后Concurrency返回新的并发量
+// 同一时刻只能进行一次调整,并发的调用会依次执行
+func (cmap *myConcurrentMap[K, V]) Resize(newConcurrency int) error {
+	if newConcurrency <= 0 {
+		return newIllegalParameterError("concurrency is too small")
+	}
+	if newConcurrency > MAX_CONCURRENCY {
+		return newIllegalParameterError("concurrency is too large")
+	}
+	newConcurrency = ceilPowerOfTwo(newConcurrency)
+	cmap.resizeLock.Lock()
+	defer cmap.resizeLock.Unlock()
+	t := cmap.table.Load()
+	if newConcurrency == len(t.segments) {
+		return nil
+	}
+	start := time.Now()
+	// 这里只需要估计数量,因此用size代替需要遍历字典的Len
+	perSegment := (int(cmap.size()) + newConcurrency - 1) / newConcurrency
+	bucketNumber := max(cmap.bucketNumber, bucketNumberFor(perSegment, cmap.loadFactor))
+	next, err := cmap.newSegmentTable(newConcurrency, bucketNumber)
+	if err != nil {
+		return err
+	}
+	t.next.Store(next)
+	for i := range t.segments {
+		cmap.migrate(t, next, i)
+	}
+	next.retire(t)
+	cmap.table.Store(next)
+	for _, s := range next.segments {
+		s.EvictExcess()
+	}
+	cmap.logger.LogAttrs(context.Background(), slog.LevelInfo, "cmap: concurrency resized",
+		slog.Int("concurrency", len(t.segments)),
+		slog.Int("new_concurrency", newConcurrency),
+		slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// migrate 将散列段表t中的第i个散列段迁移到next中
+func (cmap *myConcurrentMap[K, V]) migrate(t *segmentTable[K, V], next *segmentTable[K, V], i int) {
+	t.gates[i].Lock()
+	defer t.gates[i].Unlock()
+	// 同一新散列段中的键-元素对保持Drain返回时的顺序,以便保留淘汰顺序
+	groups := make(map[int][]migrant[K, V])
+	for _, m := range t.segments[i].Drain() {
+		j := next.index(m.pair.Hash())
+		groups[j] = append(groups[j], m)
+	}
+	for j, migrants := range groups {
+		s := next.segments[j]
+		s.Grow(bucketNumberFor(int(s.Size())+len(migrants), cmap.loadFactor))
+		s.Adopt(migrants)
+	}
+	t.moved[i] = true
+}
+
+// retire 将即将被替换的散列段表old的累计计数并入本表的retired,以免调整并发量之后统计数据被清零
+// 注意!必须在old的所有散列段都迁移完成之后、本表发布之前调用本方法
+func (t *segmentTable[K, V]) retire(old *segmentTable[K, V]) {
+	t.retired = old.retired
+	for _, s := range old.segments {
+		stats := s.Stats()
+		t.retired.GrowCount += stats.GrowCount
+		t.retired.ShrinkCount += stats.ShrinkCount
+		t.retired.Puts += stats.Puts
+		t.retired.Hits += stats.Hits
+		t.retired.Misses += stats.Misses
+		t.retired.Deletes += stats.Deletes
+		t.retired.Expirations += stats.Expirations
+		t.retired.Evictions += stats.Evictions
+		t.retired.LockWaitTime += stats.LockWaitTime
+		t.retired.LockContentions += stats.LockContentions
+	}
+}
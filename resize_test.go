@@ -0,0 +1,313 @@
+package cmap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	cm, err := New[string, int](WithConcurrency(4))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var events atomic.Int64
+	cm.Hooks().OnInsert(func(Event[string, int]) { events.Add(1) })
+	cm.Hooks().OnDelete(func(Event[string, int]) { events.Add(1) })
+	number := 10000
+	for i := 0; i < number; i++ {
+		cm.Put("key"+strconv.Itoa(i), i)
+	}
+	events.Store(0)
+	for _, concurrency := range []int{33, 2, 1, 16} {
+		if err := cm.Resize(concurrency); err != nil {
+			t.Fatalf("An error occurs when resizing to %d: %s", concurrency, err)
+		}
+		expected := ceilPowerOfTwo(concurrency)
+		if cm.Concurrency() != expected {
+			t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d", expected, cm.Concurrency())
+		}
+		if cm.Len() != uint64(number) {
+			t.Fatalf("Inconsistent map length: expected: %d, actual: %d", number, cm.Len())
+		}
+		for i := 0; i < number; i++ {
+			if element := cm.Get("key" + strconv.Itoa(i)); element != i {
+				t.Fatalf("Inconsistent element: expected: %d, actual: %d", i, element)
+			}
+		}
+	}
+	if events.Load() != 0 {
+		t.Fatalf("Migration fired %d events, but should not be the case!", events.Load())
+	}
+	stats := cm.Stats()
+	if stats.Concurrency != 16 || len(stats.Segments) != 16 || stats.PairTotal != uint64(number) {
+		t.Fatalf("Inconsistent stats after resizing: concurrency: %d, pair total: %d",
+			stats.Concurrency, stats.PairTotal)
+	}
+	// 调整之前的累计计数应被保留
+	if stats.Puts != uint64(number) || stats.Hits != uint64(4*number) {
+		t.Fatalf("Inconsistent counters after resizing: puts: %d, hits: %d", stats.Puts, stats.Hits)
+	}
+	if err := cm.Resize(16); err != nil {
+		t.Fatalf("An error occurs when resizing to the same concurrency: %s", err)
+	}
+	for _, concurrency := range []int{0, MAX_CONCURRENCY + 1} {
+		if err := cm.Resize(concurrency); !errors.As(err, new(IllegalParameterError)) {
+			t.Fatalf("Inconsistent error when resizing to %d: %v", concurrency, err)
+		}
+	}
+}
+
+func TestResizeConcurrently(t *testing.T) {
+	cm, err := New[int, int](WithConcurrency(2))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	workers, rounds, keysPerWorker := 8, 200, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				for k := 0; k < keysPerWorker; k++ {
+					key := w*keysPerWorker + k
+					cm.Compute(key, func(old int, _ bool) (int, bool) { return old + 1, true })
+				}
+				cm.Delete(-w - 1)
+				cm.Put(-w-1, r)
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	var iterErr atomic.Value
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			seen := make(map[int]bool)
+			cm.Range(func(key int, _ int) bool {
+				if seen[key] {
+					iterErr.Store("duplicate key " + strconv.Itoa(key))
+				}
+				seen[key] = true
+				return true
+			})
+		}
+	}()
+	for _, concurrency := range []int{64, 4, 128, 1, 8} {
+		if err := cm.Resize(concurrency); err != nil {
+			t.Fatalf("An error occurs when resizing to %d: %s", concurrency, err)
+		}
+	}
+	wg.Wait()
+	<-done
+	if msg := iterErr.Load(); msg != nil {
+		t.Fatalf("Inconsistent iteration during resizing: %s", msg)
+	}
+	if cm.Concurrency() != 8 {
+		t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d", 8, cm.Concurrency())
+	}
+	if cm.Len() != uint64(workers*keysPerWorker+workers) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", workers*keysPerWorker+workers, cm.Len())
+	}
+	for key := 0; key < workers*keysPerWorker; key++ {
+		if count := cm.Get(key); count != rounds {
+			t.Fatalf("Lost update of key %d during resizing: expected: %d, actual: %d", key, rounds, count)
+		}
+	}
+}
+
+func TestResizeWithCostAndWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	cm, err := New[string, string](WithConcurrency(2), WithMaxCost(1<<20),
+		WithCost(func(string, string) int64 { return 10 }),
+		WithWAL(path, JSONCodec{}, WithWALSyncPolicy(WAL_SYNC_ALWAYS)))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		cm.Put("key"+strconv.Itoa(i), "v")
+	}
+	info, _ := os.Stat(path)
+	size := info.Size()
+	if err := cm.Resize(8); err != nil {
+		t.Fatalf("An error occurs when resizing: %s", err)
+	}
+	if cost := cm.Stats().Cost; cost != 1000 {
+		t.Fatalf("Inconsistent cost after resizing: expected: %d, actual: %d", 1000, cost)
+	}
+	if info, _ := os.Stat(path); info.Size() != size {
+		t.Fatalf("Migration is logged to the wal: size: %d, expected: %d", info.Size(), size)
+	}
+	cm.Delete("key0")
+	if cost := cm.Stats().Cost; cost != 990 {
+		t.Fatalf("Inconsistent cost after deleting: expected: %d, actual: %d", 990, cost)
+	}
+	if err := cm.Close(); err != nil {
+		t.Fatalf("An error occurs when closing map: %s", err)
+	}
+	replayed, err := New[string, string](WithWAL(path, JSONCodec{}))
+	if err != nil {
+		t.Fatalf("An error occurs when replaying wal: %s", err)
+	}
+	defer replayed.Close()
+	if replayed.Len() != 99 {
+		t.Fatalf("Inconsistent replayed length: expected: %d, actual: %d", 99, replayed.Len())
+	}
+}
+
+func TestResizeStatsMonotonic(t *testing.T) {
+	cm, err := New[int, int](WithConcurrency(4))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := w*1000 + i%1000
+				cm.Put(key, i)
+				cm.Get(key)
+				cm.Get(-key - 1)
+				cm.Delete(key)
+			}
+		}(w)
+	}
+	scraped := make(chan error, 1)
+	go func() {
+		var last Stats
+		for {
+			select {
+			case <-stop:
+				scraped <- nil
+				return
+			default:
+			}
+			stats := cm.Stats()
+			// 计数器只增不减,否则在监控系统看来就像是被重置了
+			if stats.Puts < last.Puts || stats.Hits < last.Hits ||
+				stats.Misses < last.Misses || stats.Deletes < last.Deletes {
+				scraped <- fmt.Errorf("counters go down: puts: %d -> %d, hits: %d -> %d, misses: %d -> %d, deletes: %d -> %d",
+					last.Puts, stats.Puts, last.Hits, stats.Hits, last.Misses, stats.Misses, last.Deletes, stats.Deletes)
+				return
+			}
+			last = stats
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if err := cm.Resize([]int{8, 2}[i%2]); err != nil {
+			t.Fatalf("An error occurs when resizing: %s", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if err := <-scraped; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResizeKeepsEvictionOrder(t *testing.T) {
+	cm, err := New[int, int](WithConcurrency(1), WithMaxEntries(1000))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	number := 200
+	for i := 0; i < number; i++ {
+		cm.Put(i, i)
+	}
+	// 逆序访问,使最后放入的键最先被淘汰
+	for i := number - 1; i >= 0; i-- {
+		cm.Get(i)
+	}
+	if err := cm.Resize(4); err != nil {
+		t.Fatalf("An error occurs when resizing: %s", err)
+	}
+	var count int
+	for i, s := range cm.(*myConcurrentMap[int, int]).table.Load().segments {
+		policy := s.(*segment[int, int]).policy
+		previous := number
+		for key, ok := policy.Evict(); ok; key, ok = policy.Evict() {
+			if key >= previous {
+				t.Fatalf("Inconsistent victim order in segment %d: %d after %d", i, key, previous)
+			}
+			previous = key
+			count++
+		}
+	}
+	if count != number {
+		t.Fatalf("Inconsistent victim number: expected: %d, actual: %d", number, count)
+	}
+}
+
+func TestResizeKeepsTinyLFUState(t *testing.T) {
+	cm, err := New[string, int](WithConcurrency(1), WithMaxEntries(100),
+		WithEvictionPolicy(NewTinyLFUPolicy[string]))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i := 0; i < 50; i++ {
+		cm.Put("key"+strconv.Itoa(i), i)
+	}
+	for i := 0; i < 10; i++ {
+		cm.Get("key0")
+	}
+	if err := cm.Resize(2); err != nil {
+		t.Fatalf("An error occurs when resizing: %s", err)
+	}
+	impl := cm.(*myConcurrentMap[string, int])
+	s, gate := impl.enterSegment(impl.hasher.Hash("key0"))
+	gate.RUnlock()
+	policy := s.(*segment[string, int]).policy.(*tinyLFUPolicy[string])
+	if frequency := policy.frequency("key0"); frequency < 10 {
+		t.Fatalf("Inconsistent frequency after resizing: expected: >= %d, actual: %d", 10, frequency)
+	}
+	if region := policy.elements["key0"].Value.(*tinyLFUEntry[string]).region; region != tinyLFUProtected {
+		t.Fatalf("Inconsistent region after resizing: expected: %d, actual: %d", tinyLFUProtected, region)
+	}
+}
+
+func TestResizeEvictsExcess(t *testing.T) {
+	number := 100
+	cm, err := New[int, int](WithConcurrency(1), WithMaxEntries(number))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var evicted atomic.Int64
+	cm.Hooks().OnDelete(func(event Event[int, int]) {
+		if event.Reason == REMOVAL_EVICTED {
+			evicted.Add(1)
+		}
+	})
+	for i := 0; i < number; i++ {
+		cm.Put(i, i)
+	}
+	// 新散列段的容量只有1或2,键几乎不可能恰好按容量分布,因此总有散列段超出其容量
+	if err := cm.Resize(64); err != nil {
+		t.Fatalf("An error occurs when resizing: %s", err)
+	}
+	for i, s := range cm.(*myConcurrentMap[int, int]).table.Load().segments {
+		impl := s.(*segment[int, int])
+		if s.Size() > impl.capacity {
+			t.Fatalf("Segment %d exceeds its capacity: capacity: %d, size: %d", i, impl.capacity, s.Size())
+		}
+	}
+	if evicted.Load() == 0 || cm.Len()+uint64(evicted.Load()) != uint64(number) {
+		t.Fatalf("Inconsistent eviction after resizing: length: %d, evicted: %d", cm.Len(), evicted.Load())
+	}
+	if stats := cm.Stats(); stats.Evictions != uint64(evicted.Load()) {
+		t.Fatalf("Inconsistent evictions: expected: %d, actual: %d", evicted.Load(), stats.Evictions)
+	}
+}
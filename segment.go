@@ -2,100 +2,338 @@ package cmap
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
+// ComputeOperation 代表计算函数对键-元素对的处理方式
+type ComputeOperation uint8
+
+const (
+	// COMPUTE_NONE 代表不做任何修改
+	COMPUTE_NONE ComputeOperation = 0
+	// COMPUTE_STORE 代表存储计算出的新元素
+	COMPUTE_STORE ComputeOperation = 1
+	// COMPUTE_DELETE 代表删除已有的键-元素对
+	COMPUTE_DELETE ComputeOperation = 2
+)
+
 // Segment 代表并发安全的散列段的接口
-type Segment interface {
+type Segment[K comparable, V any] interface {
 	// Put 根据参数放入一个键-元素对
 	// 第一个返回值表示是否新增了键-元素对
-	Put(p Pair) (bool, error)
+	Put(p Pair[K, V]) (bool, error)
 	// Get 根据给定参数返回对应的键-元素对
-	Get(key string) Pair
+	Get(key K) Pair[K, V]
 	// GetWithHash 根据给定参数返回对应的键-元素对
 	// 注意!参数keyHash应该是基于参数key计算得出哈希值
-	GetWithHash(key string, keyHash uint64) Pair
+	GetWithHash(key K, keyHash uint64) Pair[K, V]
 	// Delete 删除指定键的键-元素对
 	// 若返回值为true则说明已删除,否则说明未找到该键
-	Delete(key string) bool
+	Delete(key K) bool
+	// Compute 在持有段锁的情况下根据fn的结果原子地修改指定键的键-元素对
+	// fn的参数为旧元素及键是否存在,返回新元素及处理方式
+	// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+	// 注意!参数keyHash应该是基于参数key计算得出哈希值
+	Compute(key K, keyHash uint64, fn func(oldElement V, exists bool) (V, ComputeOperation)) (V, bool, error)
 	// Size 用于获取当前段的尺寸 (其中包含的散列桶的数量)
 	Size() uint64
+	// Len 返回当前段中未过期的键-元素对的数量
+	Len() uint64
 	// ForEach 迭代当前段的键-元素对
-	ForEach(fn func(key string, value interface{}))
+	ForEach(fn func(key K, value V))
+	// Range 迭代当前段的键-元素对,当fn返回false时停止迭代
+	// 返回值表示是否完整地迭代了当前段
+	Range(fn func(key K, value V) bool) bool
+	// Clear 清空当前段
+	// 返回值为被清除的键-元素对的数量
+	Clear() uint64
+	// RemoveExpired 删除当前段中过期的键-元素对
+	// 返回值为被删除的键-元素对的数量
+	RemoveExpired() uint64
+	// Refresh 仅当指定键存在且其写入时间仍为written时才用参数p替换它
+	// 返回值表示是否完成了替换
+	Refresh(p Pair[K, V], written int64) (bool, error)
+	// Grow 将散列桶的数量至少扩充到bucketNumber
+	Grow(bucketNumber int)
+	// Pairs 返回当前段中所有未过期的键-元素对
+	// 注意!不要修改返回的键-元素对
+	Pairs() []Pair[K, V]
+	// Drain 取出当前段中所有的键-元素对(包括已过期的)及其淘汰状态,之后当前段变为空
+	// 若限制了容量,则按淘汰顺序排列,最先被淘汰的在前
+	// 用于迁移键-元素对,因此不触发钩子、不记录日志,也不释放其成本
+	Drain() []migrant[K, V]
+	// Adopt 按顺序放入由其他散列段的Drain取出的键-元素对,并恢复其淘汰状态
+	// 用于迁移键-元素对,因此不触发钩子、不记录日志、不计入放入次数,也不淘汰键-元素对
+	Adopt(migrants []migrant[K, V])
+	// EvictExcess 依照淘汰策略淘汰超出容量或成本预算的键-元素对
+	// 返回值为被淘汰的键-元素对的数量
+	EvictExcess() uint64
+	// Stats 返回当前段运行状况的快照
+	Stats() SegmentStats
 }
 
 // segment 代表并发安全的散列段的类型
-type segment struct {
+type segment[K comparable, V any] struct {
 	// buckets 代表散列桶切片
-	buckets []Bucket
+	buckets []Bucket[K, V]
 	// bucketsLen 代表散列桶切片的长度
 	bucketsLen int
 	// pairTotal 代表键-元素对总数
 	pairTotal uint64
 	// pairRedistributor 代表键-元素的再分布器
-	pairRedistributor PairRedistributor
+	pairRedistributor PairRedistributor[K, V]
+	// index 代表当前段在字典中的索引
+	index int
+	// hasher 代表键的哈希函数
+	hasher Hasher[K]
+	// logger 代表日志记录器
+	logger *slog.Logger
+	// hooks 代表变更事件钩子的注册表,可以为nil
+	hooks *Hooks[K, V]
+	// clock 代表用于判断过期的时钟
+	clock Clock
+	// ttl 代表计算操作写入的键-元素对的存活时间,0代表永不过期
+	ttl time.Duration
+	// policy 代表淘汰策略,为nil时代表不限制容量
+	policy EvictionPolicy[K]
+	// capacity 代表当前段能容纳的键-元素对的最大数量,0代表不限制
+	capacity uint64
+	// onEvict 代表键-元素对被淘汰之后调用的回调函数,可以为nil
+	onEvict func(key K, element V)
+	// costs 代表字典中所有散列段共用的成本记录器,为nil时代表不限制成本
+	costs *costTracker[K, V]
+	// cost 代表当前段中所有键-元素对的成本之和
+	cost atomic.Int64
+	// stamping 代表是否在写入时记录写入时间
+	stamping bool
+	// journal 代表记录写操作的日志,为nil时代表不记录
+	journal journal[K, V]
+	// expiring 代表当前段是否曾放入过会过期的键-元素对
+	// 若为false,则读写操作可以省去判断过期的开销
+	expiring atomic.Bool
+	// growCount 代表扩容的次数
+	growCount uint64
+	// shrinkCount 代表缩容的次数
+	shrinkCount uint64
+	// redistributions 代表最近的再分布事件
+	// 最多保留MAX_REDISTRIBUTION_EVENTS个
+	redistributions []RedistributionEvent
+	// puts 代表放入或更新元素的次数
+	puts uint64
+	// hits 代表查找命中的次数
+	hits uint64
+	// misses 代表查找未命中的次数
+	misses uint64
+	// deletes 代表删除键-元素对的次数
+	deletes uint64
+	// expirations 代表因过期而删除键-元素对的次数
+	expirations uint64
+	// evictions 代表因超出容量而淘汰键-元素对的次数
+	evictions uint64
+	// lockWaitNanos 代表等待段锁的累计时间(纳秒)
+	lockWaitNanos int64
+	// lockContentions 代表获取段锁时发生竞争的次数
+	lockContentions uint64
 	// lock 保护段的互斥锁
 	// 任时候只有一个Goroutine能对段进行写操作
 	lock sync.Mutex
 }
 
+// segmentConfig 代表创建散列段时的可选配置
+type segmentConfig[K comparable, V any] struct {
+	// index 代表散列段在字典中的索引
+	index int
+	// hasher 代表键的哈希函数,可以为nil
+	hasher Hasher[K]
+	// logger 代表日志记录器,可以为nil
+	logger *slog.Logger
+	// hooks 代表变更事件钩子的注册表,可以为nil
+	hooks *Hooks[K, V]
+	// clock 代表用于判断过期的时钟,可以为nil
+	clock Clock
+	// ttl 代表计算操作写入的键-元素对的存活时间,0代表永不过期
+	ttl time.Duration
+	// policy 代表淘汰策略,为nil时代表不限制容量
+	policy EvictionPolicy[K]
+	// capacity 代表散列段能容纳的键-元素对的最大数量,0代表不限制
+	capacity uint64
+	// onEvict 代表键-元素对被淘汰之后调用的回调函数,可以为nil
+	onEvict func(key K, element V)
+	// costs 代表字典中所有散列段共用的成本记录器,为nil时代表不限制成本
+	costs *costTracker[K, V]
+	// stamping 代表是否在写入时记录写入时间
+	// 只有需要异步刷新时才记录,以免每次写入都读取时钟
+	stamping bool
+	// journal 代表记录写操作的日志,为nil时代表不记录
+	journal journal[K, V]
+}
+
 // newSegment 创建一个Segment类型的实例
-func newSegment(bucketNumber int, pairRedistributor PairRedistributor) Segment {
+// 参数pairRedistributor和config都可以为nil
+func newSegment[K comparable, V any](bucketNumber int, pairRedistributor PairRedistributor[K, V],
+	config *segmentConfig[K, V]) Segment[K, V] {
 	if bucketNumber <= 0 {
 		bucketNumber = DEFAULT_BUCKET_NUMBER
 	}
 	if pairRedistributor == nil {
-		pairRedistributor = newDefaultPairRedistributor(DEFAULT_BUCKET_LOAD_FACTOR, bucketNumber)
+		pairRedistributor = newDefaultPairRedistributor[K, V](DEFAULT_BUCKET_LOAD_FACTOR, bucketNumber, DEFAULT_BUCKET_MAX_SIZE)
+	}
+	if config == nil {
+		config = &segmentConfig[K, V]{}
 	}
-	buckets := make([]Bucket, bucketNumber)
+	hasher := config.hasher
+	if hasher == nil {
+		hasher = newDefaultHasher[K]()
+	}
+	logger := config.logger
+	if logger == nil {
+		logger = discardLogger
+	}
+	clock := config.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	buckets := make([]Bucket[K, V], bucketNumber)
 	for i := 0; i < bucketNumber; i++ {
-		buckets[i] = newBucket()
+		buckets[i] = newBucket[K, V]()
 	}
-	return &segment{
+	return &segment[K, V]{
 		buckets:           buckets,
 		bucketsLen:        bucketNumber,
 		pairRedistributor: pairRedistributor,
+		index:             config.index,
+		hasher:            hasher,
+		logger:            logger,
+		hooks:             config.hooks,
+		clock:             clock,
+		ttl:               config.ttl,
+		policy:            config.policy,
+		capacity:          config.capacity,
+		onEvict:           config.onEvict,
+		costs:             config.costs,
+		stamping:          config.stamping,
+		journal:           config.journal,
 	}
 }
 
 // Put 根据参数放入一个键-元素对
 // 第一个返回值表示是否新增了键-元素对
-func (s *segment) Put(p Pair) (bool, error) {
-	s.lock.Lock()
+// 若键已存在但已过期,则视为新增
+// 若超出了成本预算,则返回CostExceededError
+func (s *segment[K, V]) Put(p Pair[K, V]) (bool, error) {
+	// 成本函数由外部传入,有可能引发恐慌,所以这里用defer解锁
+	defer s.commit()
+	s.acquire()
+	defer s.lock.Unlock()
 	b := s.buckets[int(p.Hash()%uint64(s.bucketsLen))]
+	// 只有注册了OnUpdate钩子、可能存在过期的键-元素对或限制了成本时才需要查找旧的键-元素对
+	var target Pair[K, V]
+	if s.hooks.hasUpdate() || s.expiring.Load() || s.costs != nil {
+		target = b.Get(p.Key())
+		if target != nil && s.expired(target) {
+			s.removeExpiredPair(b, target)
+			target = nil
+		}
+	}
+	var oldElement V
+	var oldCost int64
+	if target != nil {
+		oldElement = target.Element()
+		oldCost = target.Cost()
+	}
+	if s.costs != nil {
+		p.SetCost(s.costs.weigh(p.Key(), p.Element()))
+		if err := s.chargeCost(p.Cost(), oldCost); err != nil {
+			return false, err
+		}
+	}
+	if s.stamping {
+		p.SetWritten(s.now())
+	}
+	if p.Expiry() != 0 {
+		s.expiring.Store(true)
+	}
 	ok, err := b.Put(p, nil)
-	if ok {
-		newTotal := atomic.AddUint64(&s.pairTotal, 1)
-		_ = s.redistribute(newTotal, b.Size())
+	if err != nil {
+		s.releaseCost(p.Cost() - oldCost)
+		return false, err
 	}
-	s.lock.Unlock()
-	return ok, err
+	atomic.AddUint64(&s.puts, 1)
+	s.logPut(p)
+	if !ok {
+		s.fire(EVENT_UPDATE, p.Key(), oldElement, p.Element())
+		s.access(p.Key())
+		s.evict(p.Key())
+		return false, nil
+	}
+	s.fire(EVENT_INSERT, p.Key(), oldElement, p.Element())
+	atomic.AddUint64(&s.pairTotal, 1)
+	s.admit(p.Key())
+	_ = s.redistribute(atomic.LoadUint64(&s.pairTotal), b.Size())
+	return true, nil
 }
 
 // Get 根据给定参数返回对应的键-元素对
-func (s *segment) Get(key string) Pair {
-	return s.GetWithHash(key, hash(key))
+func (s *segment[K, V]) Get(key K) Pair[K, V] {
+	return s.GetWithHash(key, s.hasher.Hash(key))
 }
 
 // GetWithHash 根据给定参数返回对应的键-元素对
 // 注意!参数keyHash应该是基于参数key计算得出哈希值
-func (s *segment) GetWithHash(key string, keyHash uint64) Pair {
-	s.lock.Lock()
+func (s *segment[K, V]) GetWithHash(key K, keyHash uint64) Pair[K, V] {
+	s.acquire()
 	b := s.buckets[int(keyHash%uint64(s.bucketsLen))]
 	s.lock.Unlock()
-	return b.Get(key)
+	p := b.Get(key)
+	if p != nil && s.expired(p) {
+		p = nil
+	}
+	if p != nil {
+		atomic.AddUint64(&s.hits, 1)
+		s.access(key)
+	} else {
+		atomic.AddUint64(&s.misses, 1)
+		s.miss(key)
+	}
+	return p
 }
 
 // Delete 删除指定键的键-元素对
 // 若返回值为true则说明已删除,否则说明未找到该键
-func (s *segment) Delete(key string) bool {
-	s.lock.Lock()
-	b := s.buckets[int(hash(key)%uint64(s.bucketsLen))]
+// 已过期的键-元素对会被清除,但仍视为未找到
+func (s *segment[K, V]) Delete(key K) bool {
+	defer s.commit()
+	s.acquire()
+	b := s.buckets[int(s.hasher.Hash(key)%uint64(s.bucketsLen))]
+	// 只有注册了OnDelete钩子、可能存在过期的键-元素对或限制了成本时才需要查找旧的键-元素对
+	var oldElement V
+	var oldCost int64
+	if s.hooks.hasDelete() || s.expiring.Load() || s.costs != nil {
+		if target := b.Get(key); target != nil {
+			if s.expired(target) {
+				s.removeExpiredPair(b, target)
+				newTotal := atomic.LoadUint64(&s.pairTotal)
+				_ = s.redistribute(newTotal, b.Size())
+				s.lock.Unlock()
+				return false
+			}
+			oldElement = target.Element()
+			oldCost = target.Cost()
+		}
+	}
 	ok := b.Delete(key, nil)
 	if ok {
+		atomic.AddUint64(&s.deletes, 1)
+		s.logDelete(key)
+		s.forget(key)
+		s.releaseCost(oldCost)
+		s.fireDelete(key, oldElement, REMOVAL_EXPLICIT)
 		newTotal := atomic.AddUint64(&s.pairTotal, ^uint64(0))
 		_ = s.redistribute(newTotal, b.Size())
 	}
@@ -103,29 +341,580 @@ func (s *segment) Delete(key string) bool {
 	return ok
 }
 
+// Compute 在持有段锁的情况下根据fn的结果原子地修改指定键的键-元素对
+// fn的参数为旧元素及键是否存在,返回新元素及处理方式
+// 第一个返回值为操作之后与该键关联的元素,第二个返回值表示操作之后该键是否存在
+// 注意!参数keyHash应该是基于参数key计算得出哈希值
+func (s *segment[K, V]) Compute(key K, keyHash uint64,
+	fn func(oldElement V, exists bool) (V, ComputeOperation)) (V, bool, error) {
+	var zero V
+	if fn == nil {
+		return zero, false, newIllegalParameterError("compute function is nil")
+	}
+	// fn由外部传入,有可能引发恐慌,所以这里用defer解锁
+	defer s.commit()
+	s.acquire()
+	defer s.lock.Unlock()
+	b := s.buckets[int(keyHash%uint64(s.bucketsLen))]
+	var oldElement V
+	target := b.Get(key)
+	if target != nil && s.expired(target) {
+		s.removeExpiredPair(b, target)
+		target = nil
+	}
+	exists := target != nil
+	if exists {
+		oldElement = target.Element()
+	}
+	newElement, op := fn(oldElement, exists)
+	switch op {
+	case COMPUTE_STORE:
+		if isNil(newElement) {
+			if exists {
+				return oldElement, true, newIllegalParameterError("element is nil")
+			}
+			return zero, false, newIllegalParameterError("element is nil")
+		}
+		var cost int64
+		if s.costs != nil {
+			cost = s.costs.weigh(key, newElement)
+			var oldCost int64
+			if exists {
+				oldCost = target.Cost()
+			}
+			if err := s.chargeCost(cost, oldCost); err != nil {
+				if exists {
+					return oldElement, true, err
+				}
+				return zero, false, err
+			}
+		}
+		if exists {
+			_ = target.SetElement(newElement)
+			target.SetExpiry(s.renewedExpiry(target))
+			target.SetCost(cost)
+			if s.stamping {
+				target.SetWritten(s.now())
+			}
+			atomic.AddUint64(&s.puts, 1)
+			s.logPut(target)
+			s.fire(EVENT_UPDATE, key, oldElement, newElement)
+			s.access(key)
+			if !s.evict(key) {
+				return zero, false, nil
+			}
+			return newElement, true, nil
+		}
+		p, _ := newPair(key, keyHash, newElement)
+		p.SetCost(cost)
+		if s.stamping {
+			p.SetWritten(s.now())
+		}
+		if expiry := expiryAfter(s.clock, s.ttl); expiry != 0 {
+			p.SetExpiry(expiry)
+			p.SetTTL(s.ttl)
+			s.expiring.Store(true)
+		}
+		if _, err := b.Put(p, nil); err != nil {
+			s.releaseCost(cost)
+			return zero, false, err
+		}
+		atomic.AddUint64(&s.puts, 1)
+		s.logPut(p)
+		s.fire(EVENT_INSERT, key, zero, newElement)
+		atomic.AddUint64(&s.pairTotal, 1)
+		kept := s.admit(key)
+		_ = s.redistribute(atomic.LoadUint64(&s.pairTotal), b.Size())
+		if !kept {
+			return zero, false, nil
+		}
+		return newElement, true, nil
+	case COMPUTE_DELETE:
+		if !exists {
+			return zero, false, nil
+		}
+		b.Delete(key, nil)
+		atomic.AddUint64(&s.deletes, 1)
+		s.logDelete(key)
+		s.forget(key)
+		s.releaseCost(target.Cost())
+		s.fireDelete(key, oldElement, REMOVAL_EXPLICIT)
+		newTotal := atomic.AddUint64(&s.pairTotal, ^uint64(0))
+		_ = s.redistribute(newTotal, b.Size())
+		return zero, false, nil
+	default:
+		return oldElement, exists, nil
+	}
+}
+
 // Size 用于获取当前段的尺寸 (其中包含的散列桶的数量)
-func (s *segment) Size() uint64 {
+func (s *segment[K, V]) Size() uint64 {
 	return atomic.LoadUint64(&s.pairTotal)
 }
 
+// Len 返回当前段中未过期的键-元素对的数量
+// 若当前段曾放入过会过期的键-元素对,则需要遍历整个段
+func (s *segment[K, V]) Len() uint64 {
+	if !s.expiring.Load() {
+		return s.Size()
+	}
+	var count uint64
+	s.Range(func(K, V) bool {
+		count++
+		return true
+	})
+	return count
+}
+
 // ForEach 迭代当前段的键-元素对
-func (s *segment) ForEach(fn func(key string, value interface{})) {
+// 迭代基于各散列桶表头的快照进行,fn执行时不持有段锁,因此fn中可以修改字典
+func (s *segment[K, V]) ForEach(fn func(key K, value V)) {
 	if fn == nil {
 		return
 	}
-	s.lock.Lock()
-	for i := 0; i < s.bucketsLen; i++ {
-		for v := s.buckets[i].GetFirstPair(); v != nil; v = v.Next() {
+	expiring, now := s.expiring.Load(), s.now()
+	for _, firstPair := range s.snapshot() {
+		for v := firstPair; v != nil; v = v.Next() {
+			if expiring && isExpired(v, now) {
+				continue
+			}
 			fn(v.Key(), v.Element())
 		}
 	}
-	s.lock.Unlock()
+}
+
+// Range 迭代当前段的键-元素对,当fn返回false时停止迭代
+// 返回值表示是否完整地迭代了当前段
+// 迭代基于各散列桶表头的快照进行,fn执行时不持有段锁,因此fn中可以修改字典
+func (s *segment[K, V]) Range(fn func(key K, value V) bool) bool {
+	if fn == nil {
+		return true
+	}
+	expiring, now := s.expiring.Load(), s.now()
+	for _, firstPair := range s.snapshot() {
+		for v := firstPair; v != nil; v = v.Next() {
+			if expiring && isExpired(v, now) {
+				continue
+			}
+			if !fn(v.Key(), v.Element()) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Pairs 返回当前段中所有未过期的键-元素对
+// 返回的是键-元素对本身而不是副本,因此其元素有可能被之后的写操作替换
+// 注意!不要修改返回的键-元素对
+func (s *segment[K, V]) Pairs() []Pair[K, V] {
+	expiring, now := s.expiring.Load(), s.now()
+	pairs := make([]Pair[K, V], 0, s.Size())
+	for _, firstPair := range s.snapshot() {
+		for v := firstPair; v != nil; v = v.Next() {
+			if expiring && isExpired(v, now) {
+				continue
+			}
+			pairs = append(pairs, v)
+		}
+	}
+	return pairs
+}
+
+// snapshot 在段锁的保护下获取各散列桶表头的快照
+// 由于散列桶中的单链表是写时复制的,所以在释放锁之后仍可安全地遍历快照
+func (s *segment[K, V]) snapshot() []Pair[K, V] {
+	s.acquire()
+	defer s.lock.Unlock()
+	firstPairs := make([]Pair[K, V], 0, s.bucketsLen)
+	for i := 0; i < s.bucketsLen; i++ {
+		if firstPair := s.buckets[i].GetFirstPair(); firstPair != nil {
+			firstPairs = append(firstPairs, firstPair)
+		}
+	}
+	return firstPairs
+}
+
+// Clear 清空当前段
+// 返回值为被清除的键-元素对的数量
+func (s *segment[K, V]) Clear() uint64 {
+	defer s.commit()
+	s.acquire()
+	defer s.lock.Unlock()
+	for i := 0; i < s.bucketsLen; i++ {
+		if s.hooks.hasDelete() || s.journal != nil {
+			for p := s.buckets[i].GetFirstPair(); p != nil; p = p.Next() {
+				s.logDelete(p.Key())
+				s.fireDelete(p.Key(), p.Element(), REMOVAL_EXPLICIT)
+			}
+		}
+		s.buckets[i].Clear(nil)
+	}
+	if s.policy != nil {
+		s.policy.Clear()
+	}
+	s.releaseCost(s.cost.Load())
+	return atomic.SwapUint64(&s.pairTotal, 0)
+}
+
+// Drain 取出当前段中所有的键-元素对(包括已过期的)及其淘汰状态,之后当前段变为空
+// 若限制了容量,则按淘汰顺序排列,最先被淘汰的在前,以便Adopt重建相同的淘汰顺序
+// 用于迁移键-元素对,因此不触发钩子、不记录日志,也不释放其成本
+func (s *segment[K, V]) Drain() []migrant[K, V] {
+	s.acquire()
+	defer s.lock.Unlock()
+	migrants := make([]migrant[K, V], 0, atomic.LoadUint64(&s.pairTotal))
+	for i := 0; i < s.bucketsLen; i++ {
+		for p := s.buckets[i].GetFirstPair(); p != nil; p = p.Next() {
+			migrants = append(migrants, migrant[K, V]{pair: p})
+		}
+		s.buckets[i].Clear(nil)
+	}
+	if s.policy != nil {
+		migrants = sortMigrants(migrants, exportPolicy(s.policy))
+	}
+	s.cost.Store(0)
+	atomic.StoreUint64(&s.pairTotal, 0)
+	return migrants
+}
+
+// Adopt 按顺序放入由其他散列段的Drain取出的键-元素对,并恢复其淘汰状态
+// 用于迁移键-元素对,因此不触发钩子、不记录日志、不计入放入次数,也不淘汰键-元素对
+// 超出容量的部分应在所有键-元素对都迁移完成之后通过EvictExcess淘汰
+func (s *segment[K, V]) Adopt(migrants []migrant[K, V]) {
+	s.acquire()
+	defer s.lock.Unlock()
+	var maxBucketSize uint64
+	entries := make([]policyEntry[K], 0, len(migrants))
+	for _, m := range migrants {
+		// 这里不能复用原有的键-元素对,否则会修改其链接,破坏正在被迭代的单链表
+		p := m.pair.Copy()
+		b := s.buckets[int(p.Hash()%uint64(s.bucketsLen))]
+		ok, err := b.Put(p, nil)
+		if err != nil || !ok {
+			continue
+		}
+		if p.Expiry() != 0 {
+			s.expiring.Store(true)
+		}
+		s.cost.Add(p.Cost())
+		atomic.AddUint64(&s.pairTotal, 1)
+		entries = append(entries, m.entry)
+		maxBucketSize = max(maxBucketSize, b.Size())
+	}
+	if s.policy != nil {
+		adoptPolicy(s.policy, entries)
+	}
+	_ = s.redistribute(atomic.LoadUint64(&s.pairTotal), maxBucketSize)
+}
+
+// EvictExcess 依照淘汰策略淘汰超出容量或成本预算的键-元素对
+// 用于调整并发量之后使各散列段回到各自的容量之内
+// 这些淘汰与写操作引发的淘汰一样会触发钩子并记录日志
+// 返回值为被淘汰的键-元素对的数量
+func (s *segment[K, V]) EvictExcess() uint64 {
+	if s.policy == nil {
+		return 0
+	}
+	defer s.commit()
+	s.acquire()
+	defer s.lock.Unlock()
+	evictions := atomic.LoadUint64(&s.evictions)
+	// 这里不关心某个键是否仍然存在,所以传入零值
+	var zero K
+	s.evict(zero)
+	return atomic.LoadUint64(&s.evictions) - evictions
+}
+
+// RemoveExpired 删除当前段中过期的键-元素对
+// 返回值为被删除的键-元素对的数量
+// 过期的键-元素对是基于快照查找的,删除时逐个持有段锁,因此不会长时间阻塞其他操作
+func (s *segment[K, V]) RemoveExpired() uint64 {
+	if !s.expiring.Load() {
+		return 0
+	}
+	now := s.now()
+	var expiredPairs []Pair[K, V]
+	for _, firstPair := range s.snapshot() {
+		for v := firstPair; v != nil; v = v.Next() {
+			if isExpired(v, now) {
+				expiredPairs = append(expiredPairs, v)
+			}
+		}
+	}
+	var removed uint64
+	for _, p := range expiredPairs {
+		s.acquire()
+		b := s.buckets[int(p.Hash()%uint64(s.bucketsLen))]
+		// 在查找之后该键有可能已被删除或重新放入,所以这里要重新检查
+		if target := b.Get(p.Key()); target != nil && isExpired(target, now) {
+			s.removeExpiredPair(b, target)
+			_ = s.redistribute(atomic.LoadUint64(&s.pairTotal), b.Size())
+			removed++
+		}
+		s.lock.Unlock()
+	}
+	return removed
+}
+
+// Refresh 仅当指定键存在且其写入时间仍为written时才用参数p替换它
+// 用于异步刷新,以免刷新得到的元素覆盖刷新期间发生的写操作
+// 已过期的键-元素对不会被替换,替换之后的键-元素对按该键自身的存活时间重新计算过期时间
+// 返回值表示是否完成了替换
+func (s *segment[K, V]) Refresh(p Pair[K, V], written int64) (bool, error) {
+	defer s.commit()
+	s.acquire()
+	defer s.lock.Unlock()
+	b := s.buckets[int(p.Hash()%uint64(s.bucketsLen))]
+	target := b.Get(p.Key())
+	if target == nil || s.expired(target) || target.Written() != written {
+		return false, nil
+	}
+	oldElement := target.Element()
+	oldCost := target.Cost()
+	if s.costs != nil {
+		p.SetCost(s.costs.weigh(p.Key(), p.Element()))
+		if err := s.chargeCost(p.Cost(), oldCost); err != nil {
+			return false, err
+		}
+	}
+	if s.stamping {
+		p.SetWritten(s.now())
+	}
+	p.SetExpiry(s.renewedExpiry(target))
+	p.SetTTL(target.TTL())
+	if _, err := b.Put(p, nil); err != nil {
+		s.releaseCost(p.Cost() - oldCost)
+		return false, err
+	}
+	atomic.AddUint64(&s.puts, 1)
+	s.logPut(p)
+	s.fire(EVENT_UPDATE, p.Key(), oldElement, p.Element())
+	s.access(p.Key())
+	s.evict(p.Key())
+	return true, nil
+}
+
+// Grow 将散列桶的数量至少扩充到bucketNumber
+// 用于批量放入键-元素对之前预先扩容,以免在放入的过程中多次再分布
+func (s *segment[K, V]) Grow(bucketNumber int) {
+	s.acquire()
+	defer s.lock.Unlock()
+	if bucketNumber <= s.bucketsLen {
+		return
+	}
+	buckets := make([]Bucket[K, V], bucketNumber)
+	for i := range buckets {
+		buckets[i] = newBucket[K, V]()
+	}
+	// 这里不能复用原有的键-元素对,否则会修改其链接,破坏正在被迭代的单链表
+	for _, b := range s.buckets {
+		for p := b.GetFirstPair(); p != nil; p = p.Next() {
+			_, _ = buckets[int(p.Hash()%uint64(bucketNumber))].Put(p.Copy(), nil)
+		}
+	}
+	oldBucketsLen := s.bucketsLen
+	s.buckets = buckets
+	s.bucketsLen = bucketNumber
+	s.recordRedistribution(oldBucketsLen, bucketNumber)
+	s.logger.LogAttrs(context.Background(), slog.LevelInfo, "cmap: segment grown",
+		slog.Int("bucket_number", oldBucketsLen),
+		slog.Int("new_bucket_number", bucketNumber),
+		slog.Uint64("pair_total", atomic.LoadUint64(&s.pairTotal)))
+}
+
+// removeExpiredPair 从散列桶中删除过期的键-元素对
+// 注意!必须在互斥锁的保护下调用本方法,且调用方负责在之后进行再分布
+func (s *segment[K, V]) removeExpiredPair(b Bucket[K, V], target Pair[K, V]) {
+	if !b.Delete(target.Key(), nil) {
+		return
+	}
+	atomic.AddUint64(&s.expirations, 1)
+	atomic.AddUint64(&s.pairTotal, ^uint64(0))
+	s.forget(target.Key())
+	s.releaseCost(target.Cost())
+	s.fireDelete(target.Key(), target.Element(), REMOVAL_EXPIRED)
+}
+
+// renewedExpiry 返回键-元素对的元素被原地更新之后的过期时间
+// 沿用该键自身的存活时间,因此PutWithTTL指定的存活时间不会被字典默认的存活时间取代
+// 永不过期的键-元素对仍永不过期;存活时间未知时采用字典默认的存活时间,若也没有则保留原有的过期时间
+func (s *segment[K, V]) renewedExpiry(p Pair[K, V]) int64 {
+	switch {
+	case p.Expiry() == 0:
+		return 0
+	case p.TTL() > 0:
+		return expiryAfter(s.clock, p.TTL())
+	case s.ttl > 0:
+		return expiryAfter(s.clock, s.ttl)
+	default:
+		return p.Expiry()
+	}
+}
+
+// access 通知淘汰策略已有的键被访问了
+func (s *segment[K, V]) access(key K) {
+	if s.policy != nil {
+		s.policy.Access(key)
+	}
+}
+
+// miss 通知淘汰策略访问了不存在的键
+// 只有实现了missRecorder接口的淘汰策略才会记录
+func (s *segment[K, V]) miss(key K) {
+	if recorder, ok := s.policy.(missRecorder[K]); ok {
+		recorder.recordMiss(key)
+	}
+}
+
+// forget 通知淘汰策略键已被删除
+func (s *segment[K, V]) forget(key K) {
+	if s.policy != nil {
+		s.policy.Remove(key)
+	}
+}
+
+// admit 通知淘汰策略新增了键,并在超出容量或成本预算时淘汰键-元素对
+// 返回值表示新增的键是否仍然存在,即是否被淘汰策略接纳
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) admit(key K) bool {
+	if s.policy == nil {
+		return true
+	}
+	s.policy.Add(key)
+	return s.evict(key)
+}
+
+// evict 在超出容量或成本预算时依照淘汰策略淘汰键-元素对
+// 返回值表示指定的键是否仍然存在
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) evict(key K) bool {
+	kept := true
+	for s.overflowed() {
+		victim, ok := s.policy.Evict()
+		if !ok {
+			break
+		}
+		b := s.buckets[int(s.hasher.Hash(victim)%uint64(s.bucketsLen))]
+		target := b.Get(victim)
+		if target == nil || !b.Delete(victim, nil) {
+			continue
+		}
+		if victim == key {
+			kept = false
+		}
+		atomic.AddUint64(&s.evictions, 1)
+		atomic.AddUint64(&s.pairTotal, ^uint64(0))
+		s.logDelete(victim)
+		s.releaseCost(target.Cost())
+		s.fireDelete(victim, target.Element(), REMOVAL_EVICTED)
+		if s.onEvict != nil {
+			callHook(func(p Pair[K, V]) { s.onEvict(p.Key(), p.Element()) }, target, s.logHookPanic)
+		}
+	}
+	return kept
+}
+
+// overflowed 判断当前段是否超出了容量或字典是否超出了成本预算
+func (s *segment[K, V]) overflowed() bool {
+	if s.policy == nil {
+		return false
+	}
+	if s.capacity > 0 && atomic.LoadUint64(&s.pairTotal) > s.capacity {
+		return true
+	}
+	return s.costs != nil && s.costs.overflowed()
+}
+
+// chargeCost 在写入键-元素对之前记录其成本的增量
+// 参数oldCost代表被替换的键-元素对的成本,新增时为0
+// 若超出成本预算且不能通过淘汰当前段中的其他键-元素对腾出预算,则返回CostExceededError
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) chargeCost(cost int64, oldCost int64) error {
+	if s.costs == nil {
+		return nil
+	}
+	if cost > s.costs.maxCost {
+		return newCostExceededError(cost, s.costs.maxCost)
+	}
+	delta := cost - oldCost
+	if s.costs.action == COST_OVERFLOW_REJECT {
+		if !s.costs.tryAdd(delta) {
+			return newCostExceededError(cost, s.costs.maxCost)
+		}
+	} else {
+		overflow := s.costs.total.Load() + delta - s.costs.maxCost
+		if overflow > 0 && s.cost.Load()-oldCost < overflow {
+			return newCostExceededError(cost, s.costs.maxCost)
+		}
+		s.costs.total.Add(delta)
+	}
+	s.cost.Add(delta)
+	return nil
+}
+
+// releaseCost 在删除键-元素对之后释放其成本
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) releaseCost(cost int64) {
+	if s.costs == nil || cost == 0 {
+		return
+	}
+	s.cost.Add(-cost)
+	s.costs.total.Add(-cost)
+}
+
+// logPut 在日志中记录放入的键-元素对
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) logPut(p Pair[K, V]) {
+	if s.journal != nil {
+		s.journal.logPut(p)
+	}
+}
+
+// logDelete 在日志中记录被删除的键
+// 过期的键-元素对在重放时会被忽略,因此不必记录
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) logDelete(key K) {
+	if s.journal != nil {
+		s.journal.logDelete(key)
+	}
+}
+
+// commit 等待日志中已记录的写操作持久化
+// 注意!必须在释放段锁之后调用本方法,写操作通过先于解锁的defer语句调用它
+func (s *segment[K, V]) commit() {
+	if s.journal != nil {
+		s.journal.commit()
+	}
+}
+
+// now 返回当前时间(Unix纳秒)
+func (s *segment[K, V]) now() int64 {
+	return s.clock.Now().UnixNano()
+}
+
+// expired 判断键-元素对是否已过期
+// 若当前段从未放入过会过期的键-元素对,则不必读取时钟
+func (s *segment[K, V]) expired(p Pair[K, V]) bool {
+	return s.expiring.Load() && isExpired(p, s.now())
+}
+
+// acquire 获取段锁
+// 若段锁已被其他Goroutine持有,则累计等待锁的时间
+func (s *segment[K, V]) acquire() {
+	if s.lock.TryLock() {
+		return
+	}
+	start := time.Now()
+	s.lock.Lock()
+	atomic.AddInt64(&s.lockWaitNanos, int64(time.Since(start)))
+	atomic.AddUint64(&s.lockContentions, 1)
 }
 
 // redistribute 检查给定参数并设置相应的阈值和计数
 // 并在必要时重新分配所有散列桶中的所有键-元素对
 // 注意!必须在互斥锁的保护下调用本方法
-func (s *segment) redistribute(pairTotal uint64, bucketSize uint64) (err error) {
+func (s *segment[K, V]) redistribute(pairTotal uint64, bucketSize uint64) (err error) {
 	defer func() {
 		// 再分配器有可能是第三方外部注入组件,所以这里要进行恐慌处理
 		if p := recover(); p != nil {
@@ -134,20 +923,130 @@ func (s *segment) redistribute(pairTotal uint64, bucketSize uint64) (err error)
 			} else {
 				err = newPairRedistributorError(fmt.Sprintf("%s", p))
 			}
+			s.logger.LogAttrs(context.Background(), slog.LevelError, "cmap: redistributor panicked",
+				slog.String("error", err.Error()),
+				slog.Uint64("pair_total", pairTotal),
+				slog.Int("bucket_number", s.bucketsLen))
 		}
 	}()
 	s.pairRedistributor.UpdateThreshold(pairTotal, s.bucketsLen)
 	bucketStatus := s.pairRedistributor.CheckBucketStatus(pairTotal, bucketSize)
 	newBuckets, change := s.pairRedistributor.Redistribe(bucketStatus, s.buckets)
 	if change {
+		oldBucketsLen := s.bucketsLen
 		s.buckets = newBuckets
 		s.bucketsLen = len(s.buckets)
+		s.recordRedistribution(oldBucketsLen, s.bucketsLen)
+		s.logger.LogAttrs(context.Background(), slog.LevelInfo, "cmap: segment redistributed",
+			slog.Int("bucket_number", oldBucketsLen),
+			slog.Int("new_bucket_number", s.bucketsLen),
+			slog.Uint64("pair_total", pairTotal))
 	}
 	return nil
 }
 
+// recordRedistribution 记录一次改变了散列桶数量的再分布
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) recordRedistribution(oldBucketsLen int, newBucketsLen int) {
+	switch {
+	case newBucketsLen > oldBucketsLen:
+		atomic.AddUint64(&s.growCount, 1)
+	case newBucketsLen < oldBucketsLen:
+		atomic.AddUint64(&s.shrinkCount, 1)
+	default:
+		return
+	}
+	if len(s.redistributions) >= MAX_REDISTRIBUTION_EVENTS {
+		s.redistributions = append(s.redistributions[:0], s.redistributions[1:]...)
+	}
+	event := RedistributionEvent{
+		Segment:         s.index,
+		Time:            time.Now(),
+		OldBucketNumber: oldBucketsLen,
+		NewBucketNumber: newBucketsLen,
+	}
+	s.redistributions = append(s.redistributions, event)
+	s.hooks.fireRedistribute(event, s.logHookPanic)
+}
+
+// fire 调用与事件类型对应的变更事件钩子
+// 注意!必须在互斥锁的保护下调用本方法
+func (s *segment[K, V]) fire(eventType EventType, key K, oldElement V, newElement V) {
+	if s.hooks == nil {
+		return
+	}
+	s.hooks.fire(Event[K, V]{
+		Type:       eventType,
+		Key:        key,
+		OldElement: oldElement,
+		NewElement: newElement,
+		Segment:    s.index,
+	}, s.logHookPanic)
+}
+
+// fireDelete 调用OnDelete钩子,参数reason代表删除的原因
+func (s *segment[K, V]) fireDelete(key K, oldElement V, reason RemovalReason) {
+	if s.hooks == nil {
+		return
+	}
+	var zero V
+	s.hooks.fire(Event[K, V]{
+		Type:       EVENT_DELETE,
+		Key:        key,
+		OldElement: oldElement,
+		NewElement: zero,
+		Segment:    s.index,
+		Reason:     reason,
+	}, s.logHookPanic)
+}
+
+// logHookPanic 记录钩子引发的恐慌
+func (s *segment[K, V]) logHookPanic(p interface{}) {
+	s.logger.LogAttrs(context.Background(), slog.LevelError, "cmap: hook panicked",
+		slog.String("error", fmt.Sprintf("%v", p)))
+}
+
+// Stats 返回当前段运行状况的快照
+// 只在复制散列桶切片时持有段锁,统计各散列桶的尺寸时不持有
+func (s *segment[K, V]) Stats() SegmentStats {
+	s.lock.Lock()
+	buckets := make([]Bucket[K, V], s.bucketsLen)
+	copy(buckets, s.buckets)
+	stats := SegmentStats{
+		PairTotal:       atomic.LoadUint64(&s.pairTotal),
+		BucketNumber:    s.bucketsLen,
+		GrowCount:       atomic.LoadUint64(&s.growCount),
+		ShrinkCount:     atomic.LoadUint64(&s.shrinkCount),
+		Redistributions: append([]RedistributionEvent(nil), s.redistributions...),
+		Puts:            atomic.LoadUint64(&s.puts),
+		Hits:            atomic.LoadUint64(&s.hits),
+		Misses:          atomic.LoadUint64(&s.misses),
+		Deletes:         atomic.LoadUint64(&s.deletes),
+		Expirations:     atomic.LoadUint64(&s.expirations),
+		Evictions:       atomic.LoadUint64(&s.evictions),
+		Cost:            s.cost.Load(),
+		LockWaitTime:    time.Duration(atomic.LoadInt64(&s.lockWaitNanos)),
+		LockContentions: atomic.LoadUint64(&s.lockContentions),
+	}
+	s.lock.Unlock()
+	for _, b := range buckets {
+		size := b.Size()
+		if size == 0 {
+			stats.EmptyBucketNumber++
+		}
+		if size > stats.MaxChainLength {
+			stats.MaxChainLength = size
+		}
+		for uint64(len(stats.ChainLengthHistogram)) <= size {
+			stats.ChainLengthHistogram = append(stats.ChainLengthHistogram, 0)
+		}
+		stats.ChainLengthHistogram[size]++
+	}
+	return stats
+}
+
 // String 返回当前segment字符串表示形式
-func (s *segment) String() string {
+func (s *segment[K, V]) String() string {
 	var buf bytes.Buffer
 	buf.WriteString("bucketsLen: ")
 	buf.WriteString(fmt.Sprintf("%d, ", s.bucketsLen))
@@ -1,12 +1,16 @@
 package cmap
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
 	"testing"
 )
 
 func TestSegmentNew(t *testing.T) {
-	s := newSegment(-1, nil)
+	s := newSegment[string, interface{}](-1, nil, nil)
 	if s == nil {
 		t.Fatalf("Couldn't new segment!")
 	}
@@ -16,7 +20,7 @@ func TestSegmentNew(t *testing.T) {
 func TestSegmentPut(t *testing.T) {
 	number := 30
 	testCases := genTestingPairs(number)
-	s := newSegment(-1, nil)
+	s := newSegment[string, interface{}](-1, nil, nil)
 	var count uint64
 	for _, p := range testCases {
 		ok, err := s.Put(p)
@@ -51,8 +55,8 @@ func TestSegmentPut(t *testing.T) {
 func TestSegmentPutInParallel(t *testing.T) {
 	number := 30
 	testCases := genNoRepetitiveTestingPairs(number)
-	s := newSegment(-1, nil)
-	testingFunc := func(p Pair, t *testing.T) func(t *testing.T) {
+	s := newSegment[string, interface{}](-1, nil, nil)
+	testingFunc := func(p Pair[string, interface{}], t *testing.T) func(t *testing.T) {
 		return func(t *testing.T) {
 			t.Parallel()
 			ok, err := s.Put(p)
@@ -89,11 +93,11 @@ func TestSegmentPutInParallel(t *testing.T) {
 func TestSegmentGetInParallel(t *testing.T) {
 	number := 30
 	testCases := genNoRepetitiveTestingPairs(number)
-	s := newSegment(-1, nil)
+	s := newSegment[string, interface{}](-1, nil, nil)
 	for _, p := range testCases {
 		_, _ = s.Put(p)
 	}
-	testingFunc := func(p Pair, t *testing.T) func(t *testing.T) {
+	testingFunc := func(p Pair[string, interface{}], t *testing.T) func(t *testing.T) {
 		return func(t *testing.T) {
 			t.Parallel()
 			actualPair := s.Get(p.Key())
@@ -130,7 +134,7 @@ func TestSegmentGetInParallel(t *testing.T) {
 func TestSegmentDelete(t *testing.T) {
 	number := 30
 	testCases := genTestingPairs(number)
-	s := newSegment(-1, nil)
+	s := newSegment[string, interface{}](-1, nil, nil)
 	for _, p := range testCases {
 		_, _ = s.Put(p)
 	}
@@ -164,11 +168,11 @@ func TestSegmentDelete(t *testing.T) {
 func TestSegmentDeleteInParallel(t *testing.T) {
 	number := 30
 	testCases := genNoRepetitiveTestingPairs(number)
-	s := newSegment(-1, nil)
+	s := newSegment[string, interface{}](-1, nil, nil)
 	for _, p := range testCases {
 		_, _ = s.Put(p)
 	}
-	testingFunc := func(p Pair, t *testing.T) func(t *testing.T) {
+	testingFunc := func(p Pair[string, interface{}], t *testing.T) func(t *testing.T) {
 		return func(t *testing.T) {
 			t.Parallel()
 			done := s.Delete(p.Key())
@@ -196,6 +200,99 @@ func TestSegmentDeleteInParallel(t *testing.T) {
 	t.Logf("%s", s)
 }
 
+func TestSegmentCompute(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	s := newSegment[string, interface{}](-1, nil, nil)
+	for _, p := range testCases {
+		element, ok, err := s.Compute(p.Key(), p.Hash(), func(oldElement interface{}, exists bool) (interface{}, ComputeOperation) {
+			if exists {
+				t.Fatalf("The key exists before putting! (pair: %#v)", p)
+			}
+			return p.Element(), COMPUTE_STORE
+		})
+		if err != nil {
+			t.Fatalf("An error occurs when computing a pair in the segment: %s (pair: %#v)", err, p)
+		}
+		if !ok || element != p.Element() {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", p.Element(), element)
+		}
+	}
+	if s.Size() != uint64(number) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, s.Size())
+	}
+	for _, p := range testCases {
+		_, ok, err := s.Compute(p.Key(), p.Hash(), func(oldElement interface{}, exists bool) (interface{}, ComputeOperation) {
+			if !exists || oldElement != p.Element() {
+				t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", p.Element(), oldElement)
+			}
+			return nil, COMPUTE_DELETE
+		})
+		if err != nil || ok {
+			t.Fatalf("Couldn't delete a pair by compute! (pair: %#v, err: %v)", p, err)
+		}
+	}
+	if s.Size() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 0, s.Size())
+	}
+}
+
+func TestSegmentGrow(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	s := newSegment[string, interface{}](-1, nil, nil)
+	for _, p := range testCases {
+		_, _ = s.Put(p)
+	}
+	s.Grow(DEFAULT_BUCKET_NUMBER / 2)
+	if s.Stats().BucketNumber != DEFAULT_BUCKET_NUMBER {
+		t.Fatalf("The segment is shrunk by Grow: %d", s.Stats().BucketNumber)
+	}
+	s.Grow(DEFAULT_BUCKET_NUMBER * 4)
+	stats := s.Stats()
+	if stats.BucketNumber != DEFAULT_BUCKET_NUMBER*4 || stats.GrowCount != 1 {
+		t.Fatalf("Inconsistent stats after growing: buckets: %d, grow count: %d", stats.BucketNumber, stats.GrowCount)
+	}
+	if len(s.Pairs()) != number {
+		t.Fatalf("Inconsistent pair number after growing: expected: %d, actual: %d", number, len(s.Pairs()))
+	}
+	for _, p := range testCases {
+		if actualPair := s.Get(p.Key()); actualPair == nil || actualPair.Element() != p.Element() {
+			t.Fatalf("Inconsistent pair after growing: expected: %#v, actual: %#v", p.Element(), actualPair)
+		}
+	}
+}
+
+// panicPairRedistributor 代表在更新阈值时会引发恐慌的再分布器
+type panicPairRedistributor struct {
+	PairRedistributor[string, interface{}]
+}
+
+func (pr panicPairRedistributor) UpdateThreshold(pairTotal uint64, bucketNumber int) {
+	panic("redistributor failure")
+}
+
+func TestSegmentLogRedistributorPanic(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil)).With(slog.Int("segment", 3))
+	s := newSegment[string, interface{}](-1, panicPairRedistributor{}, &segmentConfig[string, interface{}]{logger: logger})
+	p := genTestingPairs(1)[0]
+	ok, err := s.Put(p)
+	if err != nil || !ok {
+		t.Fatalf("Couldn't put pair to the segment! (pair: %#v, err: %v)", p, err)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("An error occurs when decoding the log record: %s (record: %s)", err, buf.String())
+	}
+	if record["level"] != "ERROR" || record["segment"] != float64(3) || record["pair_total"] != float64(1) {
+		t.Fatalf("Inconsistent log record: %s", buf.String())
+	}
+	if !strings.Contains(record["error"].(string), "redistributor failure") {
+		t.Fatalf("Inconsistent error in log record: %s", buf.String())
+	}
+}
+
 var testCaseNumberForSegmentTest = 200000
 var testCasesForSegmentTest = genNoRepetitiveTestingPairs(testCaseNumberForSegmentTest)
 var testCases1ForSegmentTest = testCasesForSegmentTest[:testCaseNumberForSegmentTest/2]
@@ -204,7 +301,7 @@ var testCases2ForSegmentTest = testCasesForSegmentTest[testCaseNumberForSegmentT
 func TestSegmentAllInParallel(t *testing.T) {
 	testCases1 := testCases1ForSegmentTest
 	testCases2 := testCases2ForSegmentTest
-	s := newSegment(-1, nil)
+	s := newSegment[string, interface{}](-1, nil, nil)
 	t.Run("All in parallel", func(t *testing.T) {
 		t.Run("Put1", func(t *testing.T) {
 			t.Parallel()
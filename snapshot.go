@@ -0,0 +1,322 @@
+package cmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+)
+
+const (
+	// SNAPSHOT_MAGIC 代表快照开头的魔数
+	SNAPSHOT_MAGIC string = "CMAP"
+	// SNAPSHOT_VERSION 代表快照格式的版本
+	SNAPSHOT_VERSION uint8 = 1
+	// MAX_SNAPSHOT_FIELD_SIZE 代表快照中单个键或元素的最大字节数
+	// 用于防止损坏的长度前缀导致过量分配内存
+	MAX_SNAPSHOT_FIELD_SIZE uint64 = 1 << 30
+)
+
+// 快照的格式如下,其中的整数均采用varint编码:
+//
+//	魔数 "CMAP"
+//	版本 (1字节)
+//	并发量 | 哈希函数名称的长度 | 哈希函数名称
+//	对每个散列段: 键-元素对数量 | 对每个键-元素对: 键的长度 | 键 | 元素的长度 | 元素 | 过期时间
+//	CRC32校验和 (4字节,大端序,覆盖之前的所有字节)
+
+// snapshotWriter 代表快照的写入器
+// 它会同时计算已写入内容的校验和,第一个错误发生之后的写操作都会被忽略
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc uint32
+	buf []byte
+	err error
+}
+
+// newSnapshotWriter 创建一个snapshotWriter类型的实例
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	return &snapshotWriter{w: bufio.NewWriter(w)}
+}
+
+// write 写入原始的字节序列
+func (sw *snapshotWriter) write(data []byte) {
+	if sw.err != nil {
+		return
+	}
+	sw.crc = crc32.Update(sw.crc, crc32.IEEETable, data)
+	_, sw.err = sw.w.Write(data)
+}
+
+// writeUvarint 写入无符号整数
+func (sw *snapshotWriter) writeUvarint(x uint64) {
+	sw.buf = binary.AppendUvarint(sw.buf[:0], x)
+	sw.write(sw.buf)
+}
+
+// writeVarint 写入有符号整数
+func (sw *snapshotWriter) writeVarint(x int64) {
+	sw.buf = binary.AppendVarint(sw.buf[:0], x)
+	sw.write(sw.buf)
+}
+
+// writeBytes 写入带有长度前缀的字节序列
+func (sw *snapshotWriter) writeBytes(data []byte) {
+	sw.writeUvarint(uint64(len(data)))
+	sw.write(data)
+}
+
+// close 写入校验和并刷新缓冲区
+func (sw *snapshotWriter) close() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	if _, err := sw.w.Write(binary.BigEndian.AppendUint32(nil, sw.crc)); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// snapshotReader 代表快照的读取器
+// 它会同时计算已读取内容的校验和
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc uint32
+}
+
+// newSnapshotReader 创建一个snapshotReader类型的实例
+func newSnapshotReader(r io.Reader) *snapshotReader {
+	return &snapshotReader{r: bufio.NewReader(r)}
+}
+
+// Read 是io.Reader接口的方法
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.crc = crc32.Update(sr.crc, crc32.IEEETable, p[:n])
+	return n, err
+}
+
+// ReadByte 是io.ByteReader接口的方法
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.crc = crc32.Update(sr.crc, crc32.IEEETable, []byte{b})
+	}
+	return b, err
+}
+
+// readUvarint 读取无符号整数
+func (sr *snapshotReader) readUvarint() (uint64, error) {
+	x, err := binary.ReadUvarint(sr)
+	return x, unexpectedEOF(err)
+}
+
+// readVarint 读取有符号整数
+func (sr *snapshotReader) readVarint() (int64, error) {
+	x, err := binary.ReadVarint(sr)
+	return x, unexpectedEOF(err)
+}
+
+// readBytes 读取带有长度前缀的字节序列
+// 缓冲区随着实际读到的数据增长,因此损坏的长度前缀不会导致过量分配内存
+func (sr *snapshotReader) readBytes() ([]byte, error) {
+	n, err := sr.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > MAX_SNAPSHOT_FIELD_SIZE {
+		return nil, newIllegalSnapshotError(fmt.Sprintf("field too large: %d", n))
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, sr, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// verify 读取并核对校验和
+func (sr *snapshotReader) verify() error {
+	sum := sr.crc
+	var trailer [4]byte
+	if _, err := io.ReadFull(sr.r, trailer[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if binary.BigEndian.Uint32(trailer[:]) != sum {
+		return newIllegalSnapshotError("checksum mismatch")
+	}
+	return nil
+}
+
+// unexpectedEOF 将读到末尾的错误转换为io.ErrUnexpectedEOF
+// 因为快照总是以校验和结尾,在此之前读到末尾都说明快照被截断了
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// hasherName 返回哈希函数的名称
+func hasherName[K comparable](h Hasher[K]) string {
+	return reflect.TypeOf(h).String()
+}
+
+// SaveSnapshot 将字典中所有未过期的键-元素对写入w
+// 键-元素对是逐个散列段写入的,因此不会同时持有多个段锁,写入期间的写操作不一定会被包含在快照中
+// 元素由codec编码,字符串、整数和布尔类型以外的键也由codec编码
+// 键-元素对的过期时间会被一同保存
+func (cmap *myConcurrentMap[K, V]) SaveSnapshot(w io.Writer, codec Codec) error {
+	if w == nil {
+		return newIllegalParameterError("writer is nil")
+	}
+	if codec == nil {
+		return newIllegalParameterError("codec is nil")
+	}
+	sw := newSnapshotWriter(w)
+	sw.write([]byte(SNAPSHOT_MAGIC))
+	sw.write([]byte{SNAPSHOT_VERSION})
+	t := cmap.table.Load()
+	sw.writeUvarint(uint64(len(t.segments)))
+	sw.writeBytes([]byte(hasherName(cmap.hasher)))
+	for i := range t.segments {
+		pairs := cmap.segmentPairs(t, i)
+		sw.writeUvarint(uint64(len(pairs)))
+		for _, p := range pairs {
+			key, err := encodeKey(p.Key(), codec)
+			if err != nil {
+				return err
+			}
+			element, err := codec.Encode(p.Element())
+			if err != nil {
+				return err
+			}
+			sw.writeBytes(key)
+			sw.writeBytes(element)
+			sw.writeVarint(p.Expiry())
+		}
+		if sw.err != nil {
+			return sw.err
+		}
+	}
+	return sw.close()
+}
+
+// LoadSnapshot 从r中读取由SaveSnapshot写入的快照,并将其中的键-元素对放入字典
+// 键的哈希值会由当前字典的哈希函数重新计算,因此快照可以载入到并发量或哈希函数不同的字典中
+// 只有在校验和核对无误之后才会放入键-元素对,放入之前会预先扩充各散列段,以免多次再分布
+// 已经过期的键-元素对会被忽略,与字典中已有的键相同的键-元素对会替换已有的元素
+func (cmap *myConcurrentMap[K, V]) LoadSnapshot(r io.Reader, codec Codec) error {
+	if r == nil {
+		return newIllegalParameterError("reader is nil")
+	}
+	if codec == nil {
+		return newIllegalParameterError("codec is nil")
+	}
+	sr := newSnapshotReader(r)
+	var magic [len(SNAPSHOT_MAGIC)]byte
+	if _, err := io.ReadFull(sr, magic[:]); err != nil || string(magic[:]) != SNAPSHOT_MAGIC {
+		return newIllegalSnapshotError("bad magic")
+	}
+	version, err := sr.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if version != SNAPSHOT_VERSION {
+		return newIllegalSnapshotError(fmt.Sprintf("unsupported version: %d", version))
+	}
+	concurrency, err := sr.readUvarint()
+	if err != nil {
+		return err
+	}
+	if concurrency == 0 || concurrency > uint64(MAX_CONCURRENCY) {
+		return newIllegalSnapshotError(fmt.Sprintf("illegal concurrency: %d", concurrency))
+	}
+	if _, err := sr.readBytes(); err != nil {
+		return err
+	}
+	var pairs []Pair[K, V]
+	for i := uint64(0); i < concurrency; i++ {
+		count, err := sr.readUvarint()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < count; j++ {
+			p, err := cmap.readSnapshotPair(sr, codec)
+			if err != nil {
+				return err
+			}
+			pairs = append(pairs, p)
+		}
+	}
+	if err := sr.verify(); err != nil {
+		return err
+	}
+	return cmap.putPairs(pairs)
+}
+
+// readSnapshotPair 从快照中读取一个键-元素对
+func (cmap *myConcurrentMap[K, V]) readSnapshotPair(sr *snapshotReader, codec Codec) (Pair[K, V], error) {
+	keyData, err := sr.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	elementData, err := sr.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := sr.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeKey[K](keyData, codec)
+	if err != nil {
+		return nil, err
+	}
+	element, err := decodeAs[V](elementData, codec)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPair(key, cmap.hasher.Hash(key), element)
+	if err != nil {
+		return nil, err
+	}
+	p.SetExpiry(expiry)
+	return p, nil
+}
+
+// putPairs 批量放入键-元素对
+// 放入之前会按各散列段将要容纳的键-元素对数量预先扩充散列桶,已经过期的键-元素对会被忽略
+func (cmap *myConcurrentMap[K, V]) putPairs(pairs []Pair[K, V]) error {
+	now := cmap.clock.Now().UnixNano()
+	// 预先扩充只是为了减少再分布,若期间调整了并发量,则新的散列段会按需再分布
+	t := cmap.table.Load()
+	counts := make([]int, len(t.segments))
+	live := pairs[:0]
+	for _, p := range pairs {
+		if isExpired(p, now) {
+			continue
+		}
+		counts[t.index(p.Hash())]++
+		live = append(live, p)
+	}
+	for i, s := range t.segments {
+		if counts[i] > 0 {
+			s.Grow(bucketNumberFor(int(s.Size())+counts[i], cmap.loadFactor))
+		}
+	}
+	for _, p := range live {
+		if p.Expiry() != 0 {
+			cmap.startJanitor()
+		}
+		s, gate := cmap.enterSegment(p.Hash())
+		_, err := s.Put(p)
+		gate.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// jsonTestCodec 代表测试用的基于JSON的Codec
+// 与JSONCodec不同,它不能直接解码为指定类型,用于测试解码结果的类型转换
+type jsonTestCodec struct{}
+
+func (jsonTestCodec) Encode(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonTestCodec) Decode(data []byte) (any, error) {
+	var v any
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+func TestSnapshot(t *testing.T) {
+	src, err := New[string, int](WithConcurrency(16))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	number := 20000
+	for i := 0; i < number; i++ {
+		src.Put("key"+strconv.Itoa(i), i)
+	}
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when saving snapshot: %s", err)
+	}
+	// BKDR哈希函数对相似的键分布不均,这里改用分布均匀的哈希函数,以便检查预先扩充的效果
+	dst, err := New[string, int](WithConcurrency(4), WithHasher(NewMapHasher[string]()))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if err := dst.LoadSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when loading snapshot: %s", err)
+	}
+	if dst.Len() != uint64(number) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", number, dst.Len())
+	}
+	for i := 0; i < number; i++ {
+		if element := dst.Get("key" + strconv.Itoa(i)); element != i {
+			t.Fatalf("Inconsistent element: expected: %d, actual: %d", i, element)
+		}
+	}
+	// 每个散列段只应预先扩充一次
+	if growCount := dst.Stats().GrowCount; growCount != uint64(dst.Concurrency()) {
+		t.Fatalf("Inconsistent grow count: expected: %d, actual: %d", dst.Concurrency(), growCount)
+	}
+}
+
+func TestSnapshotKeyTypes(t *testing.T) {
+	ints, _ := New[int, string]()
+	ints.Put(-1, "a")
+	ints.Put(1<<40, "b")
+	var buf bytes.Buffer
+	if err := ints.SaveSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when saving snapshot: %s", err)
+	}
+	restoredInts, _ := New[int, string]()
+	if err := restoredInts.LoadSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when loading snapshot: %s", err)
+	}
+	if restoredInts.Get(-1) != "a" || restoredInts.Get(1<<40) != "b" {
+		t.Fatal("Inconsistent elements of integer keys after loading snapshot!")
+	}
+	type point struct {
+		X, Y int
+	}
+	structs, _ := New[point, bool]()
+	structs.Put(point{1, 2}, true)
+	buf.Reset()
+	if err := structs.SaveSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when saving snapshot: %s", err)
+	}
+	restoredStructs, _ := New[point, bool]()
+	err := restoredStructs.LoadSnapshot(&buf, jsonTestCodec{})
+	if !errors.As(err, new(DecodedTypeError)) {
+		t.Fatalf("Inconsistent error when decoding a struct key as map: %v", err)
+	}
+}
+
+func TestSnapshotTTL(t *testing.T) {
+	clock := newFakeClock()
+	src, _ := New[string, int](WithClock(clock))
+	src.PutWithTTL("a", 1, time.Second)
+	src.PutWithTTL("b", 2, time.Minute)
+	src.Put("c", 3)
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when saving snapshot: %s", err)
+	}
+	clock.Advance(time.Second)
+	dst, _ := New[string, int](WithClock(clock))
+	if err := dst.LoadSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when loading snapshot: %s", err)
+	}
+	if dst.Len() != 2 || dst.Get("a") != 0 {
+		t.Fatalf("The expired pair is loaded: len: %d", dst.Len())
+	}
+	clock.Advance(time.Minute)
+	if dst.Len() != 1 || dst.Get("c") != 3 {
+		t.Fatalf("The expiry is not restored: len: %d", dst.Len())
+	}
+}
+
+func TestSnapshotCorrupted(t *testing.T) {
+	src, _ := New[string, int]()
+	for i := 0; i < 100; i++ {
+		src.Put("key"+strconv.Itoa(i), i)
+	}
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf, jsonTestCodec{}); err != nil {
+		t.Fatalf("An error occurs when saving snapshot: %s", err)
+	}
+	data := buf.Bytes()
+	flipped := bytes.Clone(data)
+	flipped[len(flipped)/2] ^= 0xff
+	truncated := data[:len(data)-2]
+	badMagic := append([]byte("XMAP"), data[4:]...)
+	testCases := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"flipped":   {flipped, nil},
+		"truncated": {truncated, io.ErrUnexpectedEOF},
+		"bad magic": {badMagic, nil},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dst, _ := New[string, int]()
+			err := dst.LoadSnapshot(bytes.NewReader(tc.data), jsonTestCodec{})
+			if err == nil {
+				t.Fatal("No error when loading a corrupted snapshot, but should not be the case!")
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Fatalf("Inconsistent error: expected: %v, actual: %v", tc.err, err)
+			}
+			if dst.Len() != 0 {
+				t.Fatalf("Pairs are loaded from a corrupted snapshot: %d", dst.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package cmap
+
+import (
+	"sort"
+	"time"
+)
+
+// MAX_REDISTRIBUTION_EVENTS 代表每个散列段保留的最近再分布事件的最大数量
+const MAX_REDISTRIBUTION_EVENTS int = 16
+
+// RedistributionEvent 代表一次改变了散列桶数量的再分布事件
+type RedistributionEvent struct {
+	// Segment 代表发生再分布的散列段的索引
+	Segment int
+	// Time 代表再分布发生的时间
+	Time time.Time
+	// OldBucketNumber 代表再分布之前的散列桶数量
+	OldBucketNumber int
+	// NewBucketNumber 代表再分布之后的散列桶数量
+	NewBucketNumber int
+}
+
+// Grow 判断本次再分布是否为扩容
+func (e RedistributionEvent) Grow() bool {
+	return e.NewBucketNumber > e.OldBucketNumber
+}
+
+// SegmentStats 代表单个散列段运行状况的快照
+type SegmentStats struct {
+	// PairTotal 代表键-元素对的数量
+	PairTotal uint64
+	// BucketNumber 代表散列桶的数量
+	BucketNumber int
+	// EmptyBucketNumber 代表空散列桶的数量
+	EmptyBucketNumber int
+	// MaxChainLength 代表最长的散列桶单链表的长度
+	MaxChainLength uint64
+	// ChainLengthHistogram 代表散列桶单链表长度的直方图
+	// 下标为单链表的长度,值为具有该长度的散列桶的数量
+	ChainLengthHistogram []uint64
+	// GrowCount 代表扩容的次数
+	GrowCount uint64
+	// ShrinkCount 代表缩容的次数
+	ShrinkCount uint64
+	// Redistributions 代表最近的再分布事件,按时间先后排列
+	Redistributions []RedistributionEvent
+	// Puts 代表放入或更新元素的次数
+	Puts uint64
+	// Hits 代表查找命中的次数
+	Hits uint64
+	// Misses 代表查找未命中的次数
+	Misses uint64
+	// Deletes 代表删除键-元素对的次数
+	Deletes uint64
+	// Expirations 代表因过期而删除键-元素对的次数
+	Expirations uint64
+	// Evictions 代表因超出容量而淘汰键-元素对的次数
+	Evictions uint64
+	// Cost 代表当前段中所有键-元素对的成本之和,未限制成本时为0
+	Cost int64
+	// LockWaitTime 代表等待段锁的累计时间
+	LockWaitTime time.Duration
+	// LockContentions 代表获取段锁时发生竞争的次数
+	LockContentions uint64
+}
+
+// Stats 代表字典运行状况的快照
+// 各散列段的快照是依次获取的,因此它们之间不保证处于同一时刻
+type Stats struct {
+	// Concurrency 代表并发量,即散列段的数量
+	Concurrency int
+	// PairTotal 代表键-元素对的总数
+	PairTotal uint64
+	// BucketTotal 代表散列桶的总数
+	BucketTotal int
+	// Segments 代表各散列段的快照,下标即散列段的索引
+	Segments []SegmentStats
+	// MaxChainLength 代表所有散列桶中最长的单链表的长度
+	MaxChainLength uint64
+	// ChainLengthHistogram 代表所有散列桶单链表长度的直方图
+	// 下标为单链表的长度,值为具有该长度的散列桶的数量
+	ChainLengthHistogram []uint64
+	// EmptyBucketRatio 代表空散列桶占散列桶总数的比例
+	EmptyBucketRatio float64
+	// GrowCount 代表所有散列段扩容的总次数
+	GrowCount uint64
+	// ShrinkCount 代表所有散列段缩容的总次数
+	ShrinkCount uint64
+	// Redistributions 代表各散列段最近的再分布事件,按时间先后排列
+	Redistributions []RedistributionEvent
+	// Puts 代表放入或更新元素的总次数
+	Puts uint64
+	// Hits 代表查找命中的总次数
+	Hits uint64
+	// Misses 代表查找未命中的总次数
+	Misses uint64
+	// HitRatio 代表查找命中的次数占查找总次数的比例
+	// 可用于比较不同淘汰策略的效果
+	HitRatio float64
+	// Deletes 代表删除键-元素对的总次数
+	Deletes uint64
+	// Expirations 代表因过期而删除键-元素对的总次数
+	Expirations uint64
+	// Evictions 代表因超出容量或成本预算而淘汰键-元素对的总次数
+	Evictions uint64
+	// Cost 代表所有键-元素对的成本之和,未限制成本时为0
+	Cost int64
+	// MaxCost 代表成本预算,未限制成本时为0
+	MaxCost int64
+	// LockWaitTime 代表等待段锁的累计时间
+	LockWaitTime time.Duration
+	// LockContentions 代表获取段锁时发生竞争的总次数
+	LockContentions uint64
+}
+
+// Stats 返回当前字典运行状况的快照
+// 调整并发量期间,Segments只包含旧散列段表中的散列段,而汇总的数据包含新旧两个散列段表
+// 调整之前的散列段表的累计计数(如Puts和Hits)会被保留
+func (cmap *myConcurrentMap[K, V]) Stats() Stats {
+	t := cmap.table.Load()
+	stats := Stats{
+		Concurrency: len(t.segments),
+		Segments:    make([]SegmentStats, len(t.segments)),
+	}
+	var emptyBucketTotal int
+	for i, s := range t.segments {
+		segmentStats := s.Stats()
+		for j := range segmentStats.Redistributions {
+			segmentStats.Redistributions[j].Segment = i
+		}
+		stats.Segments[i] = segmentStats
+		emptyBucketTotal += stats.merge(segmentStats)
+	}
+	for next := t.next.Load(); next != nil; next = next.next.Load() {
+		for i, s := range next.segments {
+			segmentStats := s.Stats()
+			for j := range segmentStats.Redistributions {
+				segmentStats.Redistributions[j].Segment = i
+			}
+			emptyBucketTotal += stats.merge(segmentStats)
+		}
+	}
+	stats.merge(t.retired)
+	if cmap.costs != nil {
+		stats.Cost = cmap.costs.total.Load()
+		stats.MaxCost = cmap.costs.maxCost
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	if stats.BucketTotal > 0 {
+		stats.EmptyBucketRatio = float64(emptyBucketTotal) / float64(stats.BucketTotal)
+	}
+	sort.SliceStable(stats.Redistributions, func(i, j int) bool {
+		return stats.Redistributions[i].Time.Before(stats.Redistributions[j].Time)
+	})
+	return stats
+}
+
+// merge 将单个散列段的快照累加到当前快照上
+// 返回值为该散列段中空散列桶的数量
+func (stats *Stats) merge(segmentStats SegmentStats) int {
+	stats.PairTotal += segmentStats.PairTotal
+	stats.BucketTotal += segmentStats.BucketNumber
+	if segmentStats.MaxChainLength > stats.MaxChainLength {
+		stats.MaxChainLength = segmentStats.MaxChainLength
+	}
+	stats.ChainLengthHistogram = mergeHistogram(stats.ChainLengthHistogram, segmentStats.ChainLengthHistogram)
+	stats.GrowCount += segmentStats.GrowCount
+	stats.ShrinkCount += segmentStats.ShrinkCount
+	stats.Redistributions = append(stats.Redistributions, segmentStats.Redistributions...)
+	stats.Puts += segmentStats.Puts
+	stats.Hits += segmentStats.Hits
+	stats.Misses += segmentStats.Misses
+	stats.Deletes += segmentStats.Deletes
+	stats.Expirations += segmentStats.Expirations
+	stats.Evictions += segmentStats.Evictions
+	stats.LockWaitTime += segmentStats.LockWaitTime
+	stats.LockContentions += segmentStats.LockContentions
+	return segmentStats.EmptyBucketNumber
+}
+
+// mergeHistogram 将直方图src累加到dst上并返回结果
+func mergeHistogram(dst, src []uint64) []uint64 {
+	for len(dst) < len(src) {
+		dst = append(dst, 0)
+	}
+	for i, count := range src {
+		dst[i] += count
+	}
+	return dst
+}
@@ -0,0 +1,85 @@
+package cmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCmapStats(t *testing.T) {
+	number := 20000
+	concurrency := 4
+	cm, _ := New[int, int](WithConcurrency(concurrency))
+	start := time.Now()
+	for i := 0; i < number; i++ {
+		_, _ = cm.Put(i, i)
+	}
+	stats := cm.Stats()
+	if stats.Concurrency != concurrency || len(stats.Segments) != concurrency {
+		t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d (segments: %d)",
+			concurrency, stats.Concurrency, len(stats.Segments))
+	}
+	if stats.PairTotal != uint64(number) {
+		t.Fatalf("Inconsistent pair total: expected: %d, actual: %d", number, stats.PairTotal)
+	}
+	var pairTotal, bucketTotal, histogramPairs uint64
+	for _, segmentStats := range stats.Segments {
+		pairTotal += segmentStats.PairTotal
+		bucketTotal += uint64(segmentStats.BucketNumber)
+	}
+	var histogramBuckets uint64
+	for length, count := range stats.ChainLengthHistogram {
+		histogramBuckets += count
+		histogramPairs += uint64(length) * count
+	}
+	if pairTotal != uint64(number) || histogramPairs != uint64(number) {
+		t.Fatalf("Inconsistent pair total: expected: %d, actual: %d (histogram: %d)",
+			number, pairTotal, histogramPairs)
+	}
+	if bucketTotal != uint64(stats.BucketTotal) || histogramBuckets != bucketTotal {
+		t.Fatalf("Inconsistent bucket total: expected: %d, actual: %d (histogram: %d)",
+			stats.BucketTotal, bucketTotal, histogramBuckets)
+	}
+	if stats.MaxChainLength != uint64(len(stats.ChainLengthHistogram)-1) {
+		t.Fatalf("Inconsistent max chain length: %d (histogram length: %d)",
+			stats.MaxChainLength, len(stats.ChainLengthHistogram))
+	}
+	if stats.EmptyBucketRatio < 0 || stats.EmptyBucketRatio > 1 {
+		t.Fatalf("Illegal empty bucket ratio: %f", stats.EmptyBucketRatio)
+	}
+	if stats.GrowCount == 0 || stats.ShrinkCount != 0 {
+		t.Fatalf("Inconsistent redistribution count: grow: %d, shrink: %d", stats.GrowCount, stats.ShrinkCount)
+	}
+	if uint64(len(stats.Redistributions)) > stats.GrowCount {
+		t.Fatalf("Too many redistribution events: %d (grow: %d)", len(stats.Redistributions), stats.GrowCount)
+	}
+	for i, event := range stats.Redistributions {
+		if !event.Grow() || event.Time.Before(start) {
+			t.Fatalf("Inconsistent redistribution event: %#v", event)
+		}
+		if i > 0 && event.Time.Before(stats.Redistributions[i-1].Time) {
+			t.Fatalf("Redistribution events are out of order: %#v", stats.Redistributions)
+		}
+		if event.Segment < 0 || event.Segment >= concurrency {
+			t.Fatalf("Illegal segment index of redistribution event: %d", event.Segment)
+		}
+	}
+}
+
+func TestSegmentStatsEventLimit(t *testing.T) {
+	s := newSegment[string, int](-1, nil, nil).(*segment[string, int])
+	for i := 0; i < MAX_REDISTRIBUTION_EVENTS*2; i++ {
+		s.recordRedistribution(i+1, i+2)
+	}
+	s.recordRedistribution(4, 2)
+	stats := s.Stats()
+	if stats.GrowCount != uint64(MAX_REDISTRIBUTION_EVENTS*2) || stats.ShrinkCount != 1 {
+		t.Fatalf("Inconsistent redistribution count: grow: %d, shrink: %d", stats.GrowCount, stats.ShrinkCount)
+	}
+	if len(stats.Redistributions) != MAX_REDISTRIBUTION_EVENTS {
+		t.Fatalf("Inconsistent event number: expected: %d, actual: %d",
+			MAX_REDISTRIBUTION_EVENTS, len(stats.Redistributions))
+	}
+	if last := stats.Redistributions[len(stats.Redistributions)-1]; last.Grow() {
+		t.Fatalf("Inconsistent last event: %#v", last)
+	}
+}
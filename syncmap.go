@@ -0,0 +1,110 @@
+package cmap
+
+import "sync"
+
+// syncMapElement 代表SyncMap中存储的元素
+// 由于字典不接受nil元素,所以这里对元素进行了一层包装,以便像sync.Map一样可以存储nil
+type syncMapElement struct {
+	value interface{}
+}
+
+// SyncMap 代表与sync.Map方法集兼容的并发安全字典
+// 其零值可直接使用,此时会采用默认的并发量
+type SyncMap struct {
+	once sync.Once
+	cmap *myConcurrentMap[interface{}, syncMapElement]
+}
+
+// NewSyncMap 创建一个SyncMap类型的实例
+func NewSyncMap(concurrency int) (*SyncMap, error) {
+	cmap, err := newConcurrentMap[interface{}, syncMapElement](concurrency, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncMap{cmap: cmap}, nil
+}
+
+// concurrentMap 返回底层的字典,必要时进行初始化
+func (m *SyncMap) concurrentMap() *myConcurrentMap[interface{}, syncMapElement] {
+	m.once.Do(func() {
+		if m.cmap == nil {
+			m.cmap, _ = newConcurrentMap[interface{}, syncMapElement](DEFAULT_CONCURRENCY, nil)
+		}
+	})
+	return m.cmap
+}
+
+// Load 返回与指定键关联的元素
+// 第二个返回值表示指定的键是否存在
+func (m *SyncMap) Load(key interface{}) (value interface{}, ok bool) {
+	element, ok := m.concurrentMap().get(key)
+	return element.value, ok
+}
+
+// Store 放入一个键-元素对
+func (m *SyncMap) Store(key, value interface{}) {
+	_, _ = m.concurrentMap().Put(key, syncMapElement{value})
+}
+
+// LoadOrStore 若指定的键已存在则返回其元素,否则放入并返回给定的元素
+// 第二个返回值表示元素是否是加载得到的
+func (m *SyncMap) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	loaded = true
+	element, _, _ := m.concurrentMap().ComputeIfAbsent(key, func() (syncMapElement, bool) {
+		loaded = false
+		return syncMapElement{value}, true
+	})
+	return element.value, loaded
+}
+
+// LoadAndDelete 删除指定的键-元素对并返回之前的元素
+// 第二个返回值表示指定的键是否存在
+func (m *SyncMap) LoadAndDelete(key interface{}) (value interface{}, loaded bool) {
+	_, _, _ = m.concurrentMap().compute(key, func(oldElement syncMapElement, exists bool) (syncMapElement, ComputeOperation) {
+		value, loaded = oldElement.value, exists
+		return oldElement, COMPUTE_DELETE
+	})
+	return value, loaded
+}
+
+// Delete 删除指定的键-元素对
+func (m *SyncMap) Delete(key interface{}) {
+	m.concurrentMap().Delete(key)
+}
+
+// Swap 放入一个键-元素对并返回之前的元素
+// 第二个返回值表示指定的键是否存在
+func (m *SyncMap) Swap(key, value interface{}) (previous interface{}, loaded bool) {
+	_, _, _ = m.concurrentMap().compute(key, func(oldElement syncMapElement, exists bool) (syncMapElement, ComputeOperation) {
+		previous, loaded = oldElement.value, exists
+		return syncMapElement{value}, COMPUTE_STORE
+	})
+	return previous, loaded
+}
+
+// CompareAndSwap 仅当指定键的当前元素等于old时才将其替换为new
+// 参数old必须是可比较的类型
+func (m *SyncMap) CompareAndSwap(key, old, new interface{}) (swapped bool) {
+	return m.concurrentMap().CompareAndSwap(key, syncMapElement{old}, syncMapElement{new})
+}
+
+// CompareAndDelete 仅当指定键的当前元素等于old时才删除该键-元素对
+// 参数old必须是可比较的类型
+func (m *SyncMap) CompareAndDelete(key, old interface{}) (deleted bool) {
+	return m.concurrentMap().CompareAndDelete(key, syncMapElement{old})
+}
+
+// Range 迭代所有的键-元素对,当f返回false时停止迭代
+func (m *SyncMap) Range(f func(key, value interface{}) bool) {
+	if f == nil {
+		return
+	}
+	m.concurrentMap().Range(func(key interface{}, element syncMapElement) bool {
+		return f(key, element.value)
+	})
+}
+
+// Clear 清空所有的键-元素对
+func (m *SyncMap) Clear() {
+	m.concurrentMap().Clear()
+}
@@ -0,0 +1,147 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSyncMapZeroValue(t *testing.T) {
+	var m SyncMap
+	if _, ok := m.Load("key"); ok {
+		t.Fatal("Loaded an absent key, but should not be the case!")
+	}
+	m.Store("key", nil)
+	value, ok := m.Load("key")
+	if !ok || value != nil {
+		t.Fatalf("Inconsistent value: expected: %#v, actual: %#v (ok: %v)", nil, value, ok)
+	}
+	m.Store(1, "one")
+	if value, ok := m.Load(1); !ok || value != "one" {
+		t.Fatalf("Inconsistent value: expected: %#v, actual: %#v (ok: %v)", "one", value, ok)
+	}
+}
+
+func TestSyncMapNew(t *testing.T) {
+	if _, err := NewSyncMap(0); err == nil {
+		t.Fatal("No error when new a sync map with concurrency 0, but should not be the case!")
+	}
+	m, err := NewSyncMap(8)
+	if err != nil {
+		t.Fatalf("An error occurs when new a sync map: %s", err)
+	}
+	m.Store("key", "value")
+	if value, ok := m.Load("key"); !ok || value != "value" {
+		t.Fatalf("Inconsistent value: expected: %#v, actual: %#v (ok: %v)", "value", value, ok)
+	}
+}
+
+func TestSyncMapLoadOrStoreAndSwap(t *testing.T) {
+	var m SyncMap
+	actual, loaded := m.LoadOrStore("key", 1)
+	if loaded || actual != 1 {
+		t.Fatalf("Inconsistent result: actual: %#v, loaded: %v", actual, loaded)
+	}
+	actual, loaded = m.LoadOrStore("key", 2)
+	if !loaded || actual != 1 {
+		t.Fatalf("Inconsistent result: actual: %#v, loaded: %v", actual, loaded)
+	}
+	previous, loaded := m.Swap("key", 3)
+	if !loaded || previous != 1 {
+		t.Fatalf("Inconsistent result: previous: %#v, loaded: %v", previous, loaded)
+	}
+	previous, loaded = m.Swap("other", 4)
+	if loaded || previous != nil {
+		t.Fatalf("Inconsistent result: previous: %#v, loaded: %v", previous, loaded)
+	}
+	value, loaded := m.LoadAndDelete("key")
+	if !loaded || value != 3 {
+		t.Fatalf("Inconsistent result: value: %#v, loaded: %v", value, loaded)
+	}
+	value, loaded = m.LoadAndDelete("key")
+	if loaded || value != nil {
+		t.Fatalf("Inconsistent result: value: %#v, loaded: %v", value, loaded)
+	}
+	m.Delete("other")
+	if _, ok := m.Load("other"); ok {
+		t.Fatal("Loaded a deleted key, but should not be the case!")
+	}
+}
+
+func TestSyncMapCompareAndSwap(t *testing.T) {
+	var m SyncMap
+	if m.CompareAndSwap("key", nil, 1) {
+		t.Fatal("Swapped an absent key, but should not be the case!")
+	}
+	m.Store("key", nil)
+	if !m.CompareAndSwap("key", nil, 1) {
+		t.Fatal("Couldn't swap with a matched old value!")
+	}
+	if m.CompareAndSwap("key", 2, 3) {
+		t.Fatal("Swapped with a mismatched old value, but should not be the case!")
+	}
+	if m.CompareAndDelete("key", 2) {
+		t.Fatal("Deleted with a mismatched old value, but should not be the case!")
+	}
+	if !m.CompareAndDelete("key", 1) {
+		t.Fatal("Couldn't delete with a matched old value!")
+	}
+}
+
+func TestSyncMapRangeAndClear(t *testing.T) {
+	number := 100
+	var m SyncMap
+	for i := 0; i < number; i++ {
+		m.Store(fmt.Sprintf("key%d", i), i)
+	}
+	var count int
+	m.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != number {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", number, count)
+	}
+	count = 0
+	m.Range(func(key, value interface{}) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", 10, count)
+	}
+	m.Clear()
+	m.Range(func(key, value interface{}) bool {
+		t.Fatalf("Found a key-value after clear! (key: %#v, value: %#v)", key, value)
+		return false
+	})
+	if m.concurrentMap().Len() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 0, m.concurrentMap().Len())
+	}
+}
+
+func TestSyncMapInParallel(t *testing.T) {
+	goroutineNumber := 20
+	number := 200
+	var m SyncMap
+	var wg sync.WaitGroup
+	wg.Add(goroutineNumber)
+	for i := 0; i < goroutineNumber; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < number; j++ {
+				key := fmt.Sprintf("%d-%d", i, j)
+				m.Store(key, j)
+				if value, ok := m.Load(key); !ok || value != j {
+					t.Errorf("Inconsistent value: expected: %#v, actual: %#v (ok: %v)", j, value, ok)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	expected := uint64(goroutineNumber * number)
+	if m.concurrentMap().Len() != expected {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", expected, m.concurrentMap().Len())
+	}
+}
@@ -0,0 +1,378 @@
+package cmap
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+)
+
+const (
+	// TINYLFU_WINDOW_RATIO 代表准入窗口占容量的比例
+	TINYLFU_WINDOW_RATIO float64 = 0.01
+	// TINYLFU_PROTECTED_RATIO 代表保护区占主区容量的比例
+	TINYLFU_PROTECTED_RATIO float64 = 0.8
+	// TINYLFU_SAMPLE_FACTOR 代表频率草图的样本量与容量之比
+	// 记录的访问次数达到样本量时,所有计数器都会减半,以便淡化过去的访问
+	TINYLFU_SAMPLE_FACTOR int = 10
+)
+
+// tinyLFURegion 代表键所在的区域
+type tinyLFURegion uint8
+
+const (
+	// tinyLFUWindow 代表准入窗口
+	tinyLFUWindow tinyLFURegion = 0
+	// tinyLFUProbation 代表主区中的试用区
+	tinyLFUProbation tinyLFURegion = 1
+	// tinyLFUProtected 代表主区中的保护区
+	tinyLFUProtected tinyLFURegion = 2
+)
+
+// tinyLFUEntry 代表W-TinyLFU中的一个键
+type tinyLFUEntry[K comparable] struct {
+	key    K
+	region tinyLFURegion
+}
+
+// tinyLFUPolicy 代表基于W-TinyLFU算法的EvictionPolicy的实现类型
+// 新增的键先进入一个小的LRU准入窗口,被挤出窗口后成为候选者进入主区的试用区,
+// 当需要淘汰时,候选者与试用区中最久未使用的键比较访问频率,频率较低者被淘汰,
+// 试用区中再次被访问的键会晋升到保护区
+// 访问频率由计数最小草图(count-min sketch)近似地记录,因此一次性扫描的键很难挤掉热点键
+type tinyLFUPolicy[K comparable] struct {
+	// sketch 代表记录访问频率的计数最小草图
+	sketch *countMinSketch
+	// seed 代表计算键的哈希值时使用的种子
+	seed maphash.Seed
+	// window 代表准入窗口
+	window *list.List
+	// probation 代表试用区
+	probation *list.List
+	// protected 代表保护区
+	protected *list.List
+	// windowCapacity 代表准入窗口的容量
+	windowCapacity int
+	// protectedCapacity 代表保护区的容量
+	protectedCapacity int
+	// elements 代表键与其在链表中的位置的映射
+	elements map[K]*list.Element
+	// candidate 代表最近被挤出准入窗口、尚未经过淘汰比较的键
+	candidate *list.Element
+	// lock 保护以上所有字段的互斥锁
+	lock sync.Mutex
+}
+
+// NewTinyLFUPolicy 创建一个基于W-TinyLFU算法的EvictionPolicy类型的实例
+// 它适用于含有大量一次性扫描访问的负载
+func NewTinyLFUPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	windowCapacity := int(float64(capacity) * TINYLFU_WINDOW_RATIO)
+	if windowCapacity < 1 {
+		windowCapacity = 1
+	}
+	protectedCapacity := int(float64(capacity-windowCapacity) * TINYLFU_PROTECTED_RATIO)
+	return &tinyLFUPolicy[K]{
+		sketch:            newCountMinSketch(capacity),
+		seed:              maphash.MakeSeed(),
+		window:            list.New(),
+		probation:         list.New(),
+		protected:         list.New(),
+		windowCapacity:    windowCapacity,
+		protectedCapacity: protectedCapacity,
+		elements:          make(map[K]*list.Element, capacity),
+	}
+}
+
+// Access 记录一次对已有键的访问
+func (p *tinyLFUPolicy[K]) Access(key K) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sketch.increment(maphash.Comparable(p.seed, key))
+	e, ok := p.elements[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*tinyLFUEntry[K])
+	switch entry.region {
+	case tinyLFUWindow:
+		p.window.MoveToFront(e)
+	case tinyLFUProbation:
+		p.promote(e)
+	case tinyLFUProtected:
+		p.protected.MoveToFront(e)
+	}
+}
+
+// recordMiss 记录一次对不存在的键的访问,只增加该键的访问频率
+func (p *tinyLFUPolicy[K]) recordMiss(key K) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sketch.increment(maphash.Comparable(p.seed, key))
+}
+
+// Add 记录一个新增的键
+func (p *tinyLFUPolicy[K]) Add(key K) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sketch.increment(maphash.Comparable(p.seed, key))
+	if _, ok := p.elements[key]; ok {
+		return
+	}
+	p.elements[key] = p.window.PushFront(&tinyLFUEntry[K]{key: key, region: tinyLFUWindow})
+	p.overflowWindow()
+}
+
+// Remove 记录一个被删除的键
+func (p *tinyLFUPolicy[K]) Remove(key K) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if e, ok := p.elements[key]; ok {
+		p.unlink(e)
+	}
+}
+
+// Evict 选出并移除一个应被淘汰的键
+// 若存在候选者,则淘汰候选者与试用区中最久未使用的键中访问频率较低的那个
+func (p *tinyLFUPolicy[K]) Evict() (K, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var victim *list.Element
+	switch {
+	case p.probation.Len() > 0:
+		victim = p.probation.Back()
+		if candidate := p.candidate; candidate != nil && candidate != victim {
+			candidateKey := candidate.Value.(*tinyLFUEntry[K]).key
+			victimKey := victim.Value.(*tinyLFUEntry[K]).key
+			if p.frequency(candidateKey) <= p.frequency(victimKey) {
+				victim = candidate
+			}
+		}
+	case p.protected.Len() > 0:
+		victim = p.protected.Back()
+	case p.window.Len() > 0:
+		victim = p.window.Back()
+	default:
+		var zero K
+		return zero, false
+	}
+	p.candidate = nil
+	key := victim.Value.(*tinyLFUEntry[K]).key
+	p.unlink(victim)
+	return key, true
+}
+
+// Clear 移除所有的键
+func (p *tinyLFUPolicy[K]) Clear() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.window.Init()
+	p.probation.Init()
+	p.protected.Init()
+	p.elements = make(map[K]*list.Element)
+	p.candidate = nil
+	p.sketch.clear()
+}
+
+// export 按淘汰顺序返回所有键的状态,即依次为试用区、保护区和准入窗口中从最久未使用到最近使用的键
+// 键的状态中包含其所在的区域和近似访问频率
+func (p *tinyLFUPolicy[K]) export() []policyEntry[K] {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	entries := make([]policyEntry[K], 0, len(p.elements))
+	for _, l := range []*list.List{p.probation, p.protected, p.window} {
+		for e := l.Back(); e != nil; e = e.Prev() {
+			entry := e.Value.(*tinyLFUEntry[K])
+			entries = append(entries, policyEntry[K]{
+				key:       entry.key,
+				region:    uint8(entry.region),
+				frequency: p.frequency(entry.key),
+			})
+		}
+	}
+	return entries
+}
+
+// adopt 按顺序记录由export返回的键的状态,越靠后的键越晚被淘汰
+// 键会被放回原来所在的区域,其访问频率也会被恢复,超出区域容量的键按照常规的规则挤出或降级
+func (p *tinyLFUPolicy[K]) adopt(entries []policyEntry[K]) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, e := range entries {
+		p.sketch.raise(maphash.Comparable(p.seed, e.key), e.frequency)
+		if old, ok := p.elements[e.key]; ok {
+			p.unlink(old)
+		}
+		entry := &tinyLFUEntry[K]{key: e.key, region: tinyLFURegion(e.region)}
+		switch entry.region {
+		case tinyLFUProbation:
+			p.elements[e.key] = p.probation.PushFront(entry)
+		case tinyLFUProtected:
+			p.elements[e.key] = p.protected.PushFront(entry)
+			p.overflowProtected()
+		default:
+			entry.region = tinyLFUWindow
+			p.elements[e.key] = p.window.PushFront(entry)
+			p.overflowWindow()
+		}
+	}
+}
+
+// frequency 返回键的近似访问频率
+// 注意!必须在互斥锁的保护下调用本方法
+func (p *tinyLFUPolicy[K]) frequency(key K) uint8 {
+	return p.sketch.estimate(maphash.Comparable(p.seed, key))
+}
+
+// promote 将试用区中的键晋升到保护区
+// 若保护区已满,则将其中最久未使用的键降级到试用区
+// 注意!必须在互斥锁的保护下调用本方法
+func (p *tinyLFUPolicy[K]) promote(e *list.Element) {
+	if e == p.candidate {
+		p.candidate = nil
+	}
+	entry := p.probation.Remove(e).(*tinyLFUEntry[K])
+	entry.region = tinyLFUProtected
+	p.elements[entry.key] = p.protected.PushFront(entry)
+	p.overflowProtected()
+}
+
+// overflowWindow 若准入窗口已满,则挤出其中最久未使用的键作为候选者
+// 注意!必须在互斥锁的保护下调用本方法
+func (p *tinyLFUPolicy[K]) overflowWindow() {
+	if p.window.Len() <= p.windowCapacity {
+		return
+	}
+	e := p.window.Back()
+	entry := p.window.Remove(e).(*tinyLFUEntry[K])
+	entry.region = tinyLFUProbation
+	p.candidate = p.probation.PushFront(entry)
+	p.elements[entry.key] = p.candidate
+}
+
+// overflowProtected 若保护区已满,则将其中最久未使用的键降级到试用区
+// 注意!必须在互斥锁的保护下调用本方法
+func (p *tinyLFUPolicy[K]) overflowProtected() {
+	for p.protected.Len() > p.protectedCapacity {
+		demoted := p.protected.Remove(p.protected.Back()).(*tinyLFUEntry[K])
+		demoted.region = tinyLFUProbation
+		p.elements[demoted.key] = p.probation.PushFront(demoted)
+	}
+}
+
+// unlink 从所在的区域中移除键
+// 注意!必须在互斥锁的保护下调用本方法
+func (p *tinyLFUPolicy[K]) unlink(e *list.Element) {
+	if e == p.candidate {
+		p.candidate = nil
+	}
+	entry := e.Value.(*tinyLFUEntry[K])
+	switch entry.region {
+	case tinyLFUWindow:
+		p.window.Remove(e)
+	case tinyLFUProbation:
+		p.probation.Remove(e)
+	case tinyLFUProtected:
+		p.protected.Remove(e)
+	}
+	delete(p.elements, entry.key)
+}
+
+// COUNT_MIN_SKETCH_DEPTH 代表计数最小草图的行数
+const COUNT_MIN_SKETCH_DEPTH int = 4
+
+// COUNT_MIN_SKETCH_MAX_COUNT 代表单个计数器的最大值
+const COUNT_MIN_SKETCH_MAX_COUNT uint8 = 15
+
+// countMinSketch 代表计数最小草图
+// 它用固定的空间近似地记录各个哈希值出现的次数,估计值只会偏大不会偏小
+// 注意!它不是并发安全的
+type countMinSketch struct {
+	// counters 代表各行的计数器
+	counters [COUNT_MIN_SKETCH_DEPTH][]uint8
+	// mask 代表计算计数器下标时使用的掩码
+	mask uint64
+	// additions 代表自上次减半以来记录的次数
+	additions int
+	// sampleSize 代表样本量,记录的次数达到此值时所有计数器减半
+	sampleSize int
+}
+
+// newCountMinSketch 创建一个countMinSketch类型的实例
+// 参数capacity代表预计需要区分的键的数量
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := ceilPowerOfTwo(capacity)
+	if width < 16 {
+		width = 16
+	}
+	s := &countMinSketch{
+		mask:       uint64(width - 1),
+		sampleSize: capacity * TINYLFU_SAMPLE_FACTOR,
+	}
+	for i := range s.counters {
+		s.counters[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index 返回哈希值在第row行中对应的计数器下标
+func (s *countMinSketch) index(keyHash uint64, row int) uint64 {
+	h := mixHash(keyHash + uint64(row)*0x9e3779b97f4a7c15)
+	return h & s.mask
+}
+
+// increment 记录一次哈希值的出现
+func (s *countMinSketch) increment(keyHash uint64) {
+	for row := range s.counters {
+		i := s.index(keyHash, row)
+		if s.counters[row][i] < COUNT_MIN_SKETCH_MAX_COUNT {
+			s.counters[row][i]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate 返回哈希值出现次数的估计值
+func (s *countMinSketch) estimate(keyHash uint64) uint8 {
+	count := COUNT_MIN_SKETCH_MAX_COUNT
+	for row := range s.counters {
+		if c := s.counters[row][s.index(keyHash, row)]; c < count {
+			count = c
+		}
+	}
+	return count
+}
+
+// raise 将哈希值的计数提高到至少count,不计入样本量
+// 用于迁移淘汰状态时恢复访问频率
+func (s *countMinSketch) raise(keyHash uint64, count uint8) {
+	count = min(count, COUNT_MIN_SKETCH_MAX_COUNT)
+	for row := range s.counters {
+		i := s.index(keyHash, row)
+		if s.counters[row][i] < count {
+			s.counters[row][i] = count
+		}
+	}
+}
+
+// reset 将所有计数器减半
+func (s *countMinSketch) reset() {
+	for row := range s.counters {
+		for i := range s.counters[row] {
+			s.counters[row][i] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// clear 将所有计数器清零
+func (s *countMinSketch) clear() {
+	for row := range s.counters {
+		clear(s.counters[row])
+	}
+	s.additions = 0
+}
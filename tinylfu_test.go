@@ -0,0 +1,111 @@
+package cmap
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch(64)
+	for i := 0; i < 10; i++ {
+		s.increment(1)
+	}
+	s.increment(2)
+	if c := s.estimate(1); c < 10 {
+		t.Fatalf("Inconsistent estimate: expected: >= %d, actual: %d", 10, c)
+	}
+	if c := s.estimate(2); c < 1 {
+		t.Fatalf("Inconsistent estimate: expected: >= %d, actual: %d", 1, c)
+	}
+	for i := 0; i < 100; i++ {
+		s.increment(3)
+	}
+	if c := s.estimate(3); c != COUNT_MIN_SKETCH_MAX_COUNT {
+		t.Fatalf("Inconsistent saturated estimate: expected: %d, actual: %d", COUNT_MIN_SKETCH_MAX_COUNT, c)
+	}
+	s.reset()
+	if c := s.estimate(3); c != COUNT_MIN_SKETCH_MAX_COUNT/2 {
+		t.Fatalf("Inconsistent estimate after reset: expected: %d, actual: %d", COUNT_MIN_SKETCH_MAX_COUNT/2, c)
+	}
+	s.clear()
+	if c := s.estimate(1); c != 0 {
+		t.Fatalf("Inconsistent estimate after clear: expected: %d, actual: %d", 0, c)
+	}
+}
+
+func TestTinyLFUPolicy(t *testing.T) {
+	p := NewTinyLFUPolicy[string](10)
+	for i := 0; i < 10; i++ {
+		p.Add(strconv.Itoa(i))
+	}
+	// 频繁访问键"1",使它晋升到保护区
+	for i := 0; i < 5; i++ {
+		p.Access("1")
+	}
+	p.Add("new")
+	key, ok := p.Evict()
+	if !ok || key == "1" {
+		t.Fatalf("Inconsistent victim: %q (%v)", key, ok)
+	}
+	p.Remove("1")
+	p.Clear()
+	if _, ok := p.Evict(); ok {
+		t.Fatal("Evicted a key after clearing, but should not be the case!")
+	}
+}
+
+// replayTrace 在给定淘汰策略的字典上回放一段热点访问夹杂一次性扫描的访问序列,并返回命中率
+func replayTrace(t *testing.T, factory EvictionPolicyFactory[string]) float64 {
+	cm, err := New[string, int](WithConcurrency(1), WithMaxEntries(100), WithEvictionPolicy(factory))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		var key string
+		if r.Intn(2) == 0 {
+			key = "hot-" + strconv.Itoa(r.Intn(80))
+		} else {
+			key = "scan-" + strconv.Itoa(i)
+		}
+		if _, ok := cm.(*myConcurrentMap[string, int]).get(key); !ok {
+			cm.Put(key, i)
+		}
+	}
+	return cm.Stats().HitRatio
+}
+
+func TestTinyLFUAdmitsMissedKey(t *testing.T) {
+	number := 100
+	cm, err := New[string, int](WithConcurrency(1), WithMaxEntries(number),
+		WithEvictionPolicy(NewTinyLFUPolicy[string]))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i := 0; i < number; i++ {
+		cm.Put("cold"+strconv.Itoa(i), i+1)
+	}
+	// 频繁未命中的键在放入时应被接纳,而只被放入过一次的键应被淘汰
+	for i := 0; i < 5; i++ {
+		cm.Get("hot")
+	}
+	cm.Put("hot", -1)
+	cm.Put("next", -2)
+	if cm.Get("hot") != -1 {
+		t.Fatal("The repeatedly missed key is not admitted!")
+	}
+	if cm.Get("cold0") != 0 {
+		t.Fatal("The cold key is not evicted!")
+	}
+}
+
+func TestTinyLFUScanResistance(t *testing.T) {
+	lruHitRatio := replayTrace(t, NewLRUPolicy[string])
+	tinyLFUHitRatio := replayTrace(t, NewTinyLFUPolicy[string])
+	t.Logf("Hit ratio: LRU: %.3f, W-TinyLFU: %.3f", lruHitRatio, tinyLFUHitRatio)
+	if tinyLFUHitRatio <= lruHitRatio {
+		t.Fatalf("W-TinyLFU does not outperform LRU on a scan-heavy trace: LRU: %.3f, W-TinyLFU: %.3f",
+			lruHitRatio, tinyLFUHitRatio)
+	}
+}
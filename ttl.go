@@ -0,0 +1,81 @@
+package cmap
+
+import (
+	"time"
+	"weak"
+)
+
+// DEFAULT_JANITOR_INTERVAL 代表清理过期键-元素对的默认间隔时间
+const DEFAULT_JANITOR_INTERVAL time.Duration = time.Minute
+
+// Clock 代表时钟的接口
+// 用于计算和判断键-元素对的过期时间,可以在测试中替换为可控的实现
+type Clock interface {
+	// Now 返回当前时间
+	Now() time.Time
+}
+
+// systemClock 代表基于系统时间的Clock的实现类型
+type systemClock struct{}
+
+// Now 返回当前时间
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// isExpired 判断键-元素对在给定时刻(Unix纳秒)是否已过期
+func isExpired[K comparable, V any](p Pair[K, V], now int64) bool {
+	expiry := p.Expiry()
+	return expiry != 0 && expiry <= now
+}
+
+// expiryAfter 根据给定的时钟和存活时间计算过期时间(Unix纳秒)
+// 若参数ttl不大于0,则返回0,代表永不过期
+func expiryAfter(clock Clock, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return clock.Now().Add(ttl).UnixNano()
+}
+
+// PutWithTTL 推送一个在ttl之后过期的键-元素对
+// 注意!参数element的值不能为nil
+// 若参数ttl不大于0,则键-元素对永不过期
+// 之后通过Put等方法重新放入该键时会重新采用字典默认的存活时间,
+// 而Compute、Merge等方法原地更新该键的元素时沿用参数ttl,并重新开始计时
+// 第一个返回值表示是否新增了键-元素对
+func (cmap *myConcurrentMap[K, V]) PutWithTTL(key K, element V, ttl time.Duration) (bool, error) {
+	return cmap.put(key, element, ttl)
+}
+
+// startJanitor 启动在后台清理过期键-元素对的Goroutine
+// 多次调用只会启动一次
+func (cmap *myConcurrentMap[K, V]) startJanitor() {
+	cmap.janitorOnce.Do(func() {
+		go runJanitor(weak.Make(cmap), cmap.janitorInterval)
+	})
+}
+
+// runJanitor 每隔interval清理一次过期的键-元素对
+// 它只持有字典的弱指针,字典被回收之后即退出,因此无需显式地停止
+func runJanitor[K comparable, V any](wp weak.Pointer[myConcurrentMap[K, V]], interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cmap := wp.Value()
+		if cmap == nil {
+			return
+		}
+		cmap.removeExpired()
+	}
+}
+
+// removeExpired 逐个散列段地删除过期的键-元素对
+// 返回值为被删除的键-元素对的数量
+func (cmap *myConcurrentMap[K, V]) removeExpired() uint64 {
+	var removed uint64
+	cmap.eachSegment(func(s Segment[K, V]) {
+		removed += s.RemoveExpired()
+	})
+	return removed
+}
@@ -0,0 +1,175 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 代表可以手动拨动的时钟
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestPutWithTTL(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](WithClock(clock))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if ok, err := cm.PutWithTTL("a", 1, time.Second); !ok || err != nil {
+		t.Fatalf("Couldn't put pair with ttl: ok: %v, error: %v", ok, err)
+	}
+	cm.Put("b", 2)
+	if cm.Get("a") != 1 || cm.Len() != 2 {
+		t.Fatalf("Inconsistent map before expiration: a: %d, len: %d", cm.Get("a"), cm.Len())
+	}
+	clock.Advance(time.Second)
+	if cm.Get("a") != 0 {
+		t.Fatalf("The expired pair is visible to Get: %d", cm.Get("a"))
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 1, cm.Len())
+	}
+	cm.ForEach(func(key string, _ int) {
+		if key == "a" {
+			t.Fatal("The expired pair is visible to ForEach!")
+		}
+	})
+	hm := cm.(*myConcurrentMap[string, int])
+	// size不检查是否过期,过期的键-元素对被清除之前仍计入其中
+	if hm.size() != 2 {
+		t.Fatalf("Inconsistent map size: expected: %d, actual: %d", 2, hm.size())
+	}
+	if removed := hm.removeExpired(); removed != 1 {
+		t.Fatalf("Inconsistent removed number: expected: %d, actual: %d", 1, removed)
+	}
+	stats := cm.Stats()
+	if stats.PairTotal != 1 || stats.Expirations != 1 {
+		t.Fatalf("Inconsistent stats after removing expired pairs: %+v", stats)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](WithClock(clock), WithTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	var deleted []string
+	cm.Hooks().OnDelete(func(event Event[string, int]) {
+		deleted = append(deleted, event.Key)
+	})
+	cm.Put("a", 1)
+	cm.Compute("b", func(int, bool) (int, bool) { return 2, true })
+	cm.PutWithTTL("c", 3, 0)
+	clock.Advance(time.Minute)
+	if cm.Len() != 1 || cm.Get("c") != 3 {
+		t.Fatalf("Inconsistent map after expiration: len: %d, c: %d", cm.Len(), cm.Get("c"))
+	}
+	// 向已过期的键放入元素应视为新增
+	if ok, err := cm.PutIfAbsent("a", 4); !ok || err != nil {
+		t.Fatalf("Couldn't put pair to an expired key: ok: %v, error: %v", ok, err)
+	}
+	if ok, _ := cm.Put("b", 5); !ok {
+		t.Fatal("Putting to an expired key is not treated as insertion!")
+	}
+	if len(deleted) != 2 || deleted[0] != "a" || deleted[1] != "b" {
+		t.Fatalf("Inconsistent deleted keys: %v", deleted)
+	}
+	if cm.Delete("missing") {
+		t.Fatal("Deleted a missing key!")
+	}
+	clock.Advance(time.Minute)
+	if cm.Delete("a") {
+		t.Fatal("Deleted an expired key, but should not be the case!")
+	}
+	if cm.Stats().PairTotal != 2 {
+		t.Fatalf("Inconsistent pair total: expected: %d, actual: %d", 2, cm.Stats().PairTotal)
+	}
+}
+
+func TestComputeKeepsTTL(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](WithClock(clock), WithTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.PutWithTTL("a", 1, time.Minute)
+	cm.PutWithTTL("b", 1, 0)
+	clock.Advance(30 * time.Second)
+	// 原地更新沿用该键自身的存活时间,而不是字典默认的存活时间
+	cm.Compute("a", func(old int, _ bool) (int, bool) { return old + 1, true })
+	cm.Merge("b", 1, func(old, element int) (int, bool) { return old + element, true })
+	clock.Advance(50 * time.Second)
+	if cm.Get("a") != 2 {
+		t.Fatalf("The computed pair expires too early: %d", cm.Get("a"))
+	}
+	cm.ComputeIfPresent("a", func(old int) (int, bool) { return old + 1, true })
+	clock.Advance(time.Minute)
+	if cm.Get("a") != 0 {
+		t.Fatalf("The computed pair does not expire with its own ttl: %d", cm.Get("a"))
+	}
+	clock.Advance(2 * time.Hour)
+	if cm.Get("b") != 2 {
+		t.Fatalf("The merged pair without ttl expires: %d", cm.Get("b"))
+	}
+}
+
+func TestRemoveExpiredRenewed(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](WithClock(clock), WithConcurrency(1))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	cm.PutWithTTL("a", 1, time.Second)
+	cm.PutWithTTL("b", 2, time.Second)
+	clock.Advance(time.Second)
+	cm.PutWithTTL("a", 3, time.Second)
+	hm := cm.(*myConcurrentMap[string, int])
+	if removed := hm.removeExpired(); removed != 1 {
+		t.Fatalf("Inconsistent removed number: expected: %d, actual: %d", 1, removed)
+	}
+	if cm.Get("a") != 3 || cm.Len() != 1 {
+		t.Fatalf("Inconsistent map after removing expired pairs: a: %d, len: %d", cm.Get("a"), cm.Len())
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	clock := newFakeClock()
+	cm, err := New[string, int](WithClock(clock), WithJanitorInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		cm.PutWithTTL(string(rune('a'+i%26))+string(rune('0'+i/26)), i, time.Second)
+	}
+	clock.Advance(time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for cm.Stats().PairTotal != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("The janitor did not remove expired pairs: %d left", cm.Stats().PairTotal)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if expirations := cm.Stats().Expirations; expirations != 100 {
+		t.Fatalf("Inconsistent expirations: expected: %d, actual: %d", 100, expirations)
+	}
+}
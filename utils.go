@@ -4,7 +4,8 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/binary"
-	"log"
+	"log/slog"
+	"math/bits"
 )
 
 // hash 计算给定字符串的哈希值的整数形式(BKDR哈希算法)
@@ -25,11 +26,50 @@ func hash2(str string) uint64 {
 	return num
 }
 
-var DEBUG = false
+// fnv1a 计算给定字符串的哈希值的整数形式(FNV-1a哈希算法)
+func fnv1a(str string) uint64 {
+	const (
+		offset64 uint64 = 14695981039346656037
+		prime64  uint64 = 1099511628211
+	)
+	hash := offset64
+	for i := 0; i < len(str); i++ {
+		hash ^= uint64(str[i])
+		hash *= prime64
+	}
+	return hash
+}
+
+// mixHash 对给定的哈希值进行混淆(MurmurHash3的fmix64)
+// 混淆后哈希值的每一位都与原哈希值的所有位相关
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
 
-// logMsg 打印信息
-func logMsg(format string, v ...interface{}) {
-	if DEBUG {
-		log.Printf(format, v...)
+// ceilPowerOfTwo 返回不小于n的最小的2的幂
+func ceilPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
 	}
+	return 1 << bits.Len(uint(n-1))
 }
+
+// isNil 判断给定元素是否为nil
+// 只有当元素类型为接口类型且值为nil时才返回true
+func isNil[V any](element V) bool {
+	return any(element) == nil
+}
+
+// equalElement 判断两个元素是否相等
+// 若元素的动态类型不可比较则会引发恐慌
+func equalElement[V any](a, b V) bool {
+	return any(a) == any(b)
+}
+
+// discardLogger 代表丢弃所有日志的日志记录器
+var discardLogger = slog.New(slog.DiscardHandler)
@@ -0,0 +1,644 @@
+package cmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WALSyncPolicy 代表预写日志同步到磁盘的策略
+type WALSyncPolicy uint8
+
+const (
+	// WAL_SYNC_ALWAYS 代表每个写操作返回之前都将其记录同步到磁盘
+	// 同步是在释放段锁之后进行的,同时等待同步的写操作共享一次同步(组提交),
+	// 但每个写操作仍要等待一次磁盘同步,其延迟远高于其他策略
+	WAL_SYNC_ALWAYS WALSyncPolicy = 0
+	// WAL_SYNC_INTERVAL 代表每隔一段时间同步一次
+	// 进程崩溃不会丢失记录,但操作系统崩溃或断电时会丢失最近一段时间的记录
+	WAL_SYNC_INTERVAL WALSyncPolicy = 1
+	// WAL_SYNC_NEVER 代表从不主动同步,由操作系统决定何时写入磁盘
+	WAL_SYNC_NEVER WALSyncPolicy = 2
+)
+
+const (
+	// WAL_MAGIC 代表预写日志开头的魔数
+	WAL_MAGIC string = "CWAL"
+	// WAL_VERSION 代表预写日志格式的版本
+	WAL_VERSION uint8 = 1
+	// DEFAULT_WAL_SYNC_INTERVAL 代表默认的同步间隔时间
+	DEFAULT_WAL_SYNC_INTERVAL time.Duration = time.Second
+	// DEFAULT_WAL_COMPACT_THRESHOLD 代表默认的压缩阈值(字节)
+	DEFAULT_WAL_COMPACT_THRESHOLD int64 = 64 << 20
+	// MAX_WAL_RECORD_SIZE 代表单条记录的最大字节数
+	// 长度超过此值的记录会被视为损坏
+	MAX_WAL_RECORD_SIZE uint32 = 1 << 30
+)
+
+// 预写日志的格式如下:
+//
+//	魔数 "CWAL"
+//	版本 (1字节)
+//	对每条记录: 内容的长度 (4字节,大端序) | 内容的CRC32校验和 (4字节,大端序) | 内容
+//
+// 记录的内容以记录类型(1字节)开头,之后的整数均采用varint编码:
+//
+//	放入: 键的长度 | 键 | 元素的长度 | 元素 | 过期时间
+//	删除: 键的长度 | 键
+
+// walRecordType 代表预写日志记录的类型
+type walRecordType uint8
+
+const (
+	// walRecordPut 代表放入键-元素对的记录
+	walRecordPut walRecordType = 1
+	// walRecordDelete 代表删除键的记录
+	walRecordDelete walRecordType = 2
+)
+
+// walHeaderSize 代表记录头部的字节数
+const walHeaderSize = 8
+
+// WALOption 代表预写日志的可选配置项
+type WALOption func(opts *walOptions) error
+
+// walOptions 代表预写日志的配置
+type walOptions struct {
+	// syncPolicy 代表同步到磁盘的策略
+	syncPolicy WALSyncPolicy
+	// syncInterval 代表同步间隔时间,仅在syncPolicy为WAL_SYNC_INTERVAL时有效
+	syncInterval time.Duration
+	// compactThreshold 代表压缩阈值(字节)
+	compactThreshold int64
+}
+
+// WithWALSyncPolicy 设置预写日志同步到磁盘的策略
+// 默认为WAL_SYNC_INTERVAL
+// 注意!无论采用哪种策略,记录都是在持有段锁及日志的互斥锁时写入文件的,
+// 因此所有散列段的写操作会在写入日志时相互等待
+func WithWALSyncPolicy(policy WALSyncPolicy) WALOption {
+	return func(opts *walOptions) error {
+		switch policy {
+		case WAL_SYNC_ALWAYS, WAL_SYNC_INTERVAL, WAL_SYNC_NEVER:
+		default:
+			return newIllegalParameterError(fmt.Sprintf("unknown wal sync policy: %d", policy))
+		}
+		opts.syncPolicy = policy
+		return nil
+	}
+}
+
+// WithWALSyncInterval 设置预写日志的同步间隔时间,并采用WAL_SYNC_INTERVAL策略
+func WithWALSyncInterval(interval time.Duration) WALOption {
+	return func(opts *walOptions) error {
+		if interval <= 0 {
+			return newIllegalParameterError("wal sync interval is too small")
+		}
+		opts.syncPolicy = WAL_SYNC_INTERVAL
+		opts.syncInterval = interval
+		return nil
+	}
+}
+
+// WithWALCompactThreshold 设置预写日志的压缩阈值(字节)
+// 日志的大小超过此值且达到上次压缩之后大小的两倍时,会在后台根据字典的当前内容重写日志
+func WithWALCompactThreshold(threshold int64) WALOption {
+	return func(opts *walOptions) error {
+		if threshold <= 0 {
+			return newIllegalParameterError("wal compact threshold is too small")
+		}
+		opts.compactThreshold = threshold
+		return nil
+	}
+}
+
+// walConfig 代表创建字典时预写日志的配置
+type walConfig struct {
+	// path 代表日志文件的路径
+	path string
+	// codec 代表元素的编解码器
+	codec Codec
+	// opts 代表预写日志的配置
+	opts walOptions
+}
+
+// journal 代表记录散列段写操作的日志的接口
+// logPut和logDelete在持有段锁的情况下被调用,因此同一个键的记录顺序与写操作生效的顺序一致
+type journal[K comparable, V any] interface {
+	// logPut 记录放入的键-元素对
+	logPut(p Pair[K, V])
+	// logDelete 记录被删除的键
+	logDelete(key K)
+	// commit 等待已记录的写操作持久化
+	// 在释放段锁之后调用,以免磁盘同步阻塞同一散列段的其他操作
+	commit()
+}
+
+// writeAheadLog 代表字典的预写日志,它是journal接口的实现类型
+// 日志写入失败之后不再记录任何写操作,失败的原因可以通过字典的Close方法获得
+type writeAheadLog[K comparable, V any] struct {
+	// path 代表日志文件的路径
+	path string
+	// codec 代表元素的编解码器
+	codec Codec
+	// opts 代表预写日志的配置
+	opts walOptions
+	// logger 代表日志记录器
+	logger *slog.Logger
+	// pairs 用于在压缩时遍历字典中所有未过期的键-元素对
+	pairs func(fn func(p Pair[K, V]) error) error
+	// file 代表日志文件
+	file *os.File
+	// size 代表日志文件的大小
+	size int64
+	// compactedSize 代表上次压缩或打开之后日志文件的大小
+	compactedSize int64
+	// active 代表是否记录写操作,重放日志期间为false
+	active bool
+	// dirty 代表是否有尚未同步到磁盘的记录
+	dirty bool
+	// appended 代表已写入的记录的数量
+	appended uint64
+	// synced 代表已同步到磁盘的记录的数量,仅在WAL_SYNC_ALWAYS策略下有效
+	synced uint64
+	// syncing 代表是否有Goroutine正在不持有互斥锁的情况下同步日志文件
+	syncing bool
+	// syncFile 用于将日志文件同步到磁盘
+	syncFile func(file *os.File) error
+	// compacting 代表是否正在压缩
+	compacting bool
+	// pending 代表压缩期间写入的记录,它们会被追加到压缩后的日志中
+	pending []byte
+	// closed 代表日志是否已关闭
+	closed bool
+	// err 代表第一次写入失败的错误
+	err error
+	// done 代表日志关闭的信号
+	done chan struct{}
+	// wg 用于等待后台的同步和压缩Goroutine退出
+	wg sync.WaitGroup
+	// lock 保护以上可变字段的互斥锁
+	lock sync.Mutex
+	// cond 用于等待正在进行的同步完成
+	cond *sync.Cond
+}
+
+// newWriteAheadLog 创建一个尚未打开的writeAheadLog类型的实例
+// 参数pairs用于在压缩时遍历字典中所有未过期的键-元素对
+func newWriteAheadLog[K comparable, V any](config *walConfig, logger *slog.Logger,
+	pairs func(fn func(p Pair[K, V]) error) error) *writeAheadLog[K, V] {
+	w := &writeAheadLog[K, V]{
+		path:     config.path,
+		codec:    config.codec,
+		opts:     config.opts,
+		logger:   logger,
+		pairs:    pairs,
+		syncFile: (*os.File).Sync,
+		done:     make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.lock)
+	return w
+}
+
+// open 打开或创建日志文件,重放其中的记录,之后开始记录写操作
+// 参数apply用于重放日志中的每条记录,重放时会截断末尾不完整或已损坏的记录
+func (w *writeAheadLog[K, V]) open(apply func(recordType walRecordType, payload []byte) error) error {
+	file, err := os.OpenFile(w.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	if err := w.replay(apply); err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.lock.Lock()
+	w.compactedSize = w.size
+	w.active = true
+	w.lock.Unlock()
+	if w.opts.syncPolicy == WAL_SYNC_INTERVAL {
+		w.wg.Add(1)
+		go w.syncLoop()
+	}
+	return nil
+}
+
+// replay 重放日志中的所有记录
+// 遇到不完整或校验和不符的记录时,从该记录开始截断日志
+func (w *writeAheadLog[K, V]) replay(apply func(recordType walRecordType, payload []byte) error) error {
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := w.file.Write(append([]byte(WAL_MAGIC), WAL_VERSION)); err != nil {
+			return err
+		}
+		w.size = int64(len(WAL_MAGIC) + 1)
+		return w.file.Sync()
+	}
+	r := bufio.NewReader(io.NewSectionReader(w.file, 0, info.Size()))
+	header := make([]byte, len(WAL_MAGIC)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(WAL_MAGIC)]) != WAL_MAGIC {
+		return newIllegalWALError("bad magic")
+	}
+	if header[len(WAL_MAGIC)] != WAL_VERSION {
+		return newIllegalWALError(fmt.Sprintf("unsupported version: %d", header[len(WAL_MAGIC)]))
+	}
+	offset := int64(len(header))
+	for {
+		payload, err := readWALRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return w.truncate(offset, info.Size(), err)
+		}
+		if err := apply(walRecordType(payload[0]), payload[1:]); err != nil {
+			return err
+		}
+		offset += int64(walHeaderSize + len(payload))
+	}
+	w.size = offset
+	return nil
+}
+
+// truncate 从offset开始截断日志末尾损坏的记录
+func (w *writeAheadLog[K, V]) truncate(offset int64, fileSize int64, cause error) error {
+	w.logger.Warn("cmap: truncating corrupted write-ahead log tail",
+		slog.String("path", w.path),
+		slog.Int64("offset", offset),
+		slog.Int64("dropped_bytes", fileSize-offset),
+		slog.String("cause", cause.Error()))
+	if err := w.file.Truncate(offset); err != nil {
+		return err
+	}
+	w.size = offset
+	return w.file.Sync()
+}
+
+// readWALRecord 读取一条记录的内容并核对其校验和
+// 若恰好读到日志末尾,则返回io.EOF
+func readWALRecord(r io.Reader) ([]byte, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length == 0 || length > MAX_WAL_RECORD_SIZE {
+		return nil, newIllegalWALError(fmt.Sprintf("illegal record length: %d", length))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, newIllegalWALError("checksum mismatch")
+	}
+	return payload, nil
+}
+
+// appendWALRecord 将一条记录追加到dst中
+func appendWALRecord(dst []byte, payload []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	dst = binary.BigEndian.AppendUint32(dst, crc32.ChecksumIEEE(payload))
+	return append(dst, payload...)
+}
+
+// encodePut 编码放入键-元素对的记录内容
+func (w *writeAheadLog[K, V]) encodePut(p Pair[K, V]) ([]byte, error) {
+	key, err := encodeKey(p.Key(), w.codec)
+	if err != nil {
+		return nil, err
+	}
+	element, err := w.codec.Encode(p.Element())
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(key)+len(element)+binary.MaxVarintLen64)
+	payload = append(payload, byte(walRecordPut))
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	payload = binary.AppendUvarint(payload, uint64(len(element)))
+	payload = append(payload, element...)
+	return binary.AppendVarint(payload, p.Expiry()), nil
+}
+
+// logPut 记录放入的键-元素对
+func (w *writeAheadLog[K, V]) logPut(p Pair[K, V]) {
+	payload, err := w.encodePut(p)
+	w.append(payload, err)
+}
+
+// logDelete 记录被删除的键
+func (w *writeAheadLog[K, V]) logDelete(key K) {
+	data, err := encodeKey(key, w.codec)
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64+len(data))
+	payload = append(payload, byte(walRecordDelete))
+	payload = binary.AppendUvarint(payload, uint64(len(data)))
+	w.append(append(payload, data...), err)
+}
+
+// append 将一条记录追加到日志文件中
+// 参数encodeErr代表编码记录内容时的错误
+func (w *writeAheadLog[K, V]) append(payload []byte, encodeErr error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.active || w.closed || w.err != nil {
+		return
+	}
+	if encodeErr != nil {
+		w.fail(encodeErr)
+		return
+	}
+	record := appendWALRecord(nil, payload)
+	if _, err := w.file.Write(record); err != nil {
+		w.fail(err)
+		return
+	}
+	w.size += int64(len(record))
+	w.appended++
+	if w.compacting {
+		w.pending = append(w.pending, record...)
+	}
+	if w.opts.syncPolicy == WAL_SYNC_INTERVAL {
+		w.dirty = true
+	}
+	if !w.compacting && w.size >= w.opts.compactThreshold && w.size >= 2*w.compactedSize {
+		w.compacting = true
+		w.wg.Add(1)
+		go w.compact()
+	}
+}
+
+// commit 在WAL_SYNC_ALWAYS策略下等待已写入的记录同步到磁盘
+// 同步时不持有互斥锁,在此期间写入的记录由下一次同步一并持久化
+func (w *writeAheadLog[K, V]) commit() {
+	if w.opts.syncPolicy != WAL_SYNC_ALWAYS {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	target := w.appended
+	for w.synced < target {
+		if w.closed || w.err != nil {
+			return
+		}
+		if w.syncing {
+			w.cond.Wait()
+			continue
+		}
+		w.syncing = true
+		file, appended := w.file, w.appended
+		w.lock.Unlock()
+		err := w.syncFile(file)
+		w.lock.Lock()
+		w.syncing = false
+		if err != nil {
+			w.fail(err)
+		} else if appended > w.synced {
+			w.synced = appended
+		}
+		w.cond.Broadcast()
+	}
+}
+
+// awaitSync 等待正在进行的同步完成,以便替换或关闭日志文件
+// 注意!必须在互斥锁的保护下调用本方法
+func (w *writeAheadLog[K, V]) awaitSync() {
+	for w.syncing {
+		w.cond.Wait()
+	}
+}
+
+// fail 记录第一次写入失败的错误,之后不再记录任何写操作
+// 注意!必须在互斥锁的保护下调用本方法
+func (w *writeAheadLog[K, V]) fail(err error) {
+	w.err = err
+	w.logger.Error("cmap: write-ahead log failed",
+		slog.String("path", w.path),
+		slog.String("error", err.Error()))
+}
+
+// syncLoop 每隔一段时间将日志同步到磁盘,直到日志关闭
+func (w *writeAheadLog[K, V]) syncLoop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.opts.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.lock.Lock()
+			if w.dirty && !w.closed && w.err == nil {
+				if err := w.syncFile(w.file); err != nil {
+					w.fail(err)
+				}
+				w.dirty = false
+			}
+			w.lock.Unlock()
+		}
+	}
+}
+
+// compact 根据字典的当前内容重写日志
+// 压缩期间的写操作会同时写入旧的日志和pending,重写完成之后pending会被追加到新的日志中,
+// 因此即使压缩失败或在压缩期间崩溃,旧的日志仍然是完整的
+func (w *writeAheadLog[K, V]) compact() {
+	defer w.wg.Done()
+	if err := w.rewrite(); err != nil {
+		w.logger.Error("cmap: write-ahead log compaction failed",
+			slog.String("path", w.path),
+			slog.String("error", err.Error()))
+		// 日志再增长一倍之后才重试,以免每次写入都触发压缩
+		w.lock.Lock()
+		w.compactedSize = w.size
+		w.lock.Unlock()
+	}
+	w.lock.Lock()
+	w.compacting = false
+	w.pending = nil
+	w.lock.Unlock()
+}
+
+// rewrite 将字典的当前内容写入临时文件,再以其替换日志文件
+func (w *writeAheadLog[K, V]) rewrite() (err error) {
+	tmpPath := w.path + ".compact"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	replaced := false
+	defer func() {
+		if !replaced {
+			_ = file.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+	bw := bufio.NewWriter(file)
+	size := int64(len(WAL_MAGIC) + 1)
+	if _, err := bw.Write(append([]byte(WAL_MAGIC), WAL_VERSION)); err != nil {
+		return err
+	}
+	var record []byte
+	err = w.pairs(func(p Pair[K, V]) error {
+		payload, err := w.encodePut(p)
+		if err != nil {
+			return err
+		}
+		record = appendWALRecord(record[:0], payload)
+		size += int64(len(record))
+		_, err = bw.Write(record)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.awaitSync()
+	if w.closed || w.err != nil {
+		return nil
+	}
+	if _, err := file.Write(w.pending); err != nil {
+		return err
+	}
+	size += int64(len(w.pending))
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return err
+	}
+	replaced = true
+	_ = w.file.Close()
+	w.file = file
+	w.size = size
+	w.compactedSize = size
+	w.dirty = false
+	// 新的日志文件已同步到磁盘,其中包含了所有已写入的记录
+	w.synced = w.appended
+	return syncDir(filepath.Dir(w.path))
+}
+
+// syncDir 将目录同步到磁盘,以保证其中文件的重命名已持久化
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
+
+// close 将日志同步到磁盘并关闭日志文件
+// 返回值为第一次写入失败的错误或关闭时的错误
+func (w *writeAheadLog[K, V]) close() error {
+	w.lock.Lock()
+	if w.closed || w.file == nil {
+		w.lock.Unlock()
+		return w.err
+	}
+	w.closed = true
+	close(w.done)
+	w.lock.Unlock()
+	w.wg.Wait()
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.awaitSync()
+	err := w.err
+	if syncErr := w.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// replayWAL 将预写日志中的一条记录应用到字典
+func (cmap *myConcurrentMap[K, V]) replayWAL(codec Codec, recordType walRecordType, payload []byte) error {
+	keyData, n := readUvarintBytes(payload)
+	if n <= 0 {
+		return newIllegalWALError("malformed key")
+	}
+	key, err := decodeKey[K](keyData, codec)
+	if err != nil {
+		return err
+	}
+	payload = payload[n:]
+	switch recordType {
+	case walRecordPut:
+		elementData, n := readUvarintBytes(payload)
+		if n <= 0 {
+			return newIllegalWALError("malformed element")
+		}
+		expiry, m := binary.Varint(payload[n:])
+		if m <= 0 {
+			return newIllegalWALError("malformed expiry")
+		}
+		element, err := decodeAs[V](elementData, codec)
+		if err != nil {
+			return err
+		}
+		// 已过期的放入记录相当于删除,否则该键更早的记录会重新生效
+		if expiry != 0 && expiry <= cmap.clock.Now().UnixNano() {
+			cmap.Delete(key)
+			return nil
+		}
+		p, err := newPair(key, cmap.hasher.Hash(key), element)
+		if err != nil {
+			return err
+		}
+		p.SetExpiry(expiry)
+		if expiry != 0 {
+			cmap.startJanitor()
+		}
+		s, gate := cmap.enterSegment(p.Hash())
+		defer gate.RUnlock()
+		_, err = s.Put(p)
+		return err
+	case walRecordDelete:
+		cmap.Delete(key)
+		return nil
+	default:
+		return newIllegalWALError(fmt.Sprintf("unknown record type: %d", recordType))
+	}
+}
+
+// readUvarintBytes 从data中读取带有长度前缀的字节序列
+// 第二个返回值为读取的字节数,若不大于0则说明数据不完整
+func readUvarintBytes(data []byte) ([]byte, int) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return nil, 0
+	}
+	end := n + int(length)
+	return data[n:end], end
+}
+
+// Close 关闭字典的预写日志
+// 若未启用预写日志,则什么也不做
+// 返回值为预写日志第一次写入失败的错误或关闭时的错误
+// 关闭之后字典仍然可用,但不再记录任何写操作
+func (cmap *myConcurrentMap[K, V]) Close() error {
+	if cmap.wal == nil {
+		return nil
+	}
+	return cmap.wal.close()
+}
@@ -0,0 +1,260 @@
+package cmap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openWALMap 创建一个启用了预写日志的字典
+func openWALMap(t *testing.T, path string, opts ...Option) ConcurrentMap[string, int] {
+	t.Helper()
+	cm, err := New[string, int](append([]Option{WithWAL(path, jsonTestCodec{},
+		WithWALSyncPolicy(WAL_SYNC_ALWAYS))}, opts...)...)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map with wal: %s", err)
+	}
+	return cm
+}
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	cm := openWALMap(t, path)
+	for i := 0; i < 100; i++ {
+		cm.Put("key"+strconv.Itoa(i), i)
+	}
+	for i := 0; i < 100; i += 2 {
+		cm.Delete("key" + strconv.Itoa(i))
+	}
+	cm.Put("key1", 1000)
+	cm.Compute("key3", func(int, bool) (int, bool) { return 0, false })
+	if err := cm.Close(); err != nil {
+		t.Fatalf("An error occurs when closing map: %s", err)
+	}
+	// 关闭之后的写操作不再被记录
+	cm.Put("key0", 0)
+
+	replayed := openWALMap(t, path)
+	defer replayed.Close()
+	if replayed.Len() != 49 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 49, replayed.Len())
+	}
+	if replayed.Get("key1") != 1000 || replayed.Get("key5") != 5 {
+		t.Fatalf("Inconsistent elements: key1: %d, key5: %d", replayed.Get("key1"), replayed.Get("key5"))
+	}
+	for _, key := range []string{"key0", "key2", "key3"} {
+		if _, ok := replayed.(*myConcurrentMap[string, int]).get(key); ok {
+			t.Fatalf("The deleted key %q is replayed!", key)
+		}
+	}
+}
+
+func TestWALReplayTTLAndEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	clock := newFakeClock()
+	cm := openWALMap(t, path, WithClock(clock), WithConcurrency(1), WithMaxEntries(2))
+	cm.PutWithTTL("a", 1, time.Second)
+	cm.Put("b", 2)
+	cm.Put("c", 3)
+	cm.PutWithTTL("d", 4, time.Minute)
+	if err := cm.Close(); err != nil {
+		t.Fatalf("An error occurs when closing map: %s", err)
+	}
+	clock.Advance(time.Second)
+
+	replayed := openWALMap(t, path, WithClock(clock), WithConcurrency(1))
+	defer replayed.Close()
+	// a和b已被淘汰
+	if replayed.Len() != 2 || replayed.Get("c") != 3 || replayed.Get("d") != 4 {
+		t.Fatalf("Inconsistent map after replay: len: %d, c: %d, d: %d",
+			replayed.Len(), replayed.Get("c"), replayed.Get("d"))
+	}
+	clock.Advance(time.Minute)
+	if replayed.Len() != 1 {
+		t.Fatalf("The replayed pair did not keep its expiry: len: %d", replayed.Len())
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	cm := openWALMap(t, path)
+	cm.Put("a", 1)
+	cm.Put("b", 2)
+	if err := cm.Close(); err != nil {
+		t.Fatalf("An error occurs when closing map: %s", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("An error occurs when stating wal: %s", err)
+	}
+	size := info.Size()
+
+	cm = openWALMap(t, path)
+	cm.Put("c", 3)
+	cm.Close()
+	// 截掉最后一条记录的一部分,模拟写入过程中崩溃
+	if err := os.Truncate(path, size+5); err != nil {
+		t.Fatalf("An error occurs when truncating wal: %s", err)
+	}
+	replayed := openWALMap(t, path)
+	if replayed.Len() != 2 || replayed.Get("b") != 2 {
+		t.Fatalf("Inconsistent map after replaying torn wal: len: %d, b: %d", replayed.Len(), replayed.Get("b"))
+	}
+	if info, _ := os.Stat(path); info.Size() != size {
+		t.Fatalf("The torn tail is not truncated: expected size: %d, actual: %d", size, info.Size())
+	}
+	// 截断之后追加的记录应能被正常重放
+	replayed.Put("d", 4)
+	replayed.Close()
+
+	// 篡改最后一条记录的内容,使校验和不符
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("An error occurs when reading wal: %s", err)
+	}
+	data[len(data)-2] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("An error occurs when writing wal: %s", err)
+	}
+	replayed = openWALMap(t, path)
+	defer replayed.Close()
+	if replayed.Len() != 2 || replayed.Get("d") != 0 {
+		t.Fatalf("Inconsistent map after replaying corrupted wal: len: %d, d: %d", replayed.Len(), replayed.Get("d"))
+	}
+}
+
+func TestWALIllegalHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	if err := os.WriteFile(path, []byte("NOTAWAL"), 0o644); err != nil {
+		t.Fatalf("An error occurs when writing wal: %s", err)
+	}
+	_, err := New[string, int](WithWAL(path, jsonTestCodec{}))
+	var illegal IllegalWALError
+	if !errors.As(err, &illegal) {
+		t.Fatalf("Inconsistent error: expected: IllegalWALError, actual: %v", err)
+	}
+}
+
+func TestWALCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	cm, err := New[string, int](WithConcurrency(4), WithWAL(path, jsonTestCodec{},
+		WithWALSyncPolicy(WAL_SYNC_NEVER), WithWALCompactThreshold(4096)))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map with wal: %s", err)
+	}
+	w := cm.(*myConcurrentMap[string, int]).wal
+	compacting := func() bool {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		return w.compacting
+	}
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 50; i++ {
+			cm.Put("key"+strconv.Itoa(i), round*100+i)
+		}
+		waitFor(t, func() bool { return !compacting() }, "The wal compaction did not finish")
+	}
+	if err := cm.Close(); err != nil {
+		t.Fatalf("An error occurs when closing map: %s", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("An error occurs when stating wal: %s", err)
+	}
+	if info.Size() >= 8192 {
+		t.Fatalf("The wal is too large after compaction: %d", info.Size())
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Fatalf("The temporary compaction file is left behind: %v", err)
+	}
+	replayed := openWALMap(t, path)
+	defer replayed.Close()
+	if replayed.Len() != 50 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 50, replayed.Len())
+	}
+	for i := 0; i < 50; i++ {
+		if element := replayed.Get("key" + strconv.Itoa(i)); element != 1900+i {
+			t.Fatalf("Inconsistent element: expected: %d, actual: %d", 1900+i, element)
+		}
+	}
+}
+
+func TestWALSyncInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	cm, err := New[string, int](WithWAL(path, jsonTestCodec{}, WithWALSyncInterval(time.Millisecond)))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map with wal: %s", err)
+	}
+	cm.Put("a", 1)
+	w := cm.(*myConcurrentMap[string, int]).wal
+	waitFor(t, func() bool {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		return !w.dirty
+	}, "The wal is not synced")
+	if err := cm.Close(); err != nil {
+		t.Fatalf("An error occurs when closing map: %s", err)
+	}
+	if err := cm.Close(); err != nil {
+		t.Fatalf("Closing twice returns an error: %s", err)
+	}
+}
+
+func TestWALGroupCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmap.wal")
+	cm := openWALMap(t, path, WithConcurrency(1))
+	w := cm.(*myConcurrentMap[string, int]).wal
+	var syncs atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	w.lock.Lock()
+	w.syncFile = func(file *os.File) error {
+		if syncs.Add(1) == 1 {
+			close(entered)
+			<-release
+		}
+		return file.Sync()
+	}
+	w.lock.Unlock()
+	number := 10
+	var wg sync.WaitGroup
+	put := func(i int) {
+		defer wg.Done()
+		cm.Put("key"+strconv.Itoa(i), i)
+	}
+	wg.Add(1)
+	go put(0)
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The wal is not synced!")
+	}
+	// 同步期间不持有段锁,因此同一散列段的其他操作不会被阻塞
+	for i := 1; i < number; i++ {
+		wg.Add(1)
+		go put(i)
+	}
+	for i := 0; i < number; i++ {
+		key := "key" + strconv.Itoa(i)
+		waitFor(t, func() bool { return cm.Get(key) == i }, "The segment is blocked by syncing the wal!")
+	}
+	close(release)
+	wg.Wait()
+	// 等待第一次同步的写操作共享第二次同步
+	if count := syncs.Load(); count != 2 {
+		t.Fatalf("Inconsistent sync count: expected: %d, actual: %d", 2, count)
+	}
+	if err := cm.Close(); err != nil {
+		t.Fatalf("An error occurs when closing map: %s", err)
+	}
+	replayed := openWALMap(t, path)
+	defer replayed.Close()
+	if replayed.Len() != uint64(number) {
+		t.Fatalf("Inconsistent replayed length: expected: %d, actual: %d", number, replayed.Len())
+	}
+}
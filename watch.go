@@ -0,0 +1,334 @@
+package cmap
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_WATCH_BUFFER 代表观察者默认的事件缓冲区大小
+const DEFAULT_WATCH_BUFFER int = 64
+
+// WatchPolicy 代表观察者缓冲区已满时的处理策略
+type WatchPolicy uint8
+
+const (
+	// WATCH_POLICY_DROP 代表丢弃新的事件
+	WATCH_POLICY_DROP WatchPolicy = 0
+	// WATCH_POLICY_COALESCE 代表将同一个键的未送达事件合并为一个
+	// 合并后的事件带有最早的旧元素和最新的新元素,因此观察者总能得知键的最新状态
+	// 若缓冲区已满且没有同一个键的未送达事件,则丢弃新的事件
+	WATCH_POLICY_COALESCE WatchPolicy = 1
+	// WATCH_POLICY_BLOCK 代表阻塞写操作,直到缓冲区有空位或观察被取消
+	// 注意!写操作阻塞时持有段锁,慢速的观察者会拖慢同一散列段的所有写操作
+	WATCH_POLICY_BLOCK WatchPolicy = 2
+)
+
+// WatchOption 代表观察键的变化时的可选配置项
+type WatchOption func(opts *watchOptions) error
+
+// watchOptions 代表观察键的变化时的配置
+type watchOptions struct {
+	// buffer 代表事件缓冲区的大小
+	buffer int
+	// policy 代表缓冲区已满时的处理策略
+	policy WatchPolicy
+}
+
+// WithWatchBuffer 设置事件缓冲区的大小
+func WithWatchBuffer(buffer int) WatchOption {
+	return func(opts *watchOptions) error {
+		if buffer <= 0 {
+			return newIllegalParameterError("watch buffer is too small")
+		}
+		opts.buffer = buffer
+		return nil
+	}
+}
+
+// WithWatchPolicy 设置缓冲区已满时的处理策略
+func WithWatchPolicy(policy WatchPolicy) WatchOption {
+	return func(opts *watchOptions) error {
+		switch policy {
+		case WATCH_POLICY_DROP, WATCH_POLICY_COALESCE, WATCH_POLICY_BLOCK:
+		default:
+			return newIllegalParameterError("unknown watch policy")
+		}
+		opts.policy = policy
+		return nil
+	}
+}
+
+// watcher 代表一个观察者
+// 事件先被放入缓冲区,再由单独的Goroutine转发到输出通道,
+// 因此发送事件的写操作只有在WATCH_POLICY_BLOCK策略下才会阻塞
+type watcher[K comparable, V any] struct {
+	// key 代表被观察的键,仅在prefix为false时有效
+	key K
+	// prefix 代表是否按前缀观察
+	prefix bool
+	// keyPrefix 代表被观察的键前缀
+	keyPrefix string
+	// opts 代表观察者的配置
+	opts watchOptions
+	// out 代表输出通道
+	out chan Event[K, V]
+	// queue 代表未送达的事件
+	queue []Event[K, V]
+	// closed 代表观察是否已被取消
+	closed bool
+	// dropped 代表被丢弃的事件数量
+	dropped uint64
+	// lock 保护缓冲区及观察者状态的互斥锁
+	lock sync.Mutex
+	// cond 用于等待缓冲区中的事件或空位
+	cond *sync.Cond
+}
+
+// notify 根据处理策略将事件放入缓冲区
+// 注意!本方法在持有段锁的情况下被调用
+func (w *watcher[K, V]) notify(event Event[K, V]) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return
+	}
+	if w.opts.policy == WATCH_POLICY_COALESCE {
+		for i := len(w.queue) - 1; i >= 0; i-- {
+			if w.queue[i].Key != event.Key {
+				continue
+			}
+			if merged, ok := coalesceEvent(w.queue[i], event); ok {
+				w.queue[i] = merged
+			} else {
+				w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			}
+			return
+		}
+	}
+	for len(w.queue) >= w.opts.buffer {
+		if w.opts.policy != WATCH_POLICY_BLOCK {
+			w.dropped++
+			return
+		}
+		w.cond.Wait()
+		if w.closed {
+			return
+		}
+	}
+	w.queue = append(w.queue, event)
+	w.cond.Broadcast()
+}
+
+// forward 将缓冲区中的事件依次转发到输出通道
+// 观察被取消后关闭输出通道并返回
+func (w *watcher[K, V]) forward(ctx context.Context) {
+	defer close(w.out)
+	for {
+		w.lock.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed {
+			w.lock.Unlock()
+			return
+		}
+		event := w.queue[0]
+		w.queue[0] = Event[K, V]{}
+		w.queue = w.queue[1:]
+		w.cond.Broadcast()
+		w.lock.Unlock()
+		select {
+		case w.out <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// close 取消观察并唤醒所有等待中的Goroutine
+func (w *watcher[K, V]) close() {
+	w.lock.Lock()
+	w.closed = true
+	w.queue = nil
+	w.cond.Broadcast()
+	w.lock.Unlock()
+}
+
+// coalesceEvent 将同一个键的两个相继的事件合并为一个
+// 若两个事件相互抵消(先新增后删除),则第二个返回值为false
+func coalesceEvent[K comparable, V any](pending Event[K, V], event Event[K, V]) (Event[K, V], bool) {
+	merged := event
+	merged.OldElement = pending.OldElement
+	switch {
+	case pending.Type == EVENT_INSERT && event.Type == EVENT_DELETE:
+		return merged, false
+	case pending.Type == EVENT_INSERT:
+		merged.Type = EVENT_INSERT
+	case pending.Type == EVENT_DELETE && event.Type == EVENT_INSERT:
+		merged.Type = EVENT_UPDATE
+	}
+	return merged, true
+}
+
+// watchHub 代表字典中所有观察者的注册表
+// 它在有观察者时才向字典注册变更事件钩子,并在最后一个观察者注销时注销钩子,
+// 以免没有观察者时增加写操作的开销
+type watchHub[K comparable, V any] struct {
+	hooks    *Hooks[K, V]
+	lock     sync.RWMutex
+	keys     map[K][]*watcher[K, V]
+	prefixes []*watcher[K, V]
+	// size 代表已注册的观察者的数量
+	size int
+	// unhooks 代表注销变更事件钩子的函数,未注册钩子时为nil
+	unhooks []func()
+}
+
+// newWatchHub 创建一个watchHub类型的实例
+func newWatchHub[K comparable, V any](hooks *Hooks[K, V]) *watchHub[K, V] {
+	return &watchHub[K, V]{
+		hooks: hooks,
+		keys:  make(map[K][]*watcher[K, V]),
+	}
+}
+
+// watch 注册一个观察者并返回其输出通道
+// 观察者会在ctx被取消时注销,其输出通道随后会被关闭
+func (h *watchHub[K, V]) watch(ctx context.Context, w *watcher[K, V], opts ...WatchOption) (<-chan Event[K, V], error) {
+	if ctx == nil {
+		return nil, newIllegalParameterError("watch context is nil")
+	}
+	w.opts = watchOptions{
+		buffer: DEFAULT_WATCH_BUFFER,
+		policy: WATCH_POLICY_DROP,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(&w.opts); err != nil {
+			return nil, err
+		}
+	}
+	w.out = make(chan Event[K, V])
+	w.cond = sync.NewCond(&w.lock)
+	h.lock.Lock()
+	if h.size == 0 {
+		h.unhooks = []func(){
+			h.hooks.OnInsert(h.dispatch),
+			h.hooks.OnUpdate(h.dispatch),
+			h.hooks.OnDelete(h.dispatch),
+		}
+	}
+	h.size++
+	if w.prefix {
+		h.prefixes = append(h.prefixes, w)
+	} else {
+		h.keys[w.key] = append(h.keys[w.key], w)
+	}
+	h.lock.Unlock()
+	go w.forward(ctx)
+	context.AfterFunc(ctx, func() {
+		// 先关闭观察者,以唤醒可能正在阻塞的写操作
+		w.close()
+		h.remove(w)
+	})
+	return w.out, nil
+}
+
+// remove 注销指定的观察者
+// 若已没有观察者,则同时注销变更事件钩子
+func (h *watchHub[K, V]) remove(w *watcher[K, V]) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if w.prefix {
+		h.prefixes = removeWatcher(h.prefixes, w)
+	} else if watchers := removeWatcher(h.keys[w.key], w); len(watchers) > 0 {
+		h.keys[w.key] = watchers
+	} else {
+		delete(h.keys, w.key)
+	}
+	h.size--
+	if h.size > 0 {
+		return
+	}
+	for _, unhook := range h.unhooks {
+		unhook()
+	}
+	h.unhooks = nil
+}
+
+// dispatch 将变更事件分发给关注它的观察者
+// 观察者是在持有读锁时选出的,但通知时不持有读锁,
+// 因此WATCH_POLICY_BLOCK的观察者阻塞时不会妨碍观察的注册与注销,也不会拖慢其他散列段的写操作
+// 注意!本方法作为钩子在持有段锁的情况下被调用
+func (h *watchHub[K, V]) dispatch(event Event[K, V]) {
+	for _, w := range h.match(event.Key) {
+		w.notify(event)
+	}
+}
+
+// match 返回关注指定键的观察者
+// 返回的切片是新建的,因此可以在释放读锁之后使用
+func (h *watchHub[K, V]) match(key K) []*watcher[K, V] {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	watchers := append([]*watcher[K, V](nil), h.keys[key]...)
+	if len(h.prefixes) == 0 {
+		return watchers
+	}
+	name, ok := stringKey(key)
+	if !ok {
+		return watchers
+	}
+	for _, w := range h.prefixes {
+		if strings.HasPrefix(name, w.keyPrefix) {
+			watchers = append(watchers, w)
+		}
+	}
+	return watchers
+}
+
+// removeWatcher 返回去掉了指定观察者的新切片
+func removeWatcher[K comparable, V any](watchers []*watcher[K, V], w *watcher[K, V]) []*watcher[K, V] {
+	result := make([]*watcher[K, V], 0, len(watchers))
+	for _, e := range watchers {
+		if e != w {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// stringKey 返回键的字符串值
+// 若键的(动态)类型的底层类型不是字符串,则第二个返回值为false
+func stringKey[K comparable](key K) (string, bool) {
+	if s, ok := any(key).(string); ok {
+		return s, true
+	}
+	v := reflect.ValueOf(key)
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// Watch 观察指定键的变化
+// 返回的通道会在ctx被取消后关闭
+func (cmap *myConcurrentMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) (<-chan Event[K, V], error) {
+	return cmap.watchers.watch(ctx, &watcher[K, V]{key: key}, opts...)
+}
+
+// WatchPrefix 观察以指定前缀开头的所有键的变化
+// 只适用于底层类型为字符串的键或动态类型为字符串的接口类型的键
+// 返回的通道会在ctx被取消后关闭
+func (cmap *myConcurrentMap[K, V]) WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) (<-chan Event[K, V], error) {
+	switch reflect.TypeFor[K]().Kind() {
+	case reflect.String, reflect.Interface:
+	default:
+		return nil, newIllegalParameterError("watching prefix requires string keys")
+	}
+	return cmap.watchers.watch(ctx, &watcher[K, V]{prefix: true, keyPrefix: prefix}, opts...)
+}
@@ -0,0 +1,312 @@
+package cmap
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// receiveEvents 接收通道中的事件,直到一段时间内没有新的事件
+func receiveEvents[K comparable, V any](ch <-chan Event[K, V]) []Event[K, V] {
+	var events []Event[K, V]
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		case <-time.After(100 * time.Millisecond):
+			return events
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := cm.Watch(ctx, "a")
+	if err != nil {
+		t.Fatalf("An error occurs when watch a key: %s", err)
+	}
+	cm.Put("a", 1)
+	cm.Put("b", 1)
+	cm.Put("a", 2)
+	cm.Delete("a")
+	events := receiveEvents(ch)
+	expected := []EventType{EVENT_INSERT, EVENT_UPDATE, EVENT_DELETE}
+	if len(events) != len(expected) {
+		t.Fatalf("Inconsistent event number: expected: %d, actual: %d", len(expected), len(events))
+	}
+	for i, e := range events {
+		if e.Key != "a" || e.Type != expected[i] {
+			t.Fatalf("Inconsistent event #%d: %+v", i, e)
+		}
+	}
+	if events[1].OldElement != 1 || events[1].NewElement != 2 {
+		t.Fatalf("Inconsistent update event: %+v", events[1])
+	}
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("Received an event after canceling, but should not be the case!")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The watch channel is not closed after canceling!")
+	}
+	hub := cm.(*myConcurrentMap[string, int]).watchers
+	for i := 0; ; i++ {
+		hub.lock.RLock()
+		n := len(hub.keys)
+		hub.lock.RUnlock()
+		if n == 0 {
+			break
+		}
+		if i >= 100 {
+			t.Fatal("The watcher is not removed after canceling!")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchPrefix(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := cm.WatchPrefix(ctx, "app/")
+	if err != nil {
+		t.Fatalf("An error occurs when watch a prefix: %s", err)
+	}
+	cm.Put("app/a", 1)
+	cm.Put("other", 1)
+	cm.Put("app/b", 2)
+	events := receiveEvents(ch)
+	if len(events) != 2 || events[0].Key != "app/a" || events[1].Key != "app/b" {
+		t.Fatalf("Inconsistent events: %+v", events)
+	}
+
+	im, err := New[int, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	if _, err := im.WatchPrefix(ctx, "1"); err == nil {
+		t.Fatal("No error when watch a prefix of non-string keys, but should not be the case!")
+	}
+	if _, err := cm.Watch(ctx, "a", WithWatchBuffer(0)); err == nil {
+		t.Fatal("No error when watch with an illegal buffer, but should not be the case!")
+	}
+}
+
+func TestWatchDrop(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := cm.Watch(ctx, "a", WithWatchBuffer(1), WithWatchPolicy(WATCH_POLICY_DROP))
+	if err != nil {
+		t.Fatalf("An error occurs when watch a key: %s", err)
+	}
+	number := 100
+	for i := 0; i < number; i++ {
+		cm.Put("a", i)
+	}
+	events := receiveEvents(ch)
+	hub := cm.(*myConcurrentMap[string, int]).watchers
+	hub.lock.RLock()
+	w := hub.keys["a"][0]
+	hub.lock.RUnlock()
+	w.lock.Lock()
+	dropped := w.dropped
+	w.lock.Unlock()
+	if dropped == 0 || uint64(len(events))+dropped != uint64(number) {
+		t.Fatalf("Inconsistent event number: received: %d, dropped: %d", len(events), dropped)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].NewElement <= events[i-1].NewElement {
+			t.Fatalf("Events out of order: %+v", events)
+		}
+	}
+}
+
+func TestWatchCoalesce(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := cm.WatchPrefix(ctx, "", WithWatchBuffer(2), WithWatchPolicy(WATCH_POLICY_COALESCE))
+	if err != nil {
+		t.Fatalf("An error occurs when watch a prefix: %s", err)
+	}
+	number := 100
+	for i := 0; i < number; i++ {
+		cm.Put("a", i)
+		cm.Put("b", i)
+	}
+	latest := make(map[string]int)
+	for _, e := range receiveEvents(ch) {
+		latest[e.Key] = e.NewElement
+	}
+	for _, key := range []string{"a", "b"} {
+		if latest[key] != number-1 {
+			t.Fatalf("Inconsistent latest element of key %q: expected: %d, actual: %d", key, number-1, latest[key])
+		}
+	}
+}
+
+func TestWatchBlock(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := cm.Watch(ctx, "a", WithWatchBuffer(1), WithWatchPolicy(WATCH_POLICY_BLOCK))
+	if err != nil {
+		t.Fatalf("An error occurs when watch a key: %s", err)
+	}
+	number := 100
+	go func() {
+		for i := 0; i < number; i++ {
+			cm.Put("a", i)
+		}
+	}()
+	for i := 0; i < number; i++ {
+		select {
+		case e := <-ch:
+			if e.NewElement != i {
+				t.Fatalf("Inconsistent element: expected: %d, actual: %d", i, e.NewElement)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout when receive event #%d", i)
+		}
+	}
+
+	// 取消观察必须能唤醒被阻塞的写操作
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	if _, err := cm.Watch(ctx2, "b", WithWatchBuffer(1), WithWatchPolicy(WATCH_POLICY_BLOCK)); err != nil {
+		t.Fatalf("An error occurs when watch a key: %s", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			cm.Put("b", i)
+		}
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel2()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The writer is still blocked after canceling the watch!")
+	}
+}
+
+func TestWatchBlockOtherSegments(t *testing.T) {
+	cm, err := New[string, int](WithConcurrency(16))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := cm.Watch(ctx, "a", WithWatchBuffer(1), WithWatchPolicy(WATCH_POLICY_BLOCK)); err != nil {
+		t.Fatalf("An error occurs when watch a key: %s", err)
+	}
+	hm := cm.(*myConcurrentMap[string, int])
+	other := "b"
+	for i := 0; hm.segmentIndex(hm.hasher.Hash(other)) == hm.segmentIndex(hm.hasher.Hash("a")); i++ {
+		other = "b" + strconv.Itoa(i)
+	}
+	// 没有人接收事件,第三次写入会一直阻塞
+	go func() {
+		for i := 0; i < 3; i++ {
+			cm.Put("a", i)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchCtx, watchCancel := context.WithCancel(ctx)
+		defer watchCancel()
+		if _, err := cm.Watch(watchCtx, other); err != nil {
+			t.Errorf("An error occurs when watch a key: %s", err)
+		}
+		cm.Put(other, 1)
+	}()
+	// 阻塞的观察者只应拖慢同一散列段的写操作
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("A blocked watcher stalls watches and writes in other segments!")
+	}
+}
+
+func TestWatchUnhook(t *testing.T) {
+	cm, err := New[string, int]()
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	hooks := cm.Hooks()
+	for round := 0; round < 2; round++ {
+		ctx1, cancel1 := context.WithCancel(context.Background())
+		ctx2, cancel2 := context.WithCancel(context.Background())
+		cm.Watch(ctx1, "a")
+		cm.WatchPrefix(ctx2, "a")
+		if !hooks.hasUpdate() || !hooks.hasDelete() {
+			t.Fatal("The hooks are not registered when watching!")
+		}
+		cancel1()
+		time.Sleep(10 * time.Millisecond)
+		if !hooks.hasUpdate() {
+			t.Fatal("The hooks are unregistered while there is still a watcher!")
+		}
+		cancel2()
+		// 最后一个观察者注销之后,写操作不应再走钩子的路径
+		waitFor(t, func() bool { return !hooks.hasUpdate() && !hooks.hasDelete() },
+			"The hooks are not unregistered after all watchers are canceled!")
+	}
+}
+
+func TestCoalesceEvent(t *testing.T) {
+	testCases := []struct {
+		pending  EventType
+		event    EventType
+		expected EventType
+		keep     bool
+	}{
+		{EVENT_INSERT, EVENT_UPDATE, EVENT_INSERT, true},
+		{EVENT_INSERT, EVENT_DELETE, 0, false},
+		{EVENT_UPDATE, EVENT_UPDATE, EVENT_UPDATE, true},
+		{EVENT_UPDATE, EVENT_DELETE, EVENT_DELETE, true},
+		{EVENT_DELETE, EVENT_INSERT, EVENT_UPDATE, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pending.String()+"+"+tc.event.String(), func(t *testing.T) {
+			pending := Event[string, int]{Type: tc.pending, Key: "a", OldElement: 1, NewElement: 2}
+			event := Event[string, int]{Type: tc.event, Key: "a", OldElement: 2, NewElement: 3}
+			merged, keep := coalesceEvent(pending, event)
+			if keep != tc.keep {
+				t.Fatalf("Inconsistent keep: expected: %v, actual: %v", tc.keep, keep)
+			}
+			if !keep {
+				return
+			}
+			if merged.Type != tc.expected || merged.OldElement != 1 || merged.NewElement != 3 {
+				t.Fatalf("Inconsistent merged event: %+v", merged)
+			}
+		})
+	}
+}